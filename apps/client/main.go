@@ -140,6 +140,24 @@ func SetupCloseHandler(ctx context.Context, cancel context.CancelFunc) {
 	}()
 }
 
+// The hostname, cut down to what the server accepts as a rig name
+func defaultRigName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	rig := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, hostname)
+	if len(rig) > 32 {
+		rig = rig[:32]
+	}
+	return rig
+}
+
 // Represents the number of simultaneous work calculations we will run
 var NConcurrentWorkers int
 
@@ -152,6 +170,7 @@ func main() {
 	maxDifficulty := flag.Int("max-difficulty", 128, "The maximum work difficulty to compute, higher than this will be ignored")
 	minDifficulty := flag.Int("min-difficulty", 1, "The minimum work difficulty to compute, lower than this will be ignored")
 	noPrecache := flag.Bool("no-precache", false, "If set, will not compute precached work requests")
+	rig := flag.String("rig", "", "A name for this machine when running several on one account, letters, numbers, dots, dashes and underscores (optional, default hostname)")
 	// Benchmark
 	benchmark := flag.Int("benchmark", 0, "Run a benchmark for the given number of random hashes")
 	benchmarkDifficulty := flag.Int("benchmark-difficulty", 64, "The difficulty multiplier for the benchmark")
@@ -246,7 +265,11 @@ func main() {
 	SetupCloseHandler(ctx, cancel)
 
 	// Create WS Service
-	WSService = websocket.NewWebsocketService(WSUrl, *maxDifficulty, *minDifficulty, *noPrecache)
+	WSService = websocket.NewWebsocketService(WSUrl, Version, *maxDifficulty, *minDifficulty, *noPrecache)
+	WSService.Rig = *rig
+	if WSService.Rig == "" {
+		WSService.Rig = defaultRigName()
+	}
 
 	// Loop to get username and password and login
 	for {
@@ -327,7 +350,21 @@ func main() {
 
 	// Create work processor
 	workProcessor := work.NewWorkProcessor(WSService, *gpuOnly, devicesToUse)
+
+	// Let the server know what we're capable of
+	fmt.Printf("\n⏱️ Measuring hashrate...")
+	hashrate, err := workProcessor.WorkPool.MeasureHashrate(3)
+	if err != nil {
+		fmt.Printf("\n⚠️ Unable to measure hashrate %v", err)
+	} else {
+		fmt.Printf("\n⏱️ Hashrate: %.2f MH/s\n", hashrate/1000000)
+	}
+	WSService.SetCapabilities(workProcessor.WorkPool.CPUThreads, workProcessor.WorkPool.GPUCount, len(workProcessor.WorkPool.Lanes), hashrate)
+
 	workProcessor.StartAsync()
 
-	WSService.StartWSClient(ctx, workProcessor.WorkQueueChan, workProcessor.Queue)
+	// Periodically show how much each device is getting done
+	scheduler.Every(10).Minutes().StartAt(time.Now().Add(10 * time.Minute)).Do(workProcessor.PrintLaneStats)
+
+	WSService.StartWSClient(ctx, workProcessor.WorkQueueChan, workProcessor.WorkCancelChan, workProcessor.Queue)
 }
@@ -13,11 +13,15 @@ import (
 type RandomAccessQueue struct {
 	mu     sync.Mutex
 	hashes []serializableModels.ClientMessage
+	// Order in which each hash was put in the queue, lower is older
+	queuedAt map[string]uint64
+	nextSeq  uint64
 }
 
 func NewRandomAccessQueue() *RandomAccessQueue {
 	return &RandomAccessQueue{
-		hashes: []serializableModels.ClientMessage{},
+		hashes:   []serializableModels.ClientMessage{},
+		queuedAt: make(map[string]uint64),
 	}
 }
 
@@ -44,6 +48,8 @@ func (r *RandomAccessQueue) Put(value serializableModels.ClientMessage) {
 	defer r.mu.Unlock()
 	if !r.exists(value.Hash) {
 		r.hashes = append(r.hashes, value)
+		r.queuedAt[value.Hash] = r.nextSeq
+		r.nextSeq++
 	}
 }
 
@@ -57,10 +63,43 @@ func (r *RandomAccessQueue) PopRandom() *serializableModels.ClientMessage {
 	index := rand.Intn(len(r.hashes))
 	ret := r.hashes[index]
 	r.hashes = remove(r.hashes, index)
+	delete(r.queuedAt, ret.Hash)
 
 	return &ret
 }
 
+// Removes and returns the most urgent value - synchronized
+// Higher priority classes come first, then higher difficulty, then whatever has waited longest
+func (r *RandomAccessQueue) PopNext() *serializableModels.ClientMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.hashes) == 0 {
+		return nil
+	}
+	index := 0
+	for i := 1; i < len(r.hashes); i++ {
+		if r.before(&r.hashes[i], &r.hashes[index]) {
+			index = i
+		}
+	}
+	ret := r.hashes[index]
+	r.hashes = remove(r.hashes, index)
+	delete(r.queuedAt, ret.Hash)
+
+	return &ret
+}
+
+// Whether a should be worked on before b, must be called from within a locked section
+func (r *RandomAccessQueue) before(a *serializableModels.ClientMessage, b *serializableModels.ClientMessage) bool {
+	if aPriority, bPriority := a.EffectivePriority(), b.EffectivePriority(); aPriority != bPriority {
+		return aPriority.Before(bPriority)
+	}
+	if a.Threshold() != b.Threshold() {
+		return a.Threshold() > b.Threshold()
+	}
+	return r.queuedAt[a.Hash] < r.queuedAt[b.Hash]
+}
+
 // Gets a value from the map - synchronized
 func (r *RandomAccessQueue) Get(hash string) *serializableModels.ClientMessage {
 	r.mu.Lock()
@@ -78,7 +117,8 @@ func (r *RandomAccessQueue) Delete(hash string) {
 	defer r.mu.Unlock()
 	index := r.indexOf(hash)
 	if index > -1 {
-		r.hashes = remove(r.hashes, r.indexOf(hash))
+		r.hashes = remove(r.hashes, index)
+		delete(r.queuedAt, hash)
 	}
 }
 
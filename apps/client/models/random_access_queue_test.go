@@ -43,3 +43,44 @@ func TestRandomAccessMap(t *testing.T) {
 	// Check length
 	utils.AssertEqual(t, 2, queue.Len())
 }
+
+func TestPopNext(t *testing.T) {
+	queue := NewRandomAccessQueue()
+
+	queue.Put(serializableModels.ClientMessage{
+		Hash:                 "precache",
+		DifficultyMultiplier: 64,
+		Precache:             true,
+	})
+	queue.Put(serializableModels.ClientMessage{
+		Hash:                 "old",
+		DifficultyMultiplier: 1,
+	})
+	queue.Put(serializableModels.ClientMessage{
+		Hash:                 "new",
+		DifficultyMultiplier: 1,
+	})
+	queue.Put(serializableModels.ClientMessage{
+		Hash:                 "hard",
+		DifficultyMultiplier: 8,
+	})
+	queue.Put(serializableModels.ClientMessage{
+		Hash:                 "bulk",
+		DifficultyMultiplier: 64,
+		Priority:             serializableModels.PriorityBulk,
+	})
+	queue.Put(serializableModels.ClientMessage{
+		Hash:                 "interactive",
+		DifficultyMultiplier: 1,
+		Priority:             serializableModels.PriorityInteractive,
+	})
+
+	// Interactive before precache before bulk, harder first, then oldest
+	utils.AssertEqual(t, "hard", queue.PopNext().Hash)
+	utils.AssertEqual(t, "old", queue.PopNext().Hash)
+	utils.AssertEqual(t, "new", queue.PopNext().Hash)
+	utils.AssertEqual(t, "interactive", queue.PopNext().Hash)
+	utils.AssertEqual(t, "precache", queue.PopNext().Hash)
+	utils.AssertEqual(t, "bulk", queue.PopNext().Hash)
+	utils.AssertEqual(t, (*serializableModels.ClientMessage)(nil), queue.PopNext())
+}
@@ -11,39 +11,74 @@ import (
 )
 
 type WebsocketService struct {
-	WS            *RecConn
-	AuthToken     string
-	URL           string
-	maxDifficulty int
-	minDifficulty int
-	skipPrecache  bool
+	WS        *RecConn
+	AuthToken string
+	URL       string
+	// Name of this rig, so the server can tell our connections apart from others on the account
+	Rig string
+	// Sent to the server every time we connect
+	hello *serializableModels.ClientHello
 }
 
-func NewWebsocketService(url string, maxDifficulty int, minDifficulty int, skipPrecache bool) *WebsocketService {
-	return &WebsocketService{
-		WS:            &RecConn{},
-		URL:           url,
-		maxDifficulty: maxDifficulty,
-		minDifficulty: minDifficulty,
-		skipPrecache:  skipPrecache,
+func NewWebsocketService(url string, clientVersion string, maxDifficulty int, minDifficulty int, skipPrecache bool) *WebsocketService {
+	ws := &WebsocketService{
+		WS:  &RecConn{},
+		URL: url,
+		hello: &serializableModels.ClientHello{
+			MessageType:   serializableModels.Hello,
+			Version:       serializableModels.ClientHelloVersion,
+			ClientVersion: clientVersion,
+			MinDifficulty: minDifficulty,
+			MaxDifficulty: maxDifficulty,
+			NoPrecache:    skipPrecache,
+			Concurrency:   1,
+		},
 	}
+	ws.WS.SubscribeHandler = ws.sendHello
+	return ws
+}
+
+// SetCapabilities sets the hardware details we advertise to the server
+func (ws *WebsocketService) SetCapabilities(cpuThreads int, gpuCount int, concurrency int, hashrate float64) {
+	ws.hello.Devices = serializableModels.ClientDevices{
+		CPUThreads: cpuThreads,
+		GPUCount:   gpuCount,
+	}
+	ws.hello.Concurrency = concurrency
+	ws.hello.Hashrate = hashrate
+}
+
+// Tell the server what we can do, so it doesn't send us requests we would ignore
+func (ws *WebsocketService) sendHello() error {
+	if err := ws.WS.WriteJSON(ws.hello); err != nil {
+		// Not fatal, the server will just send us everything
+		fmt.Printf("\n⚠️ Error sending hello %v", err)
+	}
+	return nil
 }
 
 func (ws *WebsocketService) SetAuthToken(authToken string) {
 	ws.AuthToken = authToken
-	ws.WS.setReqHeader(http.Header{
+	ws.WS.setReqHeader(ws.header())
+}
+
+// Headers we connect with
+func (ws *WebsocketService) header() http.Header {
+	header := http.Header{
 		"Authorization": {ws.AuthToken},
-	})
+	}
+	if ws.Rig != "" {
+		header.Set(serializableModels.RigHeader, ws.Rig)
+	}
+	return header
 }
 
-func (ws *WebsocketService) StartWSClient(ctx context.Context, workQueueChan chan *serializableModels.ClientMessage, queue *models.RandomAccessQueue) {
+func (ws *WebsocketService) StartWSClient(ctx context.Context, workQueueChan chan *serializableModels.ClientMessage, workCancelChan chan string, queue *models.RandomAccessQueue) {
 	if ws.AuthToken == "" {
 		panic("Tired to start websocket client without auth token")
 	}
 	// Start the websocket connection
-	ws.WS.Dial(ws.URL, http.Header{
-		"Authorization": {ws.AuthToken},
-	})
+	ws.WS.Dial(ws.URL, ws.header())
 
 	for {
 		select {
@@ -67,16 +102,17 @@ func (ws *WebsocketService) StartWSClient(ctx context.Context, workQueueChan cha
 
 			// Determine type of message
 			if serverMsg.MessageType == serializableModels.WorkGenerate {
-				if serverMsg.DifficultyMultiplier > ws.maxDifficulty {
-					fmt.Printf("\n😒 Ignoring work request %s with difficulty %dx above our max %dx", serverMsg.Hash, serverMsg.DifficultyMultiplier, ws.maxDifficulty)
+				// Servers that understand our hello won't send these, older ones might
+				if serverMsg.DifficultyMultiplier > ws.hello.MaxDifficulty {
+					fmt.Printf("\n😒 Ignoring work request %s with difficulty %dx above our max %dx", serverMsg.Hash, serverMsg.DifficultyMultiplier, ws.hello.MaxDifficulty)
 					continue
 				}
-				if serverMsg.DifficultyMultiplier < ws.minDifficulty {
-					fmt.Printf("\n😒 Ignoring work request %s with difficulty %dx below our min %dx", serverMsg.Hash, serverMsg.DifficultyMultiplier, ws.minDifficulty)
+				if serverMsg.DifficultyMultiplier < ws.hello.MinDifficulty {
+					fmt.Printf("\n😒 Ignoring work request %s with difficulty %dx below our min %dx", serverMsg.Hash, serverMsg.DifficultyMultiplier, ws.hello.MinDifficulty)
 					continue
 				}
 
-				if ws.skipPrecache && serverMsg.Precache {
+				if ws.hello.NoPrecache && serverMsg.Precache {
 					fmt.Printf("\n😒 Ignoring precache request %s", serverMsg.Hash)
 					continue
 				}
@@ -101,8 +137,9 @@ func (ws *WebsocketService) StartWSClient(ctx context.Context, workQueueChan cha
 				workQueueChan <- &serverMsg
 			} else if serverMsg.MessageType == serializableModels.WorkCancel {
 				// Delete pending work from queue
-				// ! TODO - can we cancel currently runing work calculations?
 				queue.Delete(serverMsg.Hash)
+				// Stop computing it if we already started
+				workCancelChan <- serverMsg.Hash
 			} else if serverMsg.MessageType == serializableModels.BlockAwarded {
 				fmt.Printf("\n💰 Received block awarded %s", serverMsg.Hash)
 				fmt.Printf("\n💰 Your current estimated next payout is %f%% or %f BAN", serverMsg.PercentOfPool, serverMsg.EstimatedAward)
@@ -1,13 +1,16 @@
 package work
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/Inkeliz/go-opencl/opencl"
 	"github.com/bananocoin/boompow/libs/models"
+	"github.com/bananocoin/boompow/libs/utils/validation"
 )
 
 func RunBenchmark(nHashes int, difficultyMultiplier int, gpuOnly bool, devices []opencl.Device) {
@@ -25,7 +28,7 @@ func RunBenchmark(nHashes int, difficultyMultiplier int, gpuOnly bool, devices [
 		fmt.Printf("\nRun %d", i+1)
 		startT := time.Now()
 
-		_, err := workPool.WorkGenerate(&models.ClientMessage{
+		_, err := workPool.WorkGenerate(context.Background(), &models.ClientMessage{
 			Hash:                 hex.EncodeToString(bytes),
 			DifficultyMultiplier: difficultyMultiplier,
 		})
@@ -39,3 +42,25 @@ func RunBenchmark(nHashes int, difficultyMultiplier int, gpuOnly bool, devices [
 	}
 	fmt.Printf("\n\nAverage: %fs", totalDelta/float64(nHashes))
 }
+
+// MeasureHashrate generates work for a few random hashes at the base difficulty and estimates hashes per second
+func (p *WorkPool) MeasureHashrate(samples int) (float64, error) {
+	difficulty := validation.CalculateDifficulty(1)
+	// On average this many hashes are needed to find work meeting the difficulty
+	expectedHashes := float64(math.MaxUint64) / float64(math.MaxUint64-difficulty)
+	startT := time.Now()
+	for i := 0; i < samples; i++ {
+		bytes := make([]byte, 32)
+		if _, err := rand.Read(bytes); err != nil {
+			return 0, err
+		}
+		if _, err := p.Pool.GenerateWork(bytes, difficulty); err != nil {
+			return 0, err
+		}
+	}
+	elapsed := time.Since(startT).Seconds()
+	if elapsed <= 0 {
+		return 0, nil
+	}
+	return expectedHashes * float64(samples) / elapsed, nil
+}
@@ -0,0 +1,85 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/bbedward/nanopow"
+)
+
+// WorkLane is a group of workers that computes one request at a time, e.g. a single GPU or all CPU threads
+type WorkLane struct {
+	Name    string
+	Workers []nanopow.WorkerGenerator
+	mu      sync.Mutex
+	stats   LaneStats
+}
+
+// LaneStats are counters for the requests a lane has worked on
+type LaneStats struct {
+	Name      string
+	Completed int
+	Cancelled int
+	Failed    int
+	// Time spent computing, whatever the outcome
+	Busy    time.Duration
+	Started time.Time
+}
+
+func NewWorkLane(name string, workers ...nanopow.WorkerGenerator) *WorkLane {
+	return &WorkLane{
+		Name:    name,
+		Workers: workers,
+		stats: LaneStats{
+			Name:    name,
+			Started: time.Now(),
+		},
+	}
+}
+
+// WorkGenerate computes work for the item on this lane's workers and records the outcome
+func (l *WorkLane) WorkGenerate(ctx context.Context, item *serializableModels.ClientMessage) (string, error) {
+	startT := time.Now()
+	result, err := generateWork(ctx, l.Workers, item)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Busy += time.Since(startT)
+	switch {
+	case err == nil:
+		l.stats.Completed++
+	case errors.Is(err, context.Canceled):
+		l.stats.Cancelled++
+	default:
+		l.stats.Failed++
+	}
+	return result, err
+}
+
+// Stats returns a snapshot of the lane's counters
+func (l *WorkLane) Stats() LaneStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Throughput is the number of completed requests per minute since the lane started
+func (s LaneStats) Throughput() float64 {
+	elapsed := time.Since(s.Started).Minutes()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Completed) / elapsed
+}
+
+// Utilization is the fraction of time the lane spent computing
+func (s LaneStats) Utilization() float64 {
+	elapsed := time.Since(s.Started)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Busy) / float64(elapsed)
+}
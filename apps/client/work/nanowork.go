@@ -1,28 +1,39 @@
 package work
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"runtime"
+	"sync"
 
 	"github.com/Inkeliz/go-opencl/opencl"
 	serializableModels "github.com/bananocoin/boompow/libs/models"
-	"github.com/bananocoin/boompow/libs/utils/validation"
 	"github.com/bbedward/nanopow"
 	"k8s.io/klog/v2"
 )
 
 type WorkPool struct {
 	Pool *nanopow.Pool
+	// Each lane computes a different request at the same time
+	Lanes []*WorkLane
+	// Devices in use
+	GPUCount   int
+	CPUThreads int
 }
 
 func NewWorkPool(gpuOnly bool, devices []opencl.Device) *WorkPool {
 	pool := nanopow.NewPool()
+	lanes := []*WorkLane{}
+	gpuCount := 0
+	cpuThreads := 0
 	for _, device := range devices {
 		gpu, gpuErr := nanopow.NewWorkerGPU(device)
 		if gpuErr == nil {
 			pool.Workers = append(pool.Workers, gpu)
+			lanes = append(lanes, NewWorkLane(fmt.Sprintf("GPU %d", gpuCount), gpu))
+			gpuCount++
 		} else {
 			fmt.Printf("\n⚠️ Unable to use GPU %v", gpuErr)
 		}
@@ -39,33 +50,88 @@ func NewWorkPool(gpuOnly bool, devices []opencl.Device) *WorkPool {
 		cpu, cpuErr := nanopow.NewWorkerCPUThread(uint64(threads))
 		if cpuErr == nil {
 			pool.Workers = append(pool.Workers, cpu)
+			lanes = append(lanes, NewWorkLane("CPU", cpu))
+			cpuThreads = threads
 		} else {
 			panic(fmt.Sprintf("Unable to initialize work pool for CPU %v", cpuErr))
 		}
 	}
 
 	return &WorkPool{
-		Pool: pool,
+		Pool:       pool,
+		Lanes:      lanes,
+		GPUCount:   gpuCount,
+		CPUThreads: cpuThreads,
 	}
 }
 
-func (p *WorkPool) WorkGenerate(item *serializableModels.ClientMessage) (string, error) {
+// WorkGenerate computes work for the item using every device, stopping early if the context is done
+func (p *WorkPool) WorkGenerate(ctx context.Context, item *serializableModels.ClientMessage) (string, error) {
+	return generateWork(ctx, p.Pool.Workers, item)
+}
+
+// Computes work for the item on the given workers, stopping them early if the context is done
+func generateWork(ctx context.Context, workers []nanopow.WorkerGenerator, item *serializableModels.ClientMessage) (string, error) {
 	decoded, err := hex.DecodeString(item.Hash)
 	if err != nil {
 		return "", err
 	}
-	work, err := p.Pool.GenerateWork(decoded, validation.CalculateDifficulty(int64(item.DifficultyMultiplier)))
-	if err != nil {
-		return "", err
+	difficulty := item.Threshold()
+
+	// Same as nanopow.Pool.GenerateWork, but we keep the context so we can stop the workers
+	job := startPowJob(workers, decoded, difficulty)
+
+	var work nanopow.Work
+	select {
+	case work = <-job.result:
+	case <-ctx.Done():
+		job.stop()
+		return "", ctx.Err()
 	}
 
-	if !nanopow.IsValid(decoded, validation.CalculateDifficulty(int64(item.DifficultyMultiplier)), work) {
+	if !nanopow.IsValid(decoded, difficulty, work) {
 		klog.Errorf("\n⚠️ Generated invalid work for %s", item.Hash)
 		return "", errors.New("Invalid work")
 	}
 	return WorkToString(work), nil
 }
 
+// powJob is one search on a nanopow context
+// Result cancels the context when a worker finds something, and cancelling it twice panics, so that's the only way it's cancelled
+type powJob struct {
+	ctx      *nanopow.Context
+	root     []byte
+	result   chan nanopow.Work
+	stopOnce sync.Once
+}
+
+func startPowJob(workers []nanopow.WorkerGenerator, root []byte, difficulty uint64) *powJob {
+	job := &powJob{
+		ctx:  nanopow.NewContext(),
+		root: root,
+		// Buffered so the goroutine can finish once nobody is waiting
+		result: make(chan nanopow.Work, 1),
+	}
+	for _, wk := range workers {
+		if wk == nil {
+			continue
+		}
+		go wk.GenerateWork(job.ctx, root, difficulty)
+	}
+	go func() {
+		job.result <- job.ctx.Result()
+	}()
+	return job
+}
+
+// Stop the workers early, by having a worker that takes any nonce give Result something to cancel with
+func (j *powJob) stop() {
+	j.stopOnce.Do(func() {
+		stopper, _ := nanopow.NewWorkerCPUThread(1)
+		stopper.GenerateWork(j.ctx, j.root, 0)
+	})
+}
+
 func WorkToString(w nanopow.Work) string {
 	n := make([]byte, 8)
 	copy(n, w[:])
@@ -2,6 +2,7 @@ package work
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -12,72 +13,101 @@ import (
 	serializableModels "github.com/bananocoin/boompow/libs/models"
 )
 
+// Give up on a request if it takes longer than this
+const workTimeout = 10 * time.Second
+
 type WorkProcessor struct {
 	Queue *models.RandomAccessQueue
 	// WorkQueueChan is where we write requests from the websocket
 	WorkQueueChan chan *serializableModels.ClientMessage
-	WSService     *websocket.WebsocketService
-	WorkPool      *WorkPool
-	mu            sync.Mutex
+	// WorkCancelChan receives hashes that somebody else already solved
+	WorkCancelChan chan string
+	WSService      *websocket.WebsocketService
+	WorkPool       *WorkPool
+	// Cancel functions for the work currently being computed, keyed by hash
+	cancels map[string]context.CancelFunc
+	mu      sync.Mutex
 }
 
 func NewWorkProcessor(ws *websocket.WebsocketService, gpuOnly bool, devices []opencl.Device) *WorkProcessor {
 	wp := NewWorkPool(gpuOnly, devices)
 	return &WorkProcessor{
-		Queue:         models.NewRandomAccessQueue(),
-		WorkQueueChan: make(chan *serializableModels.ClientMessage, 100),
-		WSService:     ws,
-		WorkPool:      wp,
+		Queue:          models.NewRandomAccessQueue(),
+		WorkQueueChan:  make(chan *serializableModels.ClientMessage, 100),
+		WorkCancelChan: make(chan string, 100),
+		WSService:      ws,
+		WorkPool:       wp,
+		cancels:        make(map[string]context.CancelFunc),
 	}
 }
 
 // RequestQueueWorker - is a worker that receives work requests directly from the websocket, adds them to the queue, and determines what should be worked on next
-func (wp *WorkProcessor) StartRequestQueueWorker() {
+// There is one per lane, so each lane computes a different request at the same time
+func (wp *WorkProcessor) StartRequestQueueWorker(lane *WorkLane) {
 	for range wp.WorkQueueChan {
-		// Pop random unit of work from queue, begin computation
-		workItem := wp.Queue.PopRandom()
+		// Pop most urgent unit of work from queue, begin computation
+		workItem := wp.Queue.PopNext()
 		if workItem != nil {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			// Generate work with timeout
-			ch := make(chan string)
+			wp.generate(lane, workItem)
+		}
+	}
+}
 
-			go func() {
-				wp.mu.Lock()
-				defer wp.mu.Unlock()
-				result, err := wp.WorkPool.WorkGenerate(workItem)
-				if err != nil {
-					result = ""
-				}
+// CancelWorker - stops computing work for hashes the server cancelled
+func (wp *WorkProcessor) StartCancelWorker() {
+	for hash := range wp.WorkCancelChan {
+		wp.mu.Lock()
+		if cancel, ok := wp.cancels[hash]; ok {
+			cancel()
+		}
+		wp.mu.Unlock()
+	}
+}
 
-				select {
-				default:
-					ch <- result
-				case <-ctx.Done():
-				}
-			}()
+// Compute work for this item and send the result to the server
+func (wp *WorkProcessor) generate(lane *WorkLane, workItem *serializableModels.ClientMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), workTimeout)
+	defer cancel()
+	wp.mu.Lock()
+	wp.cancels[workItem.Hash] = cancel
+	wp.mu.Unlock()
+	defer func() {
+		wp.mu.Lock()
+		delete(wp.cancels, workItem.Hash)
+		wp.mu.Unlock()
+	}()
 
-			select {
-			case result := <-ch:
-				if result != "" {
-					// Send result back to server
-					clientWorkResult := serializableModels.ClientWorkResponse{
-						RequestID: workItem.RequestID,
-						Hash:      workItem.Hash,
-						Result:    result,
-					}
-					wp.WSService.WS.WriteJSON(clientWorkResult)
-				} else {
-					fmt.Printf("\n❌ Error: generate work for %s\n", workItem.Hash)
-				}
-			case <-time.After(10 * time.Second):
-				fmt.Printf("\n❌ Error: took longer than 10s to generate work for %s", workItem.Hash)
-			}
+	result, err := lane.WorkGenerate(ctx, workItem)
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Printf("\n🛑 Stopped work for %s, somebody else solved it", workItem.Hash)
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Printf("\n❌ Error: took longer than %v to generate work for %s", workTimeout, workItem.Hash)
+	case err != nil:
+		fmt.Printf("\n❌ Error: generate work for %s\n", workItem.Hash)
+	default:
+		// Send result back to server
+		clientWorkResult := serializableModels.ClientWorkResponse{
+			RequestID: workItem.RequestID,
+			Hash:      workItem.Hash,
+			Result:    result,
 		}
+		wp.WSService.WS.WriteJSON(clientWorkResult)
 	}
 }
 
-// Start both workers
+// Start a queue worker for every lane and the cancel worker
 func (wp *WorkProcessor) StartAsync() {
-	go wp.StartRequestQueueWorker()
+	for _, lane := range wp.WorkPool.Lanes {
+		go wp.StartRequestQueueWorker(lane)
+	}
+	go wp.StartCancelWorker()
+}
+
+// PrintLaneStats prints the throughput of every lane
+func (wp *WorkProcessor) PrintLaneStats() {
+	for _, lane := range wp.WorkPool.Lanes {
+		stats := lane.Stats()
+		fmt.Printf("\n📊 %s: %d completed, %d cancelled, %d failed, %.2f/min, %.0f%% busy", stats.Name, stats.Completed, stats.Cancelled, stats.Failed, stats.Throughput(), stats.Utilization()*100)
+	}
 }
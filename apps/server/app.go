@@ -1,12 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -15,10 +16,12 @@ import (
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/bananocoin/boompow/apps/server/graph"
 	"github.com/bananocoin/boompow/apps/server/graph/generated"
+	"github.com/bananocoin/boompow/apps/server/src/config"
 	"github.com/bananocoin/boompow/apps/server/src/controller"
 	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/jobs"
 	"github.com/bananocoin/boompow/apps/server/src/middleware"
-	"github.com/bananocoin/boompow/apps/server/src/net"
+	"github.com/bananocoin/boompow/apps/server/src/models"
 	"github.com/bananocoin/boompow/apps/server/src/repository"
 	serializableModels "github.com/bananocoin/boompow/libs/models"
 	"github.com/bananocoin/boompow/libs/utils"
@@ -28,7 +31,9 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
+	"golang.org/x/exp/slices"
 	"k8s.io/klog/v2"
 )
 
@@ -43,7 +48,7 @@ func runServer() {
 	database.GetRedisDB().WipeAllConnectedClients()
 	godotenv.Load()
 	// Setup database conn
-	config := &database.Config{
+	dbConfig := &database.Config{
 		Host:     os.Getenv("DB_HOST"),
 		Port:     os.Getenv("DB_PORT"),
 		Password: os.Getenv("DB_PASS"),
@@ -52,7 +57,7 @@ func runServer() {
 		DBName:   os.Getenv("DB_NAME"),
 	}
 	fmt.Println("🏡 Connecting to database...")
-	db, err := database.NewConnection(config)
+	db, err := database.NewConnection(dbConfig)
 	if err != nil {
 		panic(err)
 	}
@@ -73,34 +78,56 @@ func runServer() {
 	userRepo := repository.NewUserService((db))
 	workRepo := repository.NewWorkService(db, userRepo)
 	paymentRepo := repository.NewPaymentService(db)
+	auditRepo := repository.NewAuditService(db)
+	tokenRepo := repository.NewServiceTokenService(db)
+	sessionRepo := repository.NewWorkerSessionService(db)
 	fmt.Println("Repository created")
 
-	precacheMap := &sync.Map{}
+	workRequester := controller.NewWorkRequester(workRepo)
 
 	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{
-		UserRepo:    userRepo,
-		WorkRepo:    workRepo,
-		PaymentRepo: paymentRepo,
-		PrecacheMap: precacheMap,
+		UserRepo:          userRepo,
+		WorkRepo:          workRepo,
+		PaymentRepo:       paymentRepo,
+		TokenRepo:         tokenRepo,
+		AuditRepo:         auditRepo,
+		WorkerSessionRepo: sessionRepo,
+		WorkRequester:     workRequester,
 	}}))
+	srv.SetErrorPresenter(graph.ErrorPresenter)
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
-	// // Configure WebSocket with CORS
-	// srv.AddTransport(&transport.Websocket{
-	// 	Upgrader: websocket.Upgrader{
-	// 		CheckOrigin: func(r *http.Request) bool {
-	// 			return false
-	// 		},
-	// 		ReadBufferSize:  1024,
-	// 		WriteBufferSize: 1024,
-	// 	},
-	// 	KeepAlivePingInterval: 10 * time.Second,
-	// })
+	// Websocket for subscriptions
+	srv.AddTransport(&transport.Websocket{
+		Upgrader: websocket.Upgrader{
+			// Same as our CORS policy
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+		InitFunc:              middleware.WebsocketInitFunc(userRepo, tokenRepo),
+		KeepAlivePingInterval: 10 * time.Second,
+	})
 	if utils.GetEnv("ENVIRONMENT", "development") == "development" {
 		srv.Use(extension.Introspection{})
 	}
 
+	// Forwarded headers are only believed from these, anyone else could make up their IP
+	trustedProxies, err := config.LoadTrustedProxies()
+	if err != nil {
+		panic(fmt.Sprintf("Invalid BPOW_TRUSTED_PROXIES: %v", err))
+	}
+	netutils.SetTrustedProxies(trustedProxies)
+
+	// Load the IP policy before we take requests, the ip-policy job keeps it fresh
+	fmt.Println("🛡️ Loading IP policy...")
+	if err := config.ReloadIPPolicy(); err != nil {
+		klog.Errorf("Failed to load IP policy, retrying on the next reload: %v", err)
+	}
+
 	// Setup router
 	router := chi.NewRouter()
 	// ! TODO - this is temporary, need to set origins in prod
@@ -127,7 +154,9 @@ func runServer() {
 	// 		Debug:            true,
 	// 	}).Handler)
 	// }
-	router.Use(middleware.AuthMiddleware(userRepo))
+	// Turn away denied addresses before anything else, on every endpoint
+	router.Use(middleware.IPPolicyMiddleware(config.GetIPPolicy))
+	router.Use(middleware.AuthMiddleware(userRepo, tokenRepo))
 	// Rate limiting middleware
 	router.Use(httprate.Limit(
 		20,            // requests
@@ -147,14 +176,18 @@ func runServer() {
 		log.Printf("🚀 connect to http://localhost:%s/ for GraphQL playground", port)
 	}
 	router.Handle("/graphql", srv)
+	// Node RPC compatible work_generate, work_validate and work_cancel
+	router.Post("/rpc", controller.RPCHandler(workRequester))
 
 	// Setup channel for stats processing job
 	statsChan := make(chan repository.WorkMessage, 100)
 	// Setup channel for sending block awarded messages
 	blockAwardedChan := make(chan serializableModels.ClientMessage)
+	// Setup channel for saving worker sessions
+	sessionChan := make(chan *models.WorkerSession, controller.WorkerSessionBuffer)
 
 	// Setup WS endpoint
-	controller.ActiveHub = controller.NewHub(&statsChan)
+	controller.ActiveHub = controller.NewHub(&statsChan, sessionChan, userRepo, auditRepo)
 	go controller.ActiveHub.Run()
 	router.HandleFunc("/ws/worker", func(w http.ResponseWriter, r *http.Request) {
 		controller.WorkerChl(controller.ActiveHub, w, r)
@@ -164,92 +197,76 @@ func runServer() {
 	go workRepo.StatsWorker(statsChan, &blockAwardedChan)
 	// Job for sending block awarded messages to user
 	go controller.ActiveHub.BlockAwardedWorker(blockAwardedChan)
+	// Job for saving worker sessions
+	go sessionRepo.SessionWorker(sessionChan)
 
-	// Setup callback clients for pre-caching
-
-	// Start nano WS client
-	callbackChan := make(chan *net.WSCallbackMsg, 100)
-	if utils.GetEnv("NANO_WS_URL", "") != "" {
-		go net.StartNanoWSClient(utils.GetEnv("NANO_WS_URL", ""), &callbackChan)
-	}
-
-	// Read channel to notify clients of blocks of new blocks
-	go func() {
-		for msg := range callbackChan {
-			_, ok := precacheMap.LoadAndDelete(msg.Block.Previous)
-			if !ok {
-				continue
-			}
-
-			// We want to precache this if we don't have it
-			_, err := workRepo.RetrieveWorkFromCache(msg.Hash, 64)
-			if err == nil {
-				// Already cached
-				continue
-			}
-
-			workRequest := serializableModels.ClientMessage{
-				RequesterEmail:       "nano@banano.cc",
-				BlockAward:           true,
-				MessageType:          serializableModels.WorkGenerate,
-				RequestID:            uuid.NewString(),
-				Hash:                 msg.Hash,
-				DifficultyMultiplier: 64,
-				Precache:             true,
-			}
-
-			controller.BroadcastWorkRequestAndWait(workRequest)
-			if msg.Block.Subtype != "send" {
-				continue
-			}
+	// Setup callback clients for pre-caching, one per network with a node to watch
+	for _, network := range config.GetNetworks() {
+		if network.WSURL == "" {
+			continue
 		}
-	}()
-
-	// Start banano WS client
-	callbackChanBanano := make(chan *net.WSCallbackMsg, 100)
-	if utils.GetEnv("BANANO_WS_URL", "") != "" {
-		go net.StartNanoWSClient(utils.GetEnv("BANANO_WS_URL", ""), &callbackChanBanano)
+		fmt.Printf("🔗 Precaching %s work from %s\n", network.Name, network.WSURL)
+		precacher := controller.NewPrecacher(network, workRepo)
+		precacher.Start()
+		workRequester.Precachers = append(workRequester.Precachers, precacher)
 	}
 
-	// Read channel to notify clients of blocks of new blocks
-	go func() {
-		for msg := range callbackChanBanano {
-			_, ok := precacheMap.LoadAndDelete(msg.Block.Previous)
-			if !ok {
-				continue
-			}
-
-			// We want to precache this if we don't have it
-			_, err := workRepo.RetrieveWorkFromCache(msg.Hash, 1)
-			if err == nil {
-				// Already cached
-				continue
-			}
-
-			workRequest := serializableModels.ClientMessage{
-				RequesterEmail:       "all@banano.cc",
-				BlockAward:           true,
-				MessageType:          serializableModels.WorkGenerate,
-				RequestID:            uuid.NewString(),
-				Hash:                 msg.Hash,
-				DifficultyMultiplier: 1,
-				Precache:             true,
+	// Background jobs
+	fmt.Println("🕒 Starting background jobs...")
+	supervisor := jobs.NewSupervisor()
+	supervisor.Add(&jobs.Job{
+		Name:     "stats",
+		Interval: jobs.GetDuration("BPOW_STATS_INTERVAL", 10*time.Minute),
+		Jitter:   jobs.GetDuration("BPOW_STATS_JITTER", 30*time.Second),
+		Run: func() error {
+			return repository.UpdateStats(paymentRepo, workRepo)
+		},
+		Follow: repository.LoadStats,
+	})
+	supervisor.Add(&jobs.Job{
+		Name:     "precache-expiry",
+		Interval: time.Minute,
+		Run: func() error {
+			expired, err := database.GetRedisDB().ExpirePrecache(config.PRECACHE_VALID_MINUTES * time.Minute)
+			if expired > 0 {
+				klog.V(3).Infof("Expired %d precache entries", expired)
 			}
-
-			controller.BroadcastWorkRequestAndWait(workRequest)
-			if msg.Block.Subtype != "send" {
-				continue
+			return err
+		},
+	})
+	// Every replica saves its own workers, and one closes sessions left open by replicas that went away
+	supervisor.Add(&jobs.Job{
+		Name:     "worker-sessions",
+		Interval: time.Minute,
+		Run: func() error {
+			controller.ActiveHub.FlushSessions()
+			closed, err := sessionRepo.CloseStaleSessions(time.Now().Add(-config.WORKER_SESSION_STALE_MINUTES * time.Minute))
+			if closed > 0 {
+				klog.V(3).Infof("Closed %d stale worker sessions", closed)
 			}
+			return err
+		},
+		Follow: func() error {
+			controller.ActiveHub.FlushSessions()
+			return nil
+		},
+	})
+	// Every replica keeps its own copy of the IP policy, and drops its workers the new one denies
+	reloadIPPolicy := func() error {
+		if err := config.ReloadIPPolicy(); err != nil {
+			return err
 		}
-	}()
-
-	// Update stats and setup cron
-	// repository.UpdateStats(paymentRepo, workRepo)
-	// fmt.Println("🕒 Setting up cron...")
-	// scheduler := gocron.NewScheduler(time.UTC)
-	// scheduler.Every(10).Minutes().Do(func() {
-	// 	repository.UpdateStats(paymentRepo, workRepo)
-	// })
+		controller.ActiveHub.EnforceIPPolicy(config.GetIPPolicy())
+		return nil
+	}
+	supervisor.Add(&jobs.Job{
+		Name:     "ip-policy",
+		Interval: jobs.GetDuration("BPOW_IP_POLICY_INTERVAL", time.Hour),
+		Jitter:   jobs.GetDuration("BPOW_IP_POLICY_JITTER", time.Minute),
+		Run:      reloadIPPolicy,
+		Follow:   reloadIPPolicy,
+	})
+	supervisor.Start(context.Background())
 
 	fmt.Println("🚀 Starting server...")
 	log.Fatal(http.ListenAndServe(":"+port, router))
@@ -283,6 +300,111 @@ func createService(serviceName string, serviceURL string) {
 	fmt.Printf("🔑 Service created with token: %s", token)
 }
 
+// Bring an existing database up to date, the server doesn't do it on startup so replicas don't race
+func migrateDatabase() {
+	godotenv.Load()
+	// Setup database conn
+	dbConfig := &database.Config{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		Password: os.Getenv("DB_PASS"),
+		User:     os.Getenv("DB_USER"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+		DBName:   os.Getenv("DB_NAME"),
+	}
+	fmt.Println("🏡 Connecting to database...")
+	db, err := database.NewConnection(dbConfig)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("🦋 Running database migrations...")
+	if err := database.Migrate(db); err != nil {
+		panic(err)
+	}
+	fmt.Println("🦋 Database is up to date")
+}
+
+// Make an existing user an admin, there's no other way to get the first one
+func makeAdmin(email string) {
+	godotenv.Load()
+	// Setup database conn
+	dbConfig := &database.Config{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		Password: os.Getenv("DB_PASS"),
+		User:     os.Getenv("DB_USER"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+		DBName:   os.Getenv("DB_NAME"),
+	}
+	fmt.Println("🏡 Connecting to database...")
+	db, err := database.NewConnection(dbConfig)
+	if err != nil {
+		panic(err)
+	}
+	// The ADMIN type and the audit log may not exist yet on a database from before admins
+	if err := database.Migrate(db); err != nil {
+		panic(err)
+	}
+	userRepo := repository.NewUserService(db)
+
+	email = strings.ToLower(email)
+	user, err := userRepo.GetUser(nil, &email)
+	if err != nil {
+		panic(err)
+	}
+	if err := userRepo.SetType(user.ID, models.ADMIN, &repository.AuditEntry{Action: models.AUDIT_ADMIN_GRANTED, Reason: "granted from the command line"}); err != nil {
+		panic(err)
+	}
+	fmt.Printf("🛡 %s is now an admin\n", email)
+}
+
+// Move service tokens from redis to postgres, only the ones in BPOW_SERVICE_TOKENS worked so only those are kept
+func importServiceTokens() {
+	godotenv.Load()
+	// Setup database conn
+	dbConfig := &database.Config{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		Password: os.Getenv("DB_PASS"),
+		User:     os.Getenv("DB_USER"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+		DBName:   os.Getenv("DB_NAME"),
+	}
+	fmt.Println("🏡 Connecting to database...")
+	db, err := database.NewConnection(dbConfig)
+	if err != nil {
+		panic(err)
+	}
+	// The tokens table may not exist yet
+	if err := database.Migrate(db); err != nil {
+		panic(err)
+	}
+	tokenRepo := repository.NewServiceTokenService(db)
+
+	legacy, err := database.GetRedisDB().GetLegacyServiceTokens()
+	if err != nil {
+		panic(err)
+	}
+	allowed := utils.GetServiceTokens()
+	imported := 0
+	for token, userID := range legacy {
+		if !slices.Contains(allowed, token) {
+			continue
+		}
+		userUUID, err := uuid.Parse(userID)
+		if err != nil {
+			fmt.Printf("Skipping token with invalid user ID %s\n", userID)
+			continue
+		}
+		if err := tokenRepo.ImportServiceToken(userUUID, token); err != nil {
+			fmt.Printf("Error importing token for %s: %v\n", userID, err)
+			continue
+		}
+		imported++
+	}
+	fmt.Printf("🔑 Imported %d of %d service tokens\n", imported, len(legacy))
+}
+
 func main() {
 	flag.Usage = usage
 	klog.InitFlags(nil)
@@ -299,6 +421,9 @@ func main() {
 	addService := flag.Bool("addService", false, "Add service")
 	serviceName := flag.String("serviceName", "", "Service name")
 	serviceURL := flag.String("serviceURL", "", "Service URL")
+	migrate := flag.Bool("migrate", false, "Create or update the database types, tables and columns")
+	importTokens := flag.Bool("importServiceTokens", false, "Move service tokens from redis to postgres")
+	makeAdminEmail := flag.String("makeAdmin", "", "Email of a user to make an admin")
 	flag.Parse()
 
 	if *gqlGen {
@@ -323,6 +448,18 @@ func main() {
 		createService(*serviceName, *serviceURL)
 		os.Exit(0)
 	}
+	if *migrate {
+		migrateDatabase()
+		os.Exit(0)
+	}
+	if *importTokens {
+		importServiceTokens()
+		os.Exit(0)
+	}
+	if *makeAdminEmail != "" {
+		makeAdmin(*makeAdminEmail)
+		os.Exit(0)
+	}
 	usage()
 	os.Exit(1)
 }
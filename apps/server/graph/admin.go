@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/graph/model"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	utils "github.com/bananocoin/boompow/libs/utils/format"
+	"github.com/bananocoin/boompow/libs/utils/number"
+	"github.com/google/uuid"
+)
+
+// Convert in-flight requests to what we return from the admin API
+func pendingRequestsResponse(snapshot []models.InFlightSnapshot, now time.Time) []*model.PendingRequest {
+	pending := make([]*model.PendingRequest, 0, len(snapshot))
+	for _, request := range snapshot {
+		response := &model.PendingRequest{
+			RequestID:            request.RequestID,
+			Hash:                 request.Hash,
+			Requester:            request.RequesterEmail,
+			Difficulty:           request.Difficulty.String(),
+			DifficultyMultiplier: request.DifficultyMultiplier,
+			Precache:             request.Precache,
+			Priority:             string(request.Priority),
+			CreatedAt:            utils.GenerateISOString(request.CreatedAt),
+			AgeMs:                int(now.Sub(request.CreatedAt).Milliseconds()),
+			ExpiresInMs:          int(request.Deadline.Sub(now).Milliseconds()),
+			WorkersAsked:         request.WorkersAsked,
+		}
+		if request.Network != "" {
+			network := request.Network
+			response.Network = &network
+		}
+		pending = append(pending, response)
+	}
+	return pending
+}
+
+// Most rows the admin API returns at once
+const maxAdminPageSize = 500
+
+// The page an admin asked for, 50 rows if they didn't say
+func adminPage(limit *int, offset *int) (int, int, error) {
+	pageLimit, pageOffset := 50, 0
+	if limit != nil {
+		pageLimit = *limit
+	}
+	if offset != nil {
+		pageOffset = *offset
+	}
+	if pageLimit < 1 || pageLimit > maxAdminPageSize || pageOffset < 0 {
+		return 0, 0, fmt.Errorf("bad_request:limit must be between 1 and %d and offset can't be negative", maxAdminPageSize)
+	}
+	return pageLimit, pageOffset, nil
+}
+
+// Find the user an admin is asking about
+func (r *Resolver) userByEmail(email string) (*models.User, error) {
+	lower := strings.ToLower(email)
+	user, err := r.UserRepo.GetUser(nil, &lower)
+	if err != nil {
+		return nil, errors.New("not_found:unknown user")
+	}
+	return user, nil
+}
+
+// The audit log of what an admin did, saved along with the change
+func adminAudit(admin *models.User, action models.AuditAction, reason *string) *repository.AuditEntry {
+	entry := &repository.AuditEntry{ActorID: &admin.ID, Action: action}
+	if reason != nil {
+		entry.Reason = *reason
+	}
+	return entry
+}
+
+// Convert a user to what we return from the admin API
+func adminUserResponse(user *models.User) *model.AdminUser {
+	response := &model.AdminUser{
+		ID:                 user.ID.String(),
+		Email:              user.Email,
+		Type:               model.UserType(user.Type),
+		CreatedAt:          utils.GenerateISOString(user.CreatedAt),
+		EmailVerified:      user.EmailVerified,
+		BanAddress:         user.BanAddress,
+		ServiceName:        user.ServiceName,
+		ServiceWebsite:     user.ServiceWebsite,
+		CanRequestWork:     user.CanRequestWork,
+		Banned:             user.Banned,
+		RewardsExcluded:    user.RewardsExcluded,
+		InvalidResultCount: user.InvalidResultCount,
+	}
+	if user.Type == models.REQUESTER {
+		response.Quota = serviceQuotaResponse(user.Quota)
+	}
+	return response
+}
+
+// Convert work a user provided or requested to what we return from the admin API
+func adminWorkResultResponse(result *models.WorkResult, userID uuid.UUID) *model.AdminWorkResult {
+	response := &model.AdminWorkResult{
+		Hash:                 result.Hash,
+		Difficulty:           result.Difficulty.String(),
+		DifficultyMultiplier: result.DifficultyMultiplier,
+		Result:               result.Result,
+		Provided:             result.ProvidedBy == userID,
+		Awarded:              result.Awarded,
+		Precache:             result.Precache,
+		CreatedAt:            utils.GenerateISOString(result.CreatedAt),
+	}
+	if result.Network != "" {
+		network := result.Network
+		response.Network = &network
+	}
+	return response
+}
+
+// Convert a payment to what we return from the admin API
+func adminPaymentResponse(payment *models.Payment) (*model.AdminPayment, error) {
+	amount, err := number.RawToBanano(payment.SendJson.AmountRaw, false)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AdminPayment{
+		ID:        payment.ID.String(),
+		SendID:    payment.SendId,
+		Amount:    amount,
+		BlockHash: payment.BlockHash,
+		CreatedAt: utils.GenerateISOString(payment.CreatedAt),
+	}, nil
+}
+
+func auditLogResponse(log *models.AuditLog) *model.AuditLog {
+	response := &model.AuditLog{
+		ID:        log.ID.String(),
+		UserID:    log.UserID.String(),
+		Action:    string(log.Action),
+		Reason:    log.Reason,
+		CreatedAt: utils.GenerateISOString(log.CreatedAt),
+	}
+	if log.ActorID != nil {
+		actorID := log.ActorID.String()
+		response.ActorID = &actorID
+	}
+	return response
+}
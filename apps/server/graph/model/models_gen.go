@@ -8,18 +8,82 @@ import (
 	"strconv"
 )
 
+type AdminActionInput struct {
+	Email  string  `json:"email"`
+	Reason *string `json:"reason"`
+}
+
+type AdminPayment struct {
+	ID        string  `json:"id"`
+	SendID    string  `json:"sendId"`
+	Amount    float64 `json:"amount"`
+	BlockHash *string `json:"blockHash"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+type AdminUser struct {
+	ID                 string        `json:"id"`
+	Email              string        `json:"email"`
+	Type               UserType      `json:"type"`
+	CreatedAt          string        `json:"createdAt"`
+	EmailVerified      bool          `json:"emailVerified"`
+	BanAddress         *string       `json:"banAddress"`
+	ServiceName        *string       `json:"serviceName"`
+	ServiceWebsite     *string       `json:"serviceWebsite"`
+	CanRequestWork     bool          `json:"canRequestWork"`
+	Banned             bool          `json:"banned"`
+	RewardsExcluded    bool          `json:"rewardsExcluded"`
+	InvalidResultCount int           `json:"invalidResultCount"`
+	Quota              *ServiceQuota `json:"quota"`
+}
+
+type AdminWorkResult struct {
+	Hash                 string  `json:"hash"`
+	Difficulty           string  `json:"difficulty"`
+	DifficultyMultiplier int     `json:"difficultyMultiplier"`
+	Network              *string `json:"network"`
+	Result               string  `json:"result"`
+	Provided             bool    `json:"provided"`
+	Awarded              bool    `json:"awarded"`
+	Precache             bool    `json:"precache"`
+	CreatedAt            string  `json:"createdAt"`
+}
+
+type AuditLog struct {
+	ID        string  `json:"id"`
+	UserID    string  `json:"userId"`
+	ActorID   *string `json:"actorId"`
+	Action    string  `json:"action"`
+	Reason    string  `json:"reason"`
+	CreatedAt string  `json:"createdAt"`
+}
+
 type ChangePasswordInput struct {
 	NewPassword string `json:"newPassword"`
 }
 
+type CreateServiceTokenInput struct {
+	Name          string `json:"name"`
+	ExpiresInDays *int   `json:"expiresInDays"`
+}
+
+type CreateServiceTokenResponse struct {
+	Token        string        `json:"token"`
+	ServiceToken *ServiceToken `json:"serviceToken"`
+}
+
 type GetUserResponse struct {
-	Email          string   `json:"email"`
-	Type           UserType `json:"type"`
-	BanAddress     *string  `json:"banAddress"`
-	ServiceName    *string  `json:"serviceName"`
-	ServiceWebsite *string  `json:"serviceWebsite"`
-	EmailVerified  bool     `json:"emailVerified"`
-	CanRequestWork bool     `json:"canRequestWork"`
+	Email          string        `json:"email"`
+	Type           UserType      `json:"type"`
+	BanAddress     *string       `json:"banAddress"`
+	ServiceName    *string       `json:"serviceName"`
+	ServiceWebsite *string       `json:"serviceWebsite"`
+	EmailVerified  bool          `json:"emailVerified"`
+	CanRequestWork bool          `json:"canRequestWork"`
+	WebhookURL     *string       `json:"webhookUrl"`
+	WebhookSecret  *string       `json:"webhookSecret"`
+	Quota          *ServiceQuota `json:"quota"`
+	Usage          *QuotaUsage   `json:"usage"`
 }
 
 type LoginInput struct {
@@ -37,6 +101,35 @@ type LoginResponse struct {
 	EmailVerified  bool     `json:"emailVerified"`
 }
 
+type PendingRequest struct {
+	RequestID            string  `json:"requestId"`
+	Hash                 string  `json:"hash"`
+	Requester            string  `json:"requester"`
+	Difficulty           string  `json:"difficulty"`
+	DifficultyMultiplier int     `json:"difficultyMultiplier"`
+	Network              *string `json:"network"`
+	Precache             bool    `json:"precache"`
+	Priority             string  `json:"priority"`
+	CreatedAt            string  `json:"createdAt"`
+	AgeMs                int     `json:"ageMs"`
+	ExpiresInMs          int     `json:"expiresInMs"`
+	WorkersAsked         int     `json:"workersAsked"`
+}
+
+type PrecacheStats struct {
+	Entries int `json:"entries"`
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+	Expired int `json:"expired"`
+	Evicted int `json:"evicted"`
+}
+
+type QuotaUsage struct {
+	RequestsThisMinute int `json:"requestsThisMinute"`
+	RequestsToday      int `json:"requestsToday"`
+	InFlight           int `json:"inFlight"`
+}
+
 type RefreshTokenInput struct {
 	Token string `json:"token"`
 }
@@ -49,18 +142,60 @@ type ResetPasswordInput struct {
 	Email string `json:"email"`
 }
 
+type ServiceQuota struct {
+	RequestsPerMinute *int    `json:"requestsPerMinute"`
+	RequestsPerDay    *int    `json:"requestsPerDay"`
+	MaxInFlight       *int    `json:"maxInFlight"`
+	MaxDifficulty     *string `json:"maxDifficulty"`
+}
+
+type ServiceToken struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Prefix     string  `json:"prefix"`
+	CreatedAt  string  `json:"createdAt"`
+	LastUsedAt *string `json:"lastUsedAt"`
+	ExpiresAt  *string `json:"expiresAt"`
+	RevokedAt  *string `json:"revokedAt"`
+}
+
+type SetRewardsExcludedInput struct {
+	Email    string  `json:"email"`
+	Excluded bool    `json:"excluded"`
+	Reason   *string `json:"reason"`
+}
+
+type SetServiceQuotaInput struct {
+	Email             string  `json:"email"`
+	RequestsPerMinute *int    `json:"requestsPerMinute"`
+	RequestsPerDay    *int    `json:"requestsPerDay"`
+	MaxInFlight       *int    `json:"maxInFlight"`
+	MaxDifficulty     *string `json:"maxDifficulty"`
+}
+
+type SetWebhookURLInput struct {
+	URL *string `json:"url"`
+}
+
 type Stats struct {
 	ConnectedWorkers       int                 `json:"connectedWorkers"`
 	TotalPaidBanano        string              `json:"totalPaidBanano"`
 	RegisteredServiceCount int                 `json:"registeredServiceCount"`
 	Top10                  []*StatsUserType    `json:"top10"`
 	Services               []*StatsServiceType `json:"services"`
+	LastUpdatedAt          *string             `json:"lastUpdatedAt"`
+	CacheHits              int                 `json:"cacheHits"`
+	Coalesced              int                 `json:"coalesced"`
+	Precache               *PrecacheStats      `json:"precache"`
 }
 
 type StatsServiceType struct {
-	Name     string `json:"name"`
-	Website  string `json:"website"`
-	Requests int    `json:"requests"`
+	Name      string         `json:"name"`
+	Website   string         `json:"website"`
+	Requests  int            `json:"requests"`
+	CacheHits int            `json:"cacheHits"`
+	Coalesced int            `json:"coalesced"`
+	Precache  *PrecacheStats `json:"precache"`
 }
 
 type StatsUserType struct {
@@ -77,6 +212,12 @@ type User struct {
 	BanAddress *string  `json:"banAddress"`
 }
 
+type UserHistoryInput struct {
+	Email  string `json:"email"`
+	Limit  *int   `json:"limit"`
+	Offset *int   `json:"offset"`
+}
+
 type UserInput struct {
 	Email          string   `json:"email"`
 	Password       string   `json:"password"`
@@ -86,6 +227,13 @@ type UserInput struct {
 	ServiceWebsite *string  `json:"serviceWebsite"`
 }
 
+type UsersInput struct {
+	Search *string   `json:"search"`
+	Type   *UserType `json:"type"`
+	Limit  *int      `json:"limit"`
+	Offset *int      `json:"offset"`
+}
+
 type VerifyEmailInput struct {
 	Email string `json:"email"`
 	Token string `json:"token"`
@@ -97,9 +245,64 @@ type VerifyServiceInput struct {
 }
 
 type WorkGenerateInput struct {
-	Hash                 string `json:"hash"`
-	DifficultyMultiplier int    `json:"difficultyMultiplier"`
-	BlockAward           *bool  `json:"blockAward"`
+	Hash                 string  `json:"hash"`
+	DifficultyMultiplier *int    `json:"difficultyMultiplier"`
+	Difficulty           *string `json:"difficulty"`
+	BlockAward           *bool   `json:"blockAward"`
+	Network              *string `json:"network"`
+}
+
+type WorkStatusInput struct {
+	RequestID string `json:"requestId"`
+}
+
+type WorkStatusResponse struct {
+	RequestID            string     `json:"requestId"`
+	Hash                 string     `json:"hash"`
+	DifficultyMultiplier int        `json:"difficultyMultiplier"`
+	Difficulty           string     `json:"difficulty"`
+	Status               WorkStatus `json:"status"`
+	Result               *string    `json:"result"`
+	Error                *string    `json:"error"`
+	CreatedAt            string     `json:"createdAt"`
+	CompletedAt          *string    `json:"completedAt"`
+}
+
+type WorkerReportInput struct {
+	Days    *int               `json:"days"`
+	OrderBy *WorkerReportOrder `json:"orderBy"`
+	Limit   *int               `json:"limit"`
+}
+
+type WorkerSession struct {
+	ID             string  `json:"id"`
+	Rig            string  `json:"rig"`
+	IPAddress      string  `json:"ipAddress"`
+	ClientVersion  *string `json:"clientVersion"`
+	ConnectedAt    string  `json:"connectedAt"`
+	DisconnectedAt *string `json:"disconnectedAt"`
+	UptimeSeconds  int     `json:"uptimeSeconds"`
+	RequestsSent   int     `json:"requestsSent"`
+	RequestsWon    int     `json:"requestsWon"`
+	InvalidResults int     `json:"invalidResults"`
+	WinRate        float64 `json:"winRate"`
+	AvgSolveMs     *int    `json:"avgSolveMs"`
+}
+
+type WorkerSessionSummary struct {
+	Email          *string `json:"email"`
+	Sessions       int     `json:"sessions"`
+	UptimeSeconds  int     `json:"uptimeSeconds"`
+	RequestsSent   int     `json:"requestsSent"`
+	RequestsWon    int     `json:"requestsWon"`
+	InvalidResults int     `json:"invalidResults"`
+	WinRate        float64 `json:"winRate"`
+	AvgSolveMs     *int    `json:"avgSolveMs"`
+}
+
+type WorkerSessionsInput struct {
+	Limit  *int `json:"limit"`
+	Offset *int `json:"offset"`
 }
 
 type UserType string
@@ -107,16 +310,18 @@ type UserType string
 const (
 	UserTypeProvider  UserType = "PROVIDER"
 	UserTypeRequester UserType = "REQUESTER"
+	UserTypeAdmin     UserType = "ADMIN"
 )
 
 var AllUserType = []UserType{
 	UserTypeProvider,
 	UserTypeRequester,
+	UserTypeAdmin,
 }
 
 func (e UserType) IsValid() bool {
 	switch e {
-	case UserTypeProvider, UserTypeRequester:
+	case UserTypeProvider, UserTypeRequester, UserTypeAdmin:
 		return true
 	}
 	return false
@@ -142,3 +347,91 @@ func (e *UserType) UnmarshalGQL(v interface{}) error {
 func (e UserType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type WorkStatus string
+
+const (
+	WorkStatusPending   WorkStatus = "PENDING"
+	WorkStatusCompleted WorkStatus = "COMPLETED"
+	WorkStatusFailed    WorkStatus = "FAILED"
+)
+
+var AllWorkStatus = []WorkStatus{
+	WorkStatusPending,
+	WorkStatusCompleted,
+	WorkStatusFailed,
+}
+
+func (e WorkStatus) IsValid() bool {
+	switch e {
+	case WorkStatusPending, WorkStatusCompleted, WorkStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e WorkStatus) String() string {
+	return string(e)
+}
+
+func (e *WorkStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WorkStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WorkStatus", str)
+	}
+	return nil
+}
+
+func (e WorkStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type WorkerReportOrder string
+
+const (
+	WorkerReportOrderInvalidResults WorkerReportOrder = "INVALID_RESULTS"
+	WorkerReportOrderWinRate        WorkerReportOrder = "WIN_RATE"
+	WorkerReportOrderRequestsWon    WorkerReportOrder = "REQUESTS_WON"
+	WorkerReportOrderUptime         WorkerReportOrder = "UPTIME"
+)
+
+var AllWorkerReportOrder = []WorkerReportOrder{
+	WorkerReportOrderInvalidResults,
+	WorkerReportOrderWinRate,
+	WorkerReportOrderRequestsWon,
+	WorkerReportOrderUptime,
+}
+
+func (e WorkerReportOrder) IsValid() bool {
+	switch e {
+	case WorkerReportOrderInvalidResults, WorkerReportOrderWinRate, WorkerReportOrderRequestsWon, WorkerReportOrderUptime:
+		return true
+	}
+	return false
+}
+
+func (e WorkerReportOrder) String() string {
+	return string(e)
+}
+
+func (e *WorkerReportOrder) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WorkerReportOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WorkerReportOrder", str)
+	}
+	return nil
+}
+
+func (e WorkerReportOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
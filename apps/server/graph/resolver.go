@@ -1,8 +1,7 @@
 package graph
 
 import (
-	"sync"
-
+	"github.com/bananocoin/boompow/apps/server/src/controller"
 	"github.com/bananocoin/boompow/apps/server/src/repository"
 )
 
@@ -11,8 +10,11 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	UserRepo    repository.UserRepo
-	WorkRepo    repository.WorkRepo
-	PaymentRepo repository.PaymentRepo
-	PrecacheMap *sync.Map
+	UserRepo          repository.UserRepo
+	WorkRepo          repository.WorkRepo
+	PaymentRepo       repository.PaymentRepo
+	TokenRepo         repository.ServiceTokenRepo
+	AuditRepo         repository.AuditRepo
+	WorkerSessionRepo repository.WorkerSessionRepo
+	WorkRequester     *controller.WorkRequester
 }
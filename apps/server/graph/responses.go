@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/bananocoin/boompow/apps/server/graph/model"
+	"github.com/bananocoin/boompow/apps/server/src/controller"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/format"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Convert the status of an asynchronous work request to what we return from the API
+func workStatusResponse(status *models.WorkRequestStatus) *model.WorkStatusResponse {
+	response := &model.WorkStatusResponse{
+		RequestID:            status.RequestID,
+		Hash:                 status.Hash,
+		DifficultyMultiplier: status.DifficultyMultiplier,
+		Difficulty:           status.Difficulty.String(),
+		Status:               model.WorkStatus(status.Status),
+		CreatedAt:            utils.GenerateISOString(status.CreatedAt),
+	}
+	if status.Result != "" {
+		response.Result = &status.Result
+	}
+	if status.Error != "" {
+		response.Error = &status.Error
+	}
+	if status.CompletedAt != nil {
+		completedAt := utils.GenerateISOString(*status.CompletedAt)
+		response.CompletedAt = &completedAt
+	}
+	return response
+}
+
+// The network a work request is for, empty if it didn't say
+func inputNetwork(input model.WorkGenerateInput) string {
+	if input.Network == nil {
+		return ""
+	}
+	return *input.Network
+}
+
+// The difficulty a work request asks for, absolute difficulty wins over the multiplier
+func inputDifficulty(input model.WorkGenerateInput) (serializableModels.Difficulty, error) {
+	if input.Difficulty != nil && *input.Difficulty != "" {
+		difficulty, err := serializableModels.ParseDifficulty(*input.Difficulty)
+		if err != nil {
+			return 0, errors.New("bad_request:invalid difficulty")
+		}
+		return difficulty, nil
+	}
+	if input.DifficultyMultiplier != nil {
+		return serializableModels.DifficultyFromMultiplier(float64(*input.DifficultyMultiplier)), nil
+	}
+	return serializableModels.DifficultyFromMultiplier(1), nil
+}
+
+// ErrorPresenter adds a machine readable code to errors clients are expected to handle
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	presented := graphql.DefaultErrorPresenter(ctx, err)
+	var quotaErr *controller.QuotaError
+	if errors.As(err, &quotaErr) {
+		presented.Extensions = map[string]interface{}{
+			"code":              "QUOTA_EXCEEDED",
+			"limit":             quotaErr.Limit,
+			"max":               quotaErr.Max,
+			"retryAfterSeconds": int(math.Ceil(quotaErr.RetryAfter.Seconds())),
+		}
+	}
+	return presented
+}
+
+// Convert a service's quota to what we return from the API, unlimited is null
+func serviceQuotaResponse(quota models.ServiceQuota) *model.ServiceQuota {
+	response := &model.ServiceQuota{}
+	if quota.RequestsPerMinute > 0 {
+		response.RequestsPerMinute = &quota.RequestsPerMinute
+	}
+	if quota.RequestsPerDay > 0 {
+		response.RequestsPerDay = &quota.RequestsPerDay
+	}
+	if quota.MaxInFlight > 0 {
+		response.MaxInFlight = &quota.MaxInFlight
+	}
+	if quota.MaxDifficulty != 0 {
+		maxDifficulty := quota.MaxDifficulty.String()
+		response.MaxDifficulty = &maxDifficulty
+	}
+	return response
+}
+
+// The quota an admin asked for, missing limits are unlimited
+func quotaFromInput(input model.SetServiceQuotaInput) (models.ServiceQuota, error) {
+	quota := models.ServiceQuota{}
+	var err error
+	if quota.RequestsPerMinute, err = quotaLimit(input.RequestsPerMinute); err != nil {
+		return quota, err
+	}
+	if quota.RequestsPerDay, err = quotaLimit(input.RequestsPerDay); err != nil {
+		return quota, err
+	}
+	if quota.MaxInFlight, err = quotaLimit(input.MaxInFlight); err != nil {
+		return quota, err
+	}
+	if input.MaxDifficulty != nil && *input.MaxDifficulty != "" {
+		maxDifficulty, err := serializableModels.ParseDifficulty(*input.MaxDifficulty)
+		if err != nil {
+			return quota, errors.New("bad_request:invalid difficulty")
+		}
+		quota.MaxDifficulty = maxDifficulty
+	}
+	return quota, nil
+}
+
+// A single limit an admin asked for, zero (unlimited) if they didn't say
+func quotaLimit(input *int) (int, error) {
+	if input == nil {
+		return 0, nil
+	}
+	if *input < 0 {
+		return 0, errors.New("bad_request:limits can't be negative")
+	}
+	return *input, nil
+}
+
+// Convert a service token to what we return from the API, without its hash
+func serviceTokenResponse(serviceToken *models.ServiceToken) *model.ServiceToken {
+	return &model.ServiceToken{
+		ID:         serviceToken.ID.String(),
+		Name:       serviceToken.Name,
+		Prefix:     serviceToken.Prefix,
+		CreatedAt:  utils.GenerateISOString(serviceToken.CreatedAt),
+		LastUsedAt: optionalISOString(serviceToken.LastUsedAt),
+		ExpiresAt:  optionalISOString(serviceToken.ExpiresAt),
+		RevokedAt:  optionalISOString(serviceToken.RevokedAt),
+	}
+}
+
+// Format an optional timestamp for the API, null if it isn't set
+func optionalISOString(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := utils.GenerateISOString(*t)
+	return &formatted
+}
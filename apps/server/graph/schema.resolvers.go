@@ -6,7 +6,6 @@ package graph
 
 import (
 	"context"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -14,12 +13,11 @@ import (
 
 	"github.com/bananocoin/boompow/apps/server/graph/generated"
 	"github.com/bananocoin/boompow/apps/server/graph/model"
-	"github.com/bananocoin/boompow/apps/server/src/config"
 	"github.com/bananocoin/boompow/apps/server/src/controller"
 	"github.com/bananocoin/boompow/apps/server/src/database"
 	"github.com/bananocoin/boompow/apps/server/src/middleware"
 	"github.com/bananocoin/boompow/apps/server/src/models"
-	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
 	env "github.com/bananocoin/boompow/libs/utils"
 	"github.com/bananocoin/boompow/libs/utils/auth"
 	utils "github.com/bananocoin/boompow/libs/utils/format"
@@ -50,11 +48,12 @@ func (r *mutationResolver) CreateUser(ctx context.Context, input model.UserInput
 // Login is the resolver for the login field.
 func (r *mutationResolver) Login(ctx context.Context, input model.LoginInput) (*model.LoginResponse, error) {
 	input.Email = strings.ToLower(input.Email)
-	if !slices.Contains(env.GetAllowedEmails(), input.Email) {
+	user := r.UserRepo.Authenticate(&input)
+	// Admins and approved services don't need to be on the list
+	allowed := slices.Contains(env.GetAllowedEmails(), input.Email) || (user != nil && (user.Type == models.ADMIN || (user.Type == models.REQUESTER && user.CanRequestWork)))
+	if !allowed {
 		return nil, errors.New("access denied")
 	}
-
-	user := r.UserRepo.Authenticate(&input)
 	if user == nil {
 		return nil, errors.New("invalid email or password")
 	}
@@ -94,47 +93,64 @@ func (r *mutationResolver) WorkGenerate(ctx context.Context, input model.WorkGen
 		return "", fmt.Errorf("access denied")
 	}
 
-	// Check that this request is valid
-	_, err := hex.DecodeString(input.Hash)
-	if err != nil || len(input.Hash) != 64 {
-		return "", errors.New("bad_request:invalid hash")
+	difficulty, err := inputDifficulty(input)
+	if err != nil {
+		return "", err
 	}
 
-	// Alter our difficulty to be in a valid range if it isn't
-	if input.DifficultyMultiplier < 1 {
-		// 1 is NANO receive and banano base difficulty
-		input.DifficultyMultiplier = 1
-	} else if input.DifficultyMultiplier > config.MAX_WORK_DIFFICULTY_MULTIPLIER {
-		input.DifficultyMultiplier = config.MAX_WORK_DIFFICULTY_MULTIPLIER
+	// Work requested from no_reward addresses isn't rewarded
+	blockAward := (input.BlockAward == nil || *input.BlockAward) && !middleware.IPNoReward(ctx)
+	return r.WorkRequester.RequestWork(requester.User, input.Hash, difficulty, inputNetwork(input), blockAward)
+}
+
+// WorkGenerateAsync is the resolver for the workGenerateAsync field.
+func (r *mutationResolver) WorkGenerateAsync(ctx context.Context, input model.WorkGenerateInput) (string, error) {
+	// Require authentication for service
+	requester := middleware.AuthorizedServiceToken(ctx)
+	if requester == nil {
+		return "", fmt.Errorf("access denied")
 	}
 
-	// First try to retrieve from cache
-	// We only want cached results that meet the required difficulty
-	workResult, err := r.WorkRepo.RetrieveWorkFromCache(input.Hash, input.DifficultyMultiplier)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	difficulty, err := inputDifficulty(input)
+	if err != nil {
 		return "", err
 	}
-	if workResult != "" {
-		return workResult, nil
-	}
 
-	workRequest := serializableModels.ClientMessage{
-		RequesterEmail:       requester.User.Email,
-		BlockAward:           input.BlockAward == nil || *input.BlockAward,
-		MessageType:          serializableModels.WorkGenerate,
-		RequestID:            uuid.NewString(),
-		Hash:                 input.Hash,
-		DifficultyMultiplier: input.DifficultyMultiplier,
+	// Work requested from no_reward addresses isn't rewarded
+	blockAward := (input.BlockAward == nil || *input.BlockAward) && !middleware.IPNoReward(ctx)
+	return r.WorkRequester.RequestWorkAsync(requester.User, input.Hash, difficulty, inputNetwork(input), blockAward)
+}
+
+// SetWebhookURL is the resolver for the setWebhookUrl field.
+func (r *mutationResolver) SetWebhookURL(ctx context.Context, input model.SetWebhookURLInput) (bool, error) {
+	// Require authentication
+	requester := middleware.AuthorizedRequester(ctx)
+	if requester == nil {
+		return false, fmt.Errorf("access denied")
 	}
 
-	resp, err := controller.BroadcastWorkRequestAndWait(workRequest)
-	if err != nil {
-		return "", err
+	var webhookURL *string
+	if input.URL != nil && *input.URL != "" {
+		if err := controller.ValidateWebhookURL(*input.URL); err != nil {
+			return false, err
+		}
+		webhookURL = input.URL
 	}
+	if err := r.UserRepo.SetWebhookURL(requester.User.ID, webhookURL); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	r.PrecacheMap.Store(strings.ToUpper(input.Hash), resp.Result)
+// RotateWebhookSecret is the resolver for the rotateWebhookSecret field.
+func (r *mutationResolver) RotateWebhookSecret(ctx context.Context) (string, error) {
+	// Require authentication
+	requester := middleware.AuthorizedRequester(ctx)
+	if requester == nil {
+		return "", fmt.Errorf("access denied")
+	}
 
-	return resp.Result, nil
+	return r.UserRepo.RotateWebhookSecret(requester.User.ID)
 }
 
 // GenerateOrGetServiceToken is the resolver for the generateOrGetServiceToken field.
@@ -145,18 +161,92 @@ func (r *mutationResolver) GenerateOrGetServiceToken(ctx context.Context) (strin
 		return "", fmt.Errorf("access denied")
 	}
 
-	// Get token
-	token, err := database.GetRedisDB().GetServiceTokenForUser(requester.User.ID)
+	// We can't show tokens again, so this only works for services that don't have one yet
+	tokens, err := r.TokenRepo.GetServiceTokens(requester.User.ID)
+	if err != nil {
+		return "", err
+	}
+	for _, serviceToken := range tokens {
+		if serviceToken.Active(time.Now()) {
+			return "", errors.New("bad_request:service already has a token, use createServiceToken for another one")
+		}
+	}
+	token, _, err := r.TokenRepo.CreateServiceToken(requester.User.ID, "default", nil)
 	if err != nil {
-		// Generate token
-		token = r.UserRepo.GenerateServiceToken()
+		return "", fmt.Errorf("error generating token")
+	}
+	return token, nil
+}
 
-		if err := database.GetRedisDB().AddServiceToken(requester.User.ID, token); err != nil {
-			return "", fmt.Errorf("error generating token")
+// CreateServiceToken is the resolver for the createServiceToken field.
+func (r *mutationResolver) CreateServiceToken(ctx context.Context, input model.CreateServiceTokenInput) (*model.CreateServiceTokenResponse, error) {
+	// Require authentication
+	requester := middleware.AuthorizedRequester(ctx)
+	if requester == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays != nil {
+		if *input.ExpiresInDays <= 0 {
+			return nil, errors.New("bad_request:expiresInDays must be positive")
 		}
+		expiry := time.Now().UTC().AddDate(0, 0, *input.ExpiresInDays)
+		expiresAt = &expiry
+	}
+	token, serviceToken, err := r.TokenRepo.CreateServiceToken(requester.User.ID, input.Name, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &model.CreateServiceTokenResponse{
+		Token:        token,
+		ServiceToken: serviceTokenResponse(serviceToken),
+	}, nil
+}
+
+// RotateServiceToken is the resolver for the rotateServiceToken field.
+func (r *mutationResolver) RotateServiceToken(ctx context.Context, id string) (*model.CreateServiceTokenResponse, error) {
+	// Require authentication
+	requester := middleware.AuthorizedRequester(ctx)
+	if requester == nil {
+		return nil, fmt.Errorf("access denied")
 	}
 
-	return token, nil
+	tokenID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("not_found:unknown token")
+	}
+	token, serviceToken, err := r.TokenRepo.RotateServiceToken(requester.User.ID, tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("not_found:unknown token")
+	} else if err != nil {
+		return nil, err
+	}
+	return &model.CreateServiceTokenResponse{
+		Token:        token,
+		ServiceToken: serviceTokenResponse(serviceToken),
+	}, nil
+}
+
+// RevokeServiceToken is the resolver for the revokeServiceToken field.
+func (r *mutationResolver) RevokeServiceToken(ctx context.Context, id string) (*model.ServiceToken, error) {
+	// Require authentication
+	requester := middleware.AuthorizedRequester(ctx)
+	if requester == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	tokenID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("not_found:unknown token")
+	}
+	serviceToken, err := r.TokenRepo.RevokeServiceToken(requester.User.ID, tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("not_found:unknown token")
+	} else if err != nil {
+		return nil, err
+	}
+	return serviceTokenResponse(serviceToken), nil
 }
 
 // ResetPassword is the resolver for the resetPassword field.
@@ -227,6 +317,134 @@ func (r *mutationResolver) ChangePassword(ctx context.Context, input model.Chang
 	return false, err
 }
 
+// SetServiceQuota is the resolver for the setServiceQuota field.
+func (r *mutationResolver) SetServiceQuota(ctx context.Context, input model.SetServiceQuotaInput) (*model.ServiceQuota, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	quota, err := quotaFromInput(input)
+	if err != nil {
+		return nil, err
+	}
+	email := strings.ToLower(input.Email)
+	user, err := r.UserRepo.GetUser(nil, &email)
+	if err != nil {
+		return nil, errors.New("not_found:unknown user")
+	}
+	if user.Type != models.REQUESTER {
+		return nil, errors.New("bad_request:only services have quotas")
+	}
+	reason := fmt.Sprintf("%d per minute, %d per day, %d in flight, max difficulty %s", quota.RequestsPerMinute, quota.RequestsPerDay, quota.MaxInFlight, quota.MaxDifficulty.String())
+	if err := r.UserRepo.SetQuota(user.ID, quota, adminAudit(admin.User, models.AUDIT_QUOTA_SET, &reason)); err != nil {
+		return nil, err
+	}
+	return serviceQuotaResponse(quota), nil
+}
+
+// BanUser is the resolver for the banUser field.
+func (r *mutationResolver) BanUser(ctx context.Context, input model.AdminActionInput) (*model.AdminUser, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == admin.User.ID {
+		return nil, errors.New("bad_request:admins can't ban themselves")
+	}
+	if err := r.UserRepo.SetBanned(user.ID, true, adminAudit(admin.User, models.AUDIT_USER_BANNED, input.Reason)); err != nil {
+		return nil, err
+	}
+	user.Banned = true
+	if controller.ActiveHub != nil {
+		go controller.ActiveHub.DisconnectAccount(user.Email)
+	}
+	return adminUserResponse(user), nil
+}
+
+// UnbanUser is the resolver for the unbanUser field.
+func (r *mutationResolver) UnbanUser(ctx context.Context, input model.AdminActionInput) (*model.AdminUser, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	// The audit log keeps the count that was wiped
+	reason := fmt.Sprintf("invalid result count reset from %d", user.InvalidResultCount)
+	if input.Reason != nil && *input.Reason != "" {
+		reason = fmt.Sprintf("%s, %s", *input.Reason, reason)
+	}
+	if err := r.UserRepo.Unban(user.ID, adminAudit(admin.User, models.AUDIT_USER_UNBANNED, &reason)); err != nil {
+		return nil, err
+	}
+	user.Banned = false
+	user.InvalidResultCount = 0
+	return adminUserResponse(user), nil
+}
+
+// ApproveService is the resolver for the approveService field.
+func (r *mutationResolver) ApproveService(ctx context.Context, input model.AdminActionInput) (*model.AdminUser, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Type != models.REQUESTER {
+		return nil, errors.New("bad_request:only services can be approved")
+	}
+	if user.CanRequestWork {
+		return nil, errors.New("bad_request:service is already approved")
+	}
+	if err := r.UserRepo.SetCanRequestWork(user.ID, true, adminAudit(admin.User, models.AUDIT_SERVICE_APPROVED, input.Reason)); err != nil {
+		return nil, err
+	}
+	user.CanRequestWork = true
+	return adminUserResponse(user), nil
+}
+
+// SetRewardsExcluded is the resolver for the setRewardsExcluded field.
+func (r *mutationResolver) SetRewardsExcluded(ctx context.Context, input model.SetRewardsExcludedInput) (*model.AdminUser, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Type != models.REQUESTER {
+		return nil, errors.New("bad_request:only services can be excluded from rewards")
+	}
+	action := models.AUDIT_REWARDS_INCLUDED
+	if input.Excluded {
+		action = models.AUDIT_REWARDS_EXCLUDED
+	}
+	if err := r.UserRepo.SetRewardsExcluded(user.ID, input.Excluded, adminAudit(admin.User, action, input.Reason)); err != nil {
+		return nil, err
+	}
+	user.RewardsExcluded = input.Excluded
+	return adminUserResponse(user), nil
+}
+
 // VerifyEmail is the resolver for the verifyEmail field.
 func (r *queryResolver) VerifyEmail(ctx context.Context, input model.VerifyEmailInput) (bool, error) {
 	return false, errors.New("Email confirmation disabled")
@@ -246,7 +464,7 @@ func (r *queryResolver) GetUser(ctx context.Context) (*model.GetUserResponse, er
 	if user == nil {
 		return nil, fmt.Errorf("access denied")
 	}
-	return &model.GetUserResponse{
+	response := &model.GetUserResponse{
 		Type:           model.UserType(user.User.Type),
 		BanAddress:     user.User.BanAddress,
 		ServiceName:    user.User.ServiceName,
@@ -254,22 +472,366 @@ func (r *queryResolver) GetUser(ctx context.Context) (*model.GetUserResponse, er
 		EmailVerified:  user.User.EmailVerified,
 		Email:          user.User.Email,
 		CanRequestWork: user.User.CanRequestWork,
-	}, nil
+		WebhookURL:     user.User.WebhookURL,
+		WebhookSecret:  user.User.WebhookSecret,
+	}
+	if user.User.Type == models.REQUESTER {
+		response.Quota = serviceQuotaResponse(user.User.Quota)
+		usage, err := database.GetRedisDB().GetQuotaUsage(user.User.Email, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		response.Usage = &model.QuotaUsage{
+			RequestsThisMinute: usage.RequestsThisMinute,
+			RequestsToday:      usage.RequestsToday,
+			InFlight:           usage.InFlight,
+		}
+	}
+	return response, nil
 }
 
 // Stats is the resolver for the stats field.
 func (r *queryResolver) Stats(ctx context.Context) (*model.Stats, error) {
-	stats := models.GetStatsInstance().Stats
-	if stats == nil {
-		stats = &model.Stats{
-			ConnectedWorkers:       -1,
-			TotalPaidBanano:        "N/A",
-			RegisteredServiceCount: -1,
-			Top10:                  nil,
-			Services:               nil,
+	return models.GetStatsInstance().GetStats(), nil
+}
+
+// WorkStatus is the resolver for the workStatus field.
+func (r *queryResolver) WorkStatus(ctx context.Context, input model.WorkStatusInput) (*model.WorkStatusResponse, error) {
+	// Require authentication for service
+	requester := middleware.AuthorizedServiceToken(ctx)
+	if requester == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	status, err := r.WorkRequester.GetWorkStatus(requester.User, input.RequestID)
+	if err != nil {
+		return nil, errors.New("not_found:unknown or expired request")
+	}
+	return workStatusResponse(status), nil
+}
+
+// ServiceTokens is the resolver for the serviceTokens field.
+func (r *queryResolver) ServiceTokens(ctx context.Context) ([]*model.ServiceToken, error) {
+	// Require authentication
+	requester := middleware.AuthorizedRequester(ctx)
+	if requester == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	tokens, err := r.TokenRepo.GetServiceTokens(requester.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*model.ServiceToken, len(tokens))
+	for i := range tokens {
+		response[i] = serviceTokenResponse(&tokens[i])
+	}
+	return response, nil
+}
+
+// PendingRequests is the resolver for the pendingRequests field.
+func (r *queryResolver) PendingRequests(ctx context.Context) ([]*model.PendingRequest, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	return pendingRequestsResponse(controller.InFlightRequests.Snapshot(), time.Now()), nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, input *model.UsersInput) ([]*model.AdminUser, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	if input == nil {
+		input = &model.UsersInput{}
+	}
+	limit, offset, err := adminPage(input.Limit, input.Offset)
+	if err != nil {
+		return nil, err
+	}
+	filter := repository.UserFilter{
+		Limit:  limit,
+		Offset: offset,
+	}
+	if input.Search != nil {
+		filter.Search = *input.Search
+	}
+	if input.Type != nil {
+		filter.Type = models.UserType(*input.Type)
+	}
+	users, err := r.UserRepo.SearchUsers(filter)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*model.AdminUser, len(users))
+	for i := range users {
+		response[i] = adminUserResponse(&users[i])
+	}
+	return response, nil
+}
+
+// UserWorkHistory is the resolver for the userWorkHistory field.
+func (r *queryResolver) UserWorkHistory(ctx context.Context, input model.UserHistoryInput) ([]*model.AdminWorkResult, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	limit, offset, err := adminPage(input.Limit, input.Offset)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	results, err := r.WorkRepo.GetWorkHistory(user.ID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*model.AdminWorkResult, len(results))
+	for i := range results {
+		response[i] = adminWorkResultResponse(&results[i], user.ID)
+	}
+	return response, nil
+}
+
+// UserPayments is the resolver for the userPayments field.
+func (r *queryResolver) UserPayments(ctx context.Context, input model.UserHistoryInput) ([]*model.AdminPayment, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	limit, offset, err := adminPage(input.Limit, input.Offset)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := r.PaymentRepo.GetPaymentsForUser(user.ID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*model.AdminPayment, len(payments))
+	for i := range payments {
+		if response[i], err = adminPaymentResponse(&payments[i]); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// AuditLogs is the resolver for the auditLogs field.
+func (r *queryResolver) AuditLogs(ctx context.Context, email *string, limit *int) ([]*model.AuditLog, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	pageLimit, _, err := adminPage(limit, nil)
+	if err != nil {
+		return nil, err
+	}
+	var userID *uuid.UUID
+	if email != nil {
+		user, err := r.userByEmail(*email)
+		if err != nil {
+			return nil, err
+		}
+		userID = &user.ID
+	}
+	logs, err := r.AuditRepo.GetAuditLogs(userID, pageLimit)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*model.AuditLog, len(logs))
+	for i := range logs {
+		response[i] = auditLogResponse(&logs[i])
+	}
+	return response, nil
+}
+
+// WorkerSessions is the resolver for the workerSessions field.
+func (r *queryResolver) WorkerSessions(ctx context.Context, input *model.WorkerSessionsInput) ([]*model.WorkerSession, error) {
+	// Require authentication
+	provider := middleware.AuthorizedProvider(ctx)
+	if provider == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	if input == nil {
+		input = &model.WorkerSessionsInput{}
+	}
+	limit, offset, err := adminPage(input.Limit, input.Offset)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := r.WorkerSessionRepo.GetSessions(provider.User.ID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	response := make([]*model.WorkerSession, len(sessions))
+	for i := range sessions {
+		response[i] = workerSessionResponse(&sessions[i], now)
+	}
+	return response, nil
+}
+
+// WorkerSessionSummary is the resolver for the workerSessionSummary field.
+func (r *queryResolver) WorkerSessionSummary(ctx context.Context, days *int) (*model.WorkerSessionSummary, error) {
+	// Require authentication
+	provider := middleware.AuthorizedProvider(ctx)
+	if provider == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	since, err := workerSessionsSince(days, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	summary, err := r.WorkerSessionRepo.GetSessionSummary(provider.User.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	return workerSessionSummaryResponse(summary), nil
+}
+
+// UserWorkerSessions is the resolver for the userWorkerSessions field.
+func (r *queryResolver) UserWorkerSessions(ctx context.Context, input model.UserHistoryInput) ([]*model.WorkerSession, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	limit, offset, err := adminPage(input.Limit, input.Offset)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userByEmail(input.Email)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := r.WorkerSessionRepo.GetSessions(user.ID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	response := make([]*model.WorkerSession, len(sessions))
+	for i := range sessions {
+		response[i] = workerSessionResponse(&sessions[i], now)
+	}
+	return response, nil
+}
+
+// WorkerReport is the resolver for the workerReport field.
+func (r *queryResolver) WorkerReport(ctx context.Context, input *model.WorkerReportInput) ([]*model.WorkerSessionSummary, error) {
+	// Require authentication
+	admin := middleware.AuthorizedAdmin(ctx)
+	if admin == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	if input == nil {
+		input = &model.WorkerReportInput{}
+	}
+	limit, _, err := adminPage(input.Limit, nil)
+	if err != nil {
+		return nil, err
+	}
+	since, err := workerSessionsSince(input.Days, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	orderBy := repository.WorkerReportByInvalidResults
+	if input.OrderBy != nil {
+		switch *input.OrderBy {
+		case model.WorkerReportOrderWinRate:
+			orderBy = repository.WorkerReportByWinRate
+		case model.WorkerReportOrderRequestsWon:
+			orderBy = repository.WorkerReportByRequestsWon
+		case model.WorkerReportOrderUptime:
+			orderBy = repository.WorkerReportByUptime
 		}
 	}
-	return stats, nil
+	summaries, err := r.WorkerSessionRepo.GetWorkerReport(since, orderBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]*model.WorkerSessionSummary, len(summaries))
+	for i := range summaries {
+		response[i] = workerSessionSummaryResponse(&summaries[i])
+		response[i].Email = &summaries[i].Email
+	}
+	return response, nil
+}
+
+// Stats is the resolver for the stats field.
+func (r *subscriptionResolver) Stats(ctx context.Context) (<-chan *model.Stats, error) {
+	updates, unsubscribe := models.GetStatsInstance().Updates.Subscribe()
+	statsChan := make(chan *model.Stats, 1)
+	// Start with what we have now
+	statsChan <- models.GetStatsInstance().GetStats()
+	go func() {
+		defer close(statsChan)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case stats := <-updates:
+				select {
+				case statsChan <- stats:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return statsChan, nil
+}
+
+// WorkCompleted is the resolver for the workCompleted field.
+func (r *subscriptionResolver) WorkCompleted(ctx context.Context, requestIds []string) (<-chan *model.WorkStatusResponse, error) {
+	// Require authentication for service
+	requester := middleware.AuthorizedServiceToken(ctx)
+	if requester == nil {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	// Only this requester's completions come through, from whichever replica finished them
+	completions, err := r.WorkRequester.SubscribeCompletions(ctx, requester.User)
+	if err != nil {
+		return nil, err
+	}
+	statusChan := make(chan *model.WorkStatusResponse, 1)
+	go func() {
+		defer close(statusChan)
+		for status := range completions {
+			if len(requestIds) > 0 && !slices.Contains(requestIds, status.RequestID) {
+				continue
+			}
+			select {
+			case statusChan <- workStatusResponse(status):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return statusChan, nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
@@ -278,5 +840,9 @@ func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResol
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/graph/model"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	utils "github.com/bananocoin/boompow/libs/utils/format"
+)
+
+// How far back worker session summaries look if not asked, and at most
+const (
+	defaultWorkerSessionDays = 7
+	maxWorkerSessionDays     = 365
+)
+
+// When a worker session summary starts, from the days asked for
+func workerSessionsSince(days *int, now time.Time) (time.Time, error) {
+	summaryDays := defaultWorkerSessionDays
+	if days != nil {
+		summaryDays = *days
+	}
+	if summaryDays < 1 || summaryDays > maxWorkerSessionDays {
+		return time.Time{}, fmt.Errorf("bad_request:days must be between 1 and %d", maxWorkerSessionDays)
+	}
+	return now.AddDate(0, 0, -summaryDays), nil
+}
+
+// Requests won out of requests sent, and the average time to solve the ones won
+func workerPerformance(sent int64, won int64, solveTimeMs int64) (float64, *int) {
+	winRate := 0.0
+	if sent > 0 {
+		winRate = float64(won) / float64(sent)
+	}
+	if won == 0 {
+		return winRate, nil
+	}
+	avgSolveMs := int(solveTimeMs / won)
+	return winRate, &avgSolveMs
+}
+
+func workerSessionResponse(session *models.WorkerSession, now time.Time) *model.WorkerSession {
+	response := &model.WorkerSession{
+		ID:             session.ID.String(),
+		Rig:            session.Rig,
+		IPAddress:      session.IPAddress,
+		ConnectedAt:    utils.GenerateISOString(session.ConnectedAt),
+		UptimeSeconds:  int(session.Uptime(now).Seconds()),
+		RequestsSent:   int(session.RequestsSent),
+		RequestsWon:    int(session.RequestsWon),
+		InvalidResults: int(session.InvalidResults),
+	}
+	response.WinRate, response.AvgSolveMs = workerPerformance(session.RequestsSent, session.RequestsWon, session.SolveTimeMs)
+	if session.ClientVersion != "" {
+		response.ClientVersion = &session.ClientVersion
+	}
+	if session.DisconnectedAt != nil {
+		disconnectedAt := utils.GenerateISOString(*session.DisconnectedAt)
+		response.DisconnectedAt = &disconnectedAt
+	}
+	return response
+}
+
+func workerSessionSummaryResponse(summary *repository.WorkerSessionSummary) *model.WorkerSessionSummary {
+	response := &model.WorkerSessionSummary{
+		Sessions:       int(summary.Sessions),
+		UptimeSeconds:  int(summary.UptimeSeconds),
+		RequestsSent:   int(summary.RequestsSent),
+		RequestsWon:    int(summary.RequestsWon),
+		InvalidResults: int(summary.InvalidResults),
+	}
+	response.WinRate, response.AvgSolveMs = workerPerformance(summary.RequestsSent, summary.RequestsWon, summary.SolveTimeMs)
+	return response
+}
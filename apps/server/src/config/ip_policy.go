@@ -0,0 +1,391 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bananocoin/boompow/libs/utils"
+	"github.com/bananocoin/boompow/libs/utils/net"
+)
+
+// IPAction is what we do with requests from the addresses a rule matches
+type IPAction string
+
+const (
+	// Let them in, for carving exceptions out of wider rules
+	IPActionAllow IPAction = "allow"
+	// Refuse them
+	IPActionDeny IPAction = "deny"
+	// Let them in, but work they provide or request isn't rewarded
+	IPActionNoReward IPAction = "no_reward"
+	// Let them in, up to the rule's rate limit per address
+	IPActionRateLimit IPAction = "rate_limit"
+)
+
+// Where we look up the prefixes an autonomous system announces, %d is the AS number
+const defaultASNURL = "https://stat.ripe.net/data/announced-prefixes/data.json?resource=AS%d"
+
+// Lists bigger than this are cut off
+const maxIPListBytes = 16 << 20
+
+// IPRule is a set of address ranges and what to do with them
+type IPRule struct {
+	Name   string   `json:"name"`
+	Action IPAction `json:"action"`
+	// Requests per minute per address, for the rate_limit action
+	RateLimit int      `json:"rateLimit"`
+	CIDRs     []string `json:"cidrs"`
+	// Files and URLs with a CIDR or address on each line
+	Files []string `json:"files"`
+	URLs  []string `json:"urls"`
+	// Autonomous systems whose announced prefixes the rule covers, looked up with the policy's ASN URL
+	ASNs []int `json:"asns"`
+}
+
+// IPPolicyConfig is the rules we apply to worker and API requests by address
+// The most specific range containing an address decides, the first rule wins when two rules have the same range
+type IPPolicyConfig struct {
+	// Either RIPEstat's announced-prefixes JSON or a CIDR on each line, %d is the AS number
+	ASNURL string    `json:"asnUrl"`
+	Rules  []*IPRule `json:"rules"`
+}
+
+// IPDecision is what the policy says about an address
+type IPDecision struct {
+	// The rule that matched, empty if none did
+	Rule      string
+	Action    IPAction
+	RateLimit int
+}
+
+// IPPolicy is a loaded policy, the ranges of every rule are in one radix tree
+type IPPolicy struct {
+	tree *net.CIDRTree[*IPRule]
+}
+
+// Evaluate finds the rule for an address, addresses no rule matches are allowed
+func (p *IPPolicy) Evaluate(ip string) IPDecision {
+	addr, ok := net.ParseAddr(ip)
+	if !ok {
+		return IPDecision{Action: IPActionAllow}
+	}
+	rule, ok := p.tree.Lookup(addr)
+	if !ok {
+		return IPDecision{Action: IPActionAllow}
+	}
+	return IPDecision{Rule: rule.Name, Action: rule.Action, RateLimit: rule.RateLimit}
+}
+
+// Len is the number of ranges in the policy
+func (p *IPPolicy) Len() int {
+	return p.tree.Len()
+}
+
+// The Hetzner data centers we blocked before the policy was configurable
+func defaultIPPolicy() *IPPolicyConfig {
+	return &IPPolicyConfig{
+		ASNURL: defaultASNURL,
+		Rules: []*IPRule{
+			{
+				Name:   "hetzner",
+				Action: IPActionDeny,
+				CIDRs: []string{
+					"116.202.0.0/16",
+					"116.203.0.0/16",
+					"128.140.0.0/17",
+					"135.181.0.0/16",
+					"136.243.0.0/16",
+					"138.201.0.0/16",
+					"142.132.128.0/17",
+					"144.76.0.0/16",
+					"148.251.0.0/16",
+					"157.90.0.0/16",
+					"159.69.0.0/16",
+					"162.55.0.0/16",
+					"167.233.0.0/16",
+					"167.235.0.0/16",
+					"168.119.0.0/16",
+					"171.25.225.0/24",
+					"176.9.0.0/16",
+					"178.212.75.0/24",
+					"178.63.0.0/16",
+					"185.107.52.0/22",
+					"185.110.95.0/24",
+					"185.112.180.0/24",
+					"185.126.28.0/22",
+					"185.12.65.0/24",
+					"185.136.140.0/23",
+					"185.157.176.0/23",
+					"185.157.178.0/23",
+					"185.157.83.0/24",
+					"185.171.224.0/22",
+					"185.189.228.0/24",
+					"185.189.229.0/24",
+					"185.189.230.0/24",
+					"185.189.231.0/24",
+					"185.209.124.0/22",
+					"185.213.45.0/24",
+					"185.216.237.0/24",
+					"185.226.99.0/24",
+					"185.228.8.0/23",
+					"185.242.76.0/24",
+					"185.36.144.0/22",
+					"185.50.120.0/23",
+					"188.34.128.0/17",
+					"188.40.0.0/16",
+					"193.110.6.0/23",
+					"193.163.198.0/24",
+					"193.25.170.0/23",
+					"194.35.12.0/23",
+					"194.42.180.0/22",
+					"194.42.184.0/22",
+					"194.62.106.0/24",
+					"195.201.0.0/16",
+					"195.248.224.0/24",
+					"195.60.226.0/24",
+					"195.96.156.0/24",
+					"197.242.84.0/22",
+					"201.131.3.0/24",
+					"213.133.96.0/19",
+					"213.232.193.0/24",
+					"213.239.192.0/18",
+					"23.88.0.0/17",
+					"45.148.28.0/22",
+					"45.15.120.0/22",
+					"46.4.0.0/16",
+					"49.12.0.0/16",
+					"49.13.0.0/16",
+					"5.75.128.0/17",
+					"5.9.0.0/16",
+					"78.46.0.0/15",
+					"83.219.100.0/22",
+					"83.243.120.0/22",
+					"85.10.192.0/18",
+					"88.198.0.0/16",
+					"88.99.0.0/16",
+					"91.107.128.0/17",
+					"91.190.240.0/21",
+					"91.233.8.0/22",
+					"94.130.0.0/16",
+					"94.154.121.0/24",
+					"95.217.0.0/16",
+					"95.216.0.0/16",
+					"65.21.0.0/16",
+					"65.109.0.0/16",
+					"65.108.0.0/16",
+					"45.136.70.0/23",
+					"2a01:4f8::/32",
+					"2a01:4f9::/32",
+					"2a01:4ff:ff01::/48",
+					"2a01:b140::/29",
+					"2a06:1301:4050::/48",
+					"2a06:be80::/29",
+					"2a0e:2c80::/29",
+					"2a11:48c0::/29",
+					"2a11:e980::/29",
+					"2a12:e00::/29",
+				},
+			},
+		},
+	}
+}
+
+// ParseIPPolicy reads a JSON policy and checks that its rules make sense, it doesn't load any lists
+func ParseIPPolicy(data []byte) (*IPPolicyConfig, error) {
+	var parsed IPPolicyConfig
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	if parsed.ASNURL == "" {
+		parsed.ASNURL = defaultASNURL
+	}
+	seen := make(map[string]bool)
+	for _, rule := range parsed.Rules {
+		rule.Name = strings.TrimSpace(rule.Name)
+		if rule.Name == "" {
+			return nil, fmt.Errorf("ip rule name is required")
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("ip rule %s is configured more than once", rule.Name)
+		}
+		seen[rule.Name] = true
+		switch rule.Action {
+		case IPActionAllow, IPActionDeny, IPActionNoReward:
+		case IPActionRateLimit:
+			if rule.RateLimit <= 0 {
+				return nil, fmt.Errorf("ip rule %s needs a positive rate limit", rule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("ip rule %s has unknown action %q", rule.Name, rule.Action)
+		}
+		if len(rule.CIDRs)+len(rule.Files)+len(rule.URLs)+len(rule.ASNs) == 0 {
+			return nil, fmt.Errorf("ip rule %s has no cidrs, files, urls or asns", rule.Name)
+		}
+		for _, cidr := range rule.CIDRs {
+			if _, err := net.ParsePrefix(cidr); err != nil {
+				return nil, fmt.Errorf("ip rule %s: %w", rule.Name, err)
+			}
+		}
+		for _, asn := range rule.ASNs {
+			if asn <= 0 {
+				return nil, fmt.Errorf("ip rule %s has invalid asn %d", rule.Name, asn)
+			}
+		}
+		if len(rule.ASNs) > 0 && !strings.Contains(parsed.ASNURL, "%d") {
+			return nil, fmt.Errorf("asn url needs a %%d for the AS number")
+		}
+	}
+	return &parsed, nil
+}
+
+// Load from the JSON file in BPOW_IP_POLICY_FILE, or JSON in BPOW_IP_POLICY, or fall back to blocking Hetzner
+func loadIPPolicyConfig() (*IPPolicyConfig, error) {
+	if path := utils.GetEnv("BPOW_IP_POLICY_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseIPPolicy(data)
+	}
+	if raw := utils.GetEnv("BPOW_IP_POLICY", ""); raw != "" {
+		return ParseIPPolicy([]byte(raw))
+	}
+	return defaultIPPolicy(), nil
+}
+
+// BuildIPPolicy loads the ranges of every rule, it fails if any list can't be loaded
+func BuildIPPolicy(policyConfig *IPPolicyConfig, client *http.Client) (*IPPolicy, error) {
+	tree := net.NewCIDRTree[*IPRule]()
+	for _, rule := range policyConfig.Rules {
+		prefixes, err := loadIPRule(rule, policyConfig.ASNURL, client)
+		if err != nil {
+			return nil, fmt.Errorf("ip rule %s: %w", rule.Name, err)
+		}
+		for _, prefix := range prefixes {
+			tree.Insert(prefix, rule)
+		}
+	}
+	return &IPPolicy{tree: tree}, nil
+}
+
+func loadIPRule(rule *IPRule, asnURL string, client *http.Client) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, cidr := range rule.CIDRs {
+		prefix, err := net.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	for _, path := range rule.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		list, err := net.ParseCIDRList(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		prefixes = append(prefixes, list...)
+	}
+	for _, url := range rule.URLs {
+		data, err := fetchIPList(client, url)
+		if err != nil {
+			return nil, err
+		}
+		list, err := net.ParseCIDRList(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		prefixes = append(prefixes, list...)
+	}
+	for _, asn := range rule.ASNs {
+		url := fmt.Sprintf(asnURL, asn)
+		data, err := fetchIPList(client, url)
+		if err != nil {
+			return nil, err
+		}
+		list, err := parseASNPrefixes(data)
+		if err != nil {
+			return nil, fmt.Errorf("AS%d: %w", asn, err)
+		}
+		prefixes = append(prefixes, list...)
+	}
+	return prefixes, nil
+}
+
+func fetchIPList(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxIPListBytes))
+}
+
+// RIPEstat's announced-prefixes response, only what we need from it
+type announcedPrefixes struct {
+	Data struct {
+		Prefixes []struct {
+			Prefix string `json:"prefix"`
+		} `json:"prefixes"`
+	} `json:"data"`
+}
+
+// An ASN lookup is either RIPEstat JSON or a plain list
+func parseASNPrefixes(data []byte) ([]netip.Prefix, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(trimmed, "{") {
+		return net.ParseCIDRList(data)
+	}
+	var parsed announcedPrefixes
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	prefixes := make([]netip.Prefix, 0, len(parsed.Data.Prefixes))
+	for _, announced := range parsed.Data.Prefixes {
+		prefix, err := net.ParsePrefix(announced.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+var ipPolicy atomic.Pointer[IPPolicy]
+
+var ipPolicyClient = &http.Client{Timeout: 30 * time.Second}
+
+// ReloadIPPolicy reads the policy config and loads its lists again
+// If anything fails the policy we have stays in place
+func ReloadIPPolicy() error {
+	policyConfig, err := loadIPPolicyConfig()
+	if err != nil {
+		return err
+	}
+	policy, err := BuildIPPolicy(policyConfig, ipPolicyClient)
+	if err != nil {
+		return err
+	}
+	ipPolicy.Store(policy)
+	return nil
+}
+
+// GetIPPolicy returns the policy from the last successful load, one that allows everything before that
+func GetIPPolicy() *IPPolicy {
+	if policy := ipPolicy.Load(); policy != nil {
+		return policy
+	}
+	return &IPPolicy{tree: net.NewCIDRTree[*IPRule]()}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestParseIPPolicy(t *testing.T) {
+	policyConfig, err := ParseIPPolicy([]byte(`{"rules": [
+		{"name": "office", "action": "allow", "cidrs": ["95.216.77.0/24"]},
+		{"name": "cloud", "action": "rate_limit", "rateLimit": 5, "asns": [24940]}
+	]}`))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, defaultASNURL, policyConfig.ASNURL)
+	utils.AssertEqual(t, 2, len(policyConfig.Rules))
+	utils.AssertEqual(t, IPActionRateLimit, policyConfig.Rules[1].Action)
+	utils.AssertEqual(t, 5, policyConfig.Rules[1].RateLimit)
+}
+
+func TestParseIPPolicyInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"rules": [{"action": "deny", "cidrs": ["1.2.3.0/24"]}]}`,
+		`{"rules": [{"name": "a", "action": "deny", "cidrs": ["1.2.3.0/24"]}, {"name": "a", "action": "deny", "cidrs": ["1.2.4.0/24"]}]}`,
+		`{"rules": [{"name": "a", "action": "block", "cidrs": ["1.2.3.0/24"]}]}`,
+		`{"rules": [{"name": "a", "action": "rate_limit", "cidrs": ["1.2.3.0/24"]}]}`,
+		`{"rules": [{"name": "a", "action": "deny"}]}`,
+		`{"rules": [{"name": "a", "action": "deny", "cidrs": ["1.2.3.0/33"]}]}`,
+		`{"rules": [{"name": "a", "action": "deny", "asns": [-1]}]}`,
+		`{"asnUrl": "https://example.com/asn", "rules": [{"name": "a", "action": "deny", "asns": [24940]}]}`,
+	} {
+		_, err := ParseIPPolicy([]byte(raw))
+		if err == nil {
+			t.Errorf("Expected error parsing %s", raw)
+		}
+	}
+}
+
+func TestDefaultIPPolicy(t *testing.T) {
+	policy, err := BuildIPPolicy(defaultIPPolicy(), http.DefaultClient)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, IPDecision{Action: IPActionAllow}, policy.Evaluate("123.45.67.89"))
+	utils.AssertEqual(t, IPDecision{Rule: "hetzner", Action: IPActionDeny}, policy.Evaluate("95.216.77.23"))
+	utils.AssertEqual(t, IPDecision{Rule: "hetzner", Action: IPActionDeny}, policy.Evaluate("2a01:4f9:c010:780c::1"))
+	// Addresses with a port, as they come from RemoteAddr
+	utils.AssertEqual(t, IPActionDeny, policy.Evaluate("95.216.77.23:50000").Action)
+	utils.AssertEqual(t, IPActionAllow, policy.Evaluate("not-an-ip").Action)
+}
+
+func TestBuildIPPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vpn.txt":
+			fmt.Fprint(w, "# VPN exits\n10.1.0.0/16\n")
+		case "/asn/64500":
+			fmt.Fprint(w, `{"data": {"prefixes": [{"prefix": "10.0.0.0/8"}, {"prefix": "2001:db8::/32"}]}}`)
+		case "/asn/64501":
+			fmt.Fprint(w, "172.16.0.0/12\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cloud.txt")
+	utils.AssertEqual(t, nil, os.WriteFile(file, []byte("10.2.0.0/16 some cloud\n"), 0644))
+
+	policyConfig := &IPPolicyConfig{
+		ASNURL: server.URL + "/asn/%d",
+		Rules: []*IPRule{
+			{Name: "office", Action: IPActionAllow, CIDRs: []string{"10.0.1.0/24"}},
+			{Name: "vpn", Action: IPActionNoReward, URLs: []string{server.URL + "/vpn.txt"}},
+			{Name: "cloud", Action: IPActionRateLimit, RateLimit: 5, Files: []string{file}},
+			{Name: "datacenters", Action: IPActionDeny, ASNs: []int{64500, 64501}},
+		},
+	}
+	policy, err := BuildIPPolicy(policyConfig, server.Client())
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 6, policy.Len())
+
+	// The most specific range decides
+	utils.AssertEqual(t, IPDecision{Rule: "datacenters", Action: IPActionDeny}, policy.Evaluate("10.9.9.9"))
+	utils.AssertEqual(t, IPDecision{Rule: "office", Action: IPActionAllow}, policy.Evaluate("10.0.1.5"))
+	utils.AssertEqual(t, IPDecision{Rule: "vpn", Action: IPActionNoReward}, policy.Evaluate("10.1.2.3"))
+	utils.AssertEqual(t, IPDecision{Rule: "cloud", Action: IPActionRateLimit, RateLimit: 5}, policy.Evaluate("10.2.2.3"))
+	utils.AssertEqual(t, IPActionDeny, policy.Evaluate("172.20.0.1").Action)
+	utils.AssertEqual(t, IPActionDeny, policy.Evaluate("2001:db8::1").Action)
+	utils.AssertEqual(t, IPDecision{Action: IPActionAllow}, policy.Evaluate("192.168.1.1"))
+
+	// A list that can't be loaded fails the whole policy
+	policyConfig.Rules = append(policyConfig.Rules, &IPRule{Name: "missing", Action: IPActionDeny, URLs: []string{server.URL + "/missing.txt"}})
+	_, err = BuildIPPolicy(policyConfig, server.Client())
+	if err == nil {
+		t.Errorf("Expected error loading a missing list")
+	}
+}
+
+func TestReloadIPPolicy(t *testing.T) {
+	os.Setenv("BPOW_IP_POLICY", `{"rules": [{"name": "test", "action": "deny", "cidrs": ["203.0.113.0/24"]}]}`)
+	defer os.Unsetenv("BPOW_IP_POLICY")
+	utils.AssertEqual(t, nil, ReloadIPPolicy())
+	utils.AssertEqual(t, IPActionDeny, GetIPPolicy().Evaluate("203.0.113.7").Action)
+
+	// A broken policy leaves the last one in place
+	os.Setenv("BPOW_IP_POLICY", `{"rules": [{"name": "test", "action": "deny"}]}`)
+	if ReloadIPPolicy() == nil {
+		t.Errorf("Expected error reloading a broken policy")
+	}
+	utils.AssertEqual(t, IPActionDeny, GetIPPolicy().Evaluate("203.0.113.7").Action)
+}
@@ -5,3 +5,21 @@ const EMAIL_CONFIRMATION_TOKEN_VALID_MINUTES = 180
 
 // The nano send difficulty multiplier is x64, receive is x1 (banano is x1)
 const MAX_WORK_DIFFICULTY_MULTIPLIER = 64
+
+// How long the status of an asynchronous work request can be polled
+const WORK_STATUS_VALID_MINUTES = 60
+
+// How long we wait for the next block of a hash we generated work for, to precache work for it
+const PRECACHE_VALID_MINUTES = 60
+
+// Most hashes we wait for at once, the oldest are dropped past this
+const PRECACHE_MAX_ENTRIES = 100000
+
+// How long work stays in redis after it's generated or looked up, it's in postgres after that
+const WORK_CACHE_MINUTES = 60
+
+// How long a service's in-flight count survives without new requests, longer than any request can take
+const QUOTA_IN_FLIGHT_EXPIRY_MINUTES = 10
+
+// Open worker sessions not saved for this long are closed, the server that had them went away
+const WORKER_SESSION_STALE_MINUTES = 5
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/bananocoin/boompow/libs/utils"
+)
+
+// Network is a currency we precache and reward work for
+type Network struct {
+	Name string `json:"name"`
+	// Thresholds for send and receive blocks, nano's differ but banano's are the same
+	SendDifficulty    serializableModels.Difficulty `json:"sendDifficulty"`
+	ReceiveDifficulty serializableModels.Difficulty `json:"receiveDifficulty"`
+	// Node websocket we watch for confirmations to precache, precaching is off if this is empty
+	WSURL string `json:"wsUrl"`
+	// Node RPC we look up the accounts of requested hashes with, so we only watch those accounts
+	// Without it we watch every confirmation on the network
+	RPCURL string `json:"rpcUrl"`
+	// Precached work is requested as this service account
+	PrecacheRequester string `json:"precacheRequester"`
+	// Rewards for work on this network are multiplied by this
+	RewardWeight float64 `json:"rewardWeight"`
+	// Hardest work we ask workers for
+	MaxDifficulty serializableModels.Difficulty `json:"maxDifficulty"`
+}
+
+var networks []*Network
+var networksOnce sync.Once
+
+// The networks we ran with before they were configurable
+func defaultNetworks() []*Network {
+	return []*Network{
+		{
+			Name:              "nano",
+			SendDifficulty:    serializableModels.DifficultyFromMultiplier(64),
+			ReceiveDifficulty: serializableModels.DifficultyFromMultiplier(1),
+			WSURL:             utils.GetEnv("NANO_WS_URL", ""),
+			RPCURL:            utils.GetEnv("NANO_RPC_URL", ""),
+			PrecacheRequester: "nano@banano.cc",
+			RewardWeight:      1,
+			MaxDifficulty:     serializableModels.DifficultyFromMultiplier(MAX_WORK_DIFFICULTY_MULTIPLIER),
+		},
+		{
+			Name:              "banano",
+			SendDifficulty:    serializableModels.DifficultyFromMultiplier(1),
+			ReceiveDifficulty: serializableModels.DifficultyFromMultiplier(1),
+			WSURL:             utils.GetEnv("BANANO_WS_URL", ""),
+			RPCURL:            utils.GetEnv("BANANO_RPC_URL", ""),
+			PrecacheRequester: "all@banano.cc",
+			RewardWeight:      1,
+			MaxDifficulty:     serializableModels.DifficultyFromMultiplier(MAX_WORK_DIFFICULTY_MULTIPLIER),
+		},
+	}
+}
+
+// ParseNetworks reads a JSON array of networks and checks that they make sense
+func ParseNetworks(data []byte) ([]*Network, error) {
+	var parsed []*Network
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no networks configured")
+	}
+	seen := make(map[string]bool)
+	for _, network := range parsed {
+		network.Name = strings.ToLower(strings.TrimSpace(network.Name))
+		if network.Name == "" {
+			return nil, fmt.Errorf("network name is required")
+		}
+		if seen[network.Name] {
+			return nil, fmt.Errorf("network %s is configured more than once", network.Name)
+		}
+		seen[network.Name] = true
+		if network.SendDifficulty == 0 || network.ReceiveDifficulty == 0 {
+			return nil, fmt.Errorf("network %s needs a send and receive difficulty", network.Name)
+		}
+		if network.MaxDifficulty == 0 {
+			network.MaxDifficulty = serializableModels.DifficultyFromMultiplier(MAX_WORK_DIFFICULTY_MULTIPLIER)
+		}
+		if network.SendDifficulty > network.MaxDifficulty || network.ReceiveDifficulty > network.MaxDifficulty {
+			return nil, fmt.Errorf("network %s has a difficulty above its max difficulty", network.Name)
+		}
+		if network.RewardWeight < 0 {
+			return nil, fmt.Errorf("network %s has a negative reward weight", network.Name)
+		} else if network.RewardWeight == 0 {
+			network.RewardWeight = 1
+		}
+		if network.WSURL != "" && network.PrecacheRequester == "" {
+			return nil, fmt.Errorf("network %s needs a precache requester to precache", network.Name)
+		}
+	}
+	return parsed, nil
+}
+
+// Load from the JSON file in BPOW_NETWORKS_FILE, or JSON in BPOW_NETWORKS, or fall back to nano and banano
+func loadNetworks() ([]*Network, error) {
+	if path := utils.GetEnv("BPOW_NETWORKS_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseNetworks(data)
+	}
+	if raw := utils.GetEnv("BPOW_NETWORKS", ""); raw != "" {
+		return ParseNetworks([]byte(raw))
+	}
+	return defaultNetworks(), nil
+}
+
+// GetNetworks returns the configured networks, loading them the first time
+// A broken config is fatal, we shouldn't run precache or rewards with settings nobody intended
+func GetNetworks() []*Network {
+	networksOnce.Do(func() {
+		loaded, err := loadNetworks()
+		if err != nil {
+			panic(fmt.Sprintf("Invalid network config: %v", err))
+		}
+		networks = loaded
+	})
+	return networks
+}
+
+// GetNetwork finds a network by name
+func GetNetwork(name string) *Network {
+	name = strings.ToLower(name)
+	for _, network := range GetNetworks() {
+		if network.Name == name {
+			return network
+		}
+	}
+	return nil
+}
+
+// PrecacheRequesters are the accounts precached work is requested as, they aren't real services
+func PrecacheRequesters() []string {
+	requesters := []string{}
+	for _, network := range GetNetworks() {
+		if network.PrecacheRequester != "" {
+			requesters = append(requesters, network.PrecacheRequester)
+		}
+	}
+	return requesters
+}
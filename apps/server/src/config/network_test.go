@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]byte(`[
+		{"name": "Nano", "sendDifficulty": "fffffff800000000", "receiveDifficulty": "fffffe0000000000", "wsUrl": "ws://localhost:7078", "precacheRequester": "nano@banano.cc", "rewardWeight": 2},
+		{"name": "beta", "sendDifficulty": "fffffe0000000000", "receiveDifficulty": "fffffe0000000000"}
+	]`))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, len(networks))
+
+	utils.AssertEqual(t, "nano", networks[0].Name)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(64), networks[0].SendDifficulty)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(1), networks[0].ReceiveDifficulty)
+	utils.AssertEqual(t, 2.0, networks[0].RewardWeight)
+
+	// Defaults
+	utils.AssertEqual(t, 1.0, networks[1].RewardWeight)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(MAX_WORK_DIFFICULTY_MULTIPLIER), networks[1].MaxDifficulty)
+	utils.AssertEqual(t, "", networks[1].WSURL)
+}
+
+func TestParseNetworksInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`[]`,
+		`[{"sendDifficulty": "fffffe0000000000", "receiveDifficulty": "fffffe0000000000"}]`,
+		`[{"name": "nano", "receiveDifficulty": "fffffe0000000000"}]`,
+		`[{"name": "nano", "sendDifficulty": "fffffe0000000000", "receiveDifficulty": "fffffe0000000000"}, {"name": "NANO", "sendDifficulty": "fffffe0000000000", "receiveDifficulty": "fffffe0000000000"}]`,
+		`[{"name": "nano", "sendDifficulty": "ffffffff00000000", "receiveDifficulty": "fffffe0000000000", "maxDifficulty": "fffffff800000000"}]`,
+		`[{"name": "nano", "sendDifficulty": "fffffe0000000000", "receiveDifficulty": "fffffe0000000000", "rewardWeight": -1}]`,
+		`[{"name": "nano", "sendDifficulty": "fffffe0000000000", "receiveDifficulty": "fffffe0000000000", "wsUrl": "ws://localhost:7078"}]`,
+	} {
+		_, err := ParseNetworks([]byte(raw))
+		if err == nil {
+			t.Errorf("Expected error parsing %s", raw)
+		}
+	}
+}
+
+func TestDefaultNetworks(t *testing.T) {
+	networks := defaultNetworks()
+	utils.AssertEqual(t, "nano", networks[0].Name)
+	utils.AssertEqual(t, "nano@banano.cc", networks[0].PrecacheRequester)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(64), networks[0].SendDifficulty)
+	utils.AssertEqual(t, "banano", networks[1].Name)
+	utils.AssertEqual(t, "all@banano.cc", networks[1].PrecacheRequester)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(1), networks[1].SendDifficulty)
+}
+
+func TestPrecacheRequesters(t *testing.T) {
+	// Without a config it's the defaults
+	utils.AssertEqual(t, []string{"nano@banano.cc", "all@banano.cc"}, PrecacheRequesters())
+}
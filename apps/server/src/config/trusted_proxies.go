@@ -0,0 +1,13 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/bananocoin/boompow/libs/utils"
+	"github.com/bananocoin/boompow/libs/utils/net"
+)
+
+// LoadTrustedProxies reads the comma separated CIDRs in BPOW_TRUSTED_PROXIES, Cloudflare and private networks by default
+func LoadTrustedProxies() (*net.TrustedProxies, error) {
+	return net.ParseTrustedProxies(strings.Split(utils.GetEnv("BPOW_TRUSTED_PROXIES", "cloudflare,private"), ","))
+}
@@ -0,0 +1,67 @@
+package controller
+
+// Number of priority classes, see Priority.Rank
+const priorityClasses = 3
+
+// dispatchQueue holds dispatch requests until the hub sends them
+// The most urgent priority goes first, and the oldest request within a priority
+// Only touched from the hub goroutine
+type dispatchQueue struct {
+	lanes [priorityClasses][]*DispatchRequest
+}
+
+func newDispatchQueue() *dispatchQueue {
+	return &dispatchQueue{}
+}
+
+func (q *dispatchQueue) push(request *DispatchRequest) {
+	rank := request.Priority.Rank()
+	q.lanes[rank] = append(q.lanes[rank], request)
+}
+
+// The request that goes next, nil if the queue is empty
+func (q *dispatchQueue) peek() *DispatchRequest {
+	for _, lane := range q.lanes {
+		if len(lane) > 0 {
+			return lane[0]
+		}
+	}
+	return nil
+}
+
+func (q *dispatchQueue) pop() *DispatchRequest {
+	for rank, lane := range q.lanes {
+		if len(lane) > 0 {
+			q.lanes[rank] = lane[1:]
+			return lane[0]
+		}
+	}
+	return nil
+}
+
+// Take the most urgent request that's ready to go, nil if none is
+// A request nobody can take yet doesn't hold up the ones behind it
+func (q *dispatchQueue) take(ready func(request *DispatchRequest) bool) *DispatchRequest {
+	for rank, lane := range q.lanes {
+		for i, request := range lane {
+			if ready(request) {
+				q.lanes[rank] = append(lane[:i], lane[i+1:]...)
+				return request
+			}
+		}
+	}
+	return nil
+}
+
+// Drop everything queued for a request that's finished
+func (q *dispatchQueue) remove(requestID string) {
+	for rank, lane := range q.lanes {
+		kept := lane[:0]
+		for _, request := range lane {
+			if request.RequestID != requestID {
+				kept = append(kept, request)
+			}
+		}
+		q.lanes[rank] = kept
+	}
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestDispatchQueueOrder(t *testing.T) {
+	queue := newDispatchQueue()
+	queue.push(&DispatchRequest{RequestID: "bulk", Priority: serializableModels.PriorityBulk})
+	queue.push(&DispatchRequest{RequestID: "precache", Priority: serializableModels.PriorityPrecache})
+	queue.push(&DispatchRequest{RequestID: "first", Priority: serializableModels.PriorityInteractive})
+	queue.push(&DispatchRequest{RequestID: "second", Priority: serializableModels.PriorityInteractive})
+	queue.push(&DispatchRequest{RequestID: "removed", Priority: serializableModels.PriorityInteractive})
+	queue.remove("removed")
+
+	utils.AssertEqual(t, "first", queue.peek().RequestID)
+	for _, expected := range []string{"first", "second", "precache", "bulk"} {
+		utils.AssertEqual(t, expected, queue.pop().RequestID)
+	}
+	utils.AssertEqual(t, (*DispatchRequest)(nil), queue.pop())
+}
+
+func TestDrainHoldsLowerPrioritiesForFreeWorkers(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	busy := &Client{IPAddress: "1", Capacity: 1, InFlight: 1, Send: make(chan []byte, 10)}
+	h := &Hub{
+		Clients:    map[*Client]bool{busy: true},
+		Dispatcher: &Dispatcher{},
+		Fairness:   &CappedShareFairness{MaxShare: defaultFairnessMaxShare, MinClients: defaultFairnessMinClients},
+		queue:      newDispatchQueue(),
+		assignments: map[string]*assignment{
+			"other": {hash: "other", clients: map[*Client]time.Time{busy: time.Now()}},
+		},
+	}
+
+	h.queue.push(&DispatchRequest{RequestID: "precache", Hash: "precache", DifficultyMultiplier: 1, Priority: serializableModels.PriorityPrecache})
+	h.queue.push(&DispatchRequest{RequestID: "interactive", Hash: "interactive", DifficultyMultiplier: 1, Priority: serializableModels.PriorityInteractive})
+	h.drain()
+
+	// Interactive goes out even though the worker is busy, precache waits
+	utils.AssertEqual(t, 1, len(busy.Send))
+	_, ok := h.assignments["interactive"]
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, "precache", h.queue.peek().RequestID)
+
+	// Once the worker is done, precache goes out
+	h.finish("other")
+	h.finish("interactive")
+	h.drain()
+	_, ok = h.assignments["precache"]
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, (*DispatchRequest)(nil), h.queue.peek())
+}
+
+func TestDrainWaitsForWorkersThatAcceptTheRequest(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	// Free, but doesn't precache or do hard work
+	picky := &Client{IPAddress: "1", Capacity: 1, Send: make(chan []byte, 10), Hello: &serializableModels.ClientHello{NoPrecache: true, MaxDifficulty: 8}}
+	h := &Hub{
+		Clients:     map[*Client]bool{picky: true},
+		Dispatcher:  &Dispatcher{},
+		Fairness:    &CappedShareFairness{MaxShare: defaultFairnessMaxShare, MinClients: defaultFairnessMinClients},
+		queue:       newDispatchQueue(),
+		assignments: map[string]*assignment{},
+	}
+
+	h.queue.push(&DispatchRequest{RequestID: "precache", Hash: "precache", DifficultyMultiplier: 1, Precache: true, Priority: serializableModels.PriorityPrecache})
+	h.queue.push(&DispatchRequest{RequestID: "hard", Hash: "hard", DifficultyMultiplier: 64, Priority: serializableModels.PriorityBulk})
+	h.queue.push(&DispatchRequest{RequestID: "bulk", Hash: "bulk", DifficultyMultiplier: 1, Priority: serializableModels.PriorityBulk})
+	h.drain()
+
+	// Only what the worker accepts goes out, the rest stays queued in order
+	utils.AssertEqual(t, 1, len(picky.Send))
+	_, ok := h.assignments["bulk"]
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, "precache", h.queue.pop().RequestID)
+	utils.AssertEqual(t, "hard", h.queue.pop().RequestID)
+	utils.AssertEqual(t, (*DispatchRequest)(nil), h.queue.peek())
+}
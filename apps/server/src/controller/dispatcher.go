@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/libs/utils"
+	"k8s.io/klog/v2"
+)
+
+// Default "minimum difficulty:workers" rules, harder requests are sent to more workers
+const defaultRedundancy = "1:2,16:3,64:4"
+
+// How long we wait for one of the selected workers before asking everybody
+const defaultFallbackDeadlineMs = 5000
+
+// Latency we assume for workers we haven't seen solve anything yet
+const defaultWorkerLatency = 2 * time.Second
+
+// Smoothing factor for the latency moving average
+const latencyEWMAAlpha = 0.3
+
+// RedundancyRule says how many workers a request of at least MinDifficulty should be sent to
+type RedundancyRule struct {
+	MinDifficulty int
+	Workers       int
+}
+
+// Dispatcher decides which workers a work request is sent to
+type Dispatcher struct {
+	// Sorted by MinDifficulty ascending
+	Redundancy []RedundancyRule
+	// How long to wait for the selected workers before falling back to a broadcast
+	FallbackDeadline time.Duration
+	// Weights used to rank workers
+	LatencyWeight  float64
+	CapacityWeight float64
+	// Pushes back accounts that hold a big share of the pool
+	FairnessWeight float64
+	// Pushes back rigs that hold a big share of their account's score
+	RigFairnessWeight float64
+}
+
+func NewDispatcher() *Dispatcher {
+	redundancy, err := ParseRedundancyRules(utils.GetEnv("BPOW_DISPATCH_REDUNDANCY", defaultRedundancy))
+	if err != nil {
+		klog.Errorf("Invalid BPOW_DISPATCH_REDUNDANCY, using default %v", err)
+		redundancy, _ = ParseRedundancyRules(defaultRedundancy)
+	}
+	fallbackMs, err := strconv.Atoi(utils.GetEnv("BPOW_DISPATCH_FALLBACK_MS", strconv.Itoa(defaultFallbackDeadlineMs)))
+	if err != nil || fallbackMs <= 0 {
+		fallbackMs = defaultFallbackDeadlineMs
+	}
+	return &Dispatcher{
+		Redundancy:        redundancy,
+		FallbackDeadline:  time.Duration(fallbackMs) * time.Millisecond,
+		LatencyWeight:     1,
+		CapacityWeight:    1,
+		FairnessWeight:    2,
+		RigFairnessWeight: 1,
+	}
+}
+
+// ParseRedundancyRules parses rules in the format "1:2,16:3,64:4"
+func ParseRedundancyRules(raw string) ([]RedundancyRule, error) {
+	rules := []RedundancyRule{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		split := strings.Split(part, ":")
+		if len(split) != 2 {
+			return nil, strconv.ErrSyntax
+		}
+		minDifficulty, err := strconv.Atoi(split[0])
+		if err != nil {
+			return nil, err
+		}
+		workers, err := strconv.Atoi(split[1])
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, RedundancyRule{MinDifficulty: minDifficulty, Workers: workers})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].MinDifficulty < rules[j].MinDifficulty
+	})
+	return rules, nil
+}
+
+// RedundancyFor returns how many workers should receive a request with this difficulty multiplier
+func (d *Dispatcher) RedundancyFor(difficultyMultiplier int) int {
+	workers := 1
+	for _, rule := range d.Redundancy {
+		if difficultyMultiplier >= rule.MinDifficulty {
+			workers = rule.Workers
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// SelectWorkers ranks candidates and returns the best n of them
+func (d *Dispatcher) SelectWorkers(candidates []*Client, shares *database.ClientScoreShares, n int) []*Client {
+	if n >= len(candidates) {
+		return candidates
+	}
+	return d.Rank(candidates, shares)[:n]
+}
+
+// Rank orders candidates best first
+// shares is the fraction of the total score each account and rig currently holds
+// Workers that have free capacity are always preferred over busy ones
+func (d *Dispatcher) Rank(candidates []*Client, shares *database.ClientScoreShares) []*Client {
+	ranked := make([]*Client, len(candidates))
+	copy(ranked, candidates)
+	// Shuffle first so ties don't always go to the same worker
+	rand.Shuffle(len(ranked), func(i, j int) { ranked[i], ranked[j] = ranked[j], ranked[i] })
+	rigsPerAccount := map[string]int{}
+	for _, c := range ranked {
+		rigsPerAccount[c.Email]++
+	}
+	scores := make(map[*Client]float64, len(ranked))
+	for _, c := range ranked {
+		scores[c] = d.score(c, shares.Accounts[c.Email], shares.Rigs[c.WorkerID], rigsPerAccount[c.Email])
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		iFree, jFree := ranked[i].hasCapacity(), ranked[j].hasCapacity()
+		if iFree != jFree {
+			return iFree
+		}
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+	return ranked
+}
+
+func (d *Dispatcher) score(c *Client, accountShare float64, rigShare float64, accountRigs int) float64 {
+	latency := c.AvgLatency
+	if latency <= 0 {
+		latency = defaultWorkerLatency
+	}
+	capacity := c.Capacity
+	if capacity < 1 {
+		capacity = 1
+	}
+	free := float64(capacity-c.InFlight) / float64(capacity)
+	// Spread an account's work over its rigs, a rig with more than its even part of the account's score is pushed back
+	rigExcess := 0.0
+	if accountShare > 0 && accountRigs > 0 {
+		rigExcess = rigShare/accountShare - 1/float64(accountRigs)
+	}
+	return d.LatencyWeight/(1+latency.Seconds()) + d.CapacityWeight*free - d.FairnessWeight*accountShare - d.RigFairnessWeight*rigExcess
+}
+
+func (c *Client) hasCapacity() bool {
+	capacity := c.Capacity
+	if capacity < 1 {
+		capacity = 1
+	}
+	return c.InFlight < capacity
+}
+
+// Record how long this client took to solve a request
+func (c *Client) recordLatency(latency time.Duration) {
+	if c.AvgLatency <= 0 {
+		c.AvgLatency = latency
+		return
+	}
+	c.AvgLatency = time.Duration(latencyEWMAAlpha*float64(latency) + (1-latencyEWMAAlpha)*float64(c.AvgLatency))
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestRedundancyRules(t *testing.T) {
+	rules, err := ParseRedundancyRules("64:4, 1:2,16:3")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 3, len(rules))
+	utils.AssertEqual(t, 1, rules[0].MinDifficulty)
+
+	_, err = ParseRedundancyRules("1-2")
+	utils.AssertEqual(t, true, err != nil)
+
+	dispatcher := &Dispatcher{Redundancy: rules}
+	utils.AssertEqual(t, 2, dispatcher.RedundancyFor(1))
+	utils.AssertEqual(t, 3, dispatcher.RedundancyFor(32))
+	utils.AssertEqual(t, 4, dispatcher.RedundancyFor(64))
+	utils.AssertEqual(t, 4, dispatcher.RedundancyFor(128))
+}
+
+func TestSelectWorkers(t *testing.T) {
+	dispatcher := &Dispatcher{
+		LatencyWeight:  1,
+		CapacityWeight: 1,
+		FairnessWeight: 2,
+	}
+
+	fast := &Client{Email: "1", WorkerID: "1/default", Capacity: 1, AvgLatency: 500 * time.Millisecond}
+	slow := &Client{Email: "2", WorkerID: "2/default", Capacity: 1, AvgLatency: 10 * time.Second}
+	busy := &Client{Email: "3", WorkerID: "3/default", Capacity: 1, InFlight: 1, AvgLatency: 100 * time.Millisecond}
+	greedy := &Client{Email: "4", WorkerID: "4/default", Capacity: 1, AvgLatency: 400 * time.Millisecond}
+	candidates := []*Client{busy, slow, greedy, fast}
+	noShares := &database.ClientScoreShares{}
+
+	// Busy workers are picked last, faster workers first
+	selected := dispatcher.SelectWorkers(candidates, noShares, 3)
+	utils.AssertEqual(t, 3, len(selected))
+	utils.AssertEqual(t, greedy, selected[0])
+	utils.AssertEqual(t, fast, selected[1])
+	utils.AssertEqual(t, slow, selected[2])
+
+	// Accounts that already earned a big share of the pool are pushed back
+	selected = dispatcher.SelectWorkers(candidates, &database.ClientScoreShares{Accounts: map[string]float64{"4": 0.9}, Rigs: map[string]float64{"4/default": 0.9}}, 2)
+	utils.AssertEqual(t, fast, selected[0])
+	utils.AssertEqual(t, slow, selected[1])
+
+	// Asking for more than we have returns everybody
+	selected = dispatcher.SelectWorkers(candidates, noShares, 10)
+	utils.AssertEqual(t, 4, len(selected))
+}
+
+func TestSelectWorkersSpreadsRigs(t *testing.T) {
+	dispatcher := &Dispatcher{
+		LatencyWeight:     1,
+		CapacityWeight:    1,
+		FairnessWeight:    2,
+		RigFairnessWeight: 1,
+	}
+
+	// Same account, the first rig earned everything so far
+	first := &Client{Email: "a", WorkerID: "a/first", Capacity: 1, AvgLatency: 400 * time.Millisecond}
+	second := &Client{Email: "a", WorkerID: "a/second", Capacity: 1, AvgLatency: 500 * time.Millisecond}
+	shares := &database.ClientScoreShares{
+		Accounts: map[string]float64{"a": 0.5},
+		Rigs:     map[string]float64{"a/first": 0.5},
+	}
+	selected := dispatcher.SelectWorkers([]*Client{first, second}, shares, 1)
+	utils.AssertEqual(t, second, selected[0])
+
+	// A lone rig isn't pushed back for holding all of its account's score
+	utils.AssertEqual(t, dispatcher.score(first, 0.5, 0, 0), dispatcher.score(first, 0.5, 0.5, 1))
+}
@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/libs/utils"
+	"k8s.io/klog/v2"
+)
+
+// Fairness policies, picked with BPOW_FAIRNESS_POLICY
+const (
+	FairnessCappedShare        = "capped_share"
+	FairnessTokenBucket        = "token_bucket"
+	FairnessWeightedRoundRobin = "weighted_round_robin"
+)
+
+// Defaults for the tunable parts of the policies
+const (
+	defaultFairnessMaxShare      = 0.15
+	defaultFairnessMinClients    = 5
+	defaultFairnessBucketRate    = 1.0
+	defaultFairnessBucketSize    = 30.0
+	defaultFairnessHashrateLimit = 4.0
+)
+
+// FairnessState is what a fairness policy sees when a request is dispatched
+type FairnessState struct {
+	// Share of the payout period's score each account and rig holds, scores are wiped when a payout is sent
+	Shares *database.ClientScoreShares
+	// Clients connected, whether they're candidates or not
+	Connected int
+	Now       time.Time
+}
+
+// FairnessPolicy decides which workers get a request, so no account can take the whole pool
+// Only used from the hub goroutine with the hub locked
+type FairnessPolicy interface {
+	// Pick chooses up to n of the candidates, ranked holds them best first by the dispatcher's ranking
+	Pick(ranked []*Client, n int, state *FairnessState) []*Client
+	// Dispatched is called for every client a request was sent to
+	Dispatched(client *Client, now time.Time)
+	// Disconnected is called when a client goes away
+	Disconnected(client *Client)
+}
+
+// NewFairnessPolicy builds the policy named by BPOW_FAIRNESS_POLICY from its settings
+func NewFairnessPolicy() FairnessPolicy {
+	name := utils.GetEnv("BPOW_FAIRNESS_POLICY", FairnessCappedShare)
+	switch name {
+	case FairnessCappedShare:
+	case FairnessTokenBucket:
+		return NewTokenBucketFairness(
+			getFairnessFloat("BPOW_FAIRNESS_BUCKET_RATE", defaultFairnessBucketRate),
+			getFairnessFloat("BPOW_FAIRNESS_BUCKET_SIZE", defaultFairnessBucketSize),
+		)
+	case FairnessWeightedRoundRobin:
+		return NewWeightedRoundRobinFairness(getFairnessFloat("BPOW_FAIRNESS_HASHRATE_LIMIT", defaultFairnessHashrateLimit))
+	default:
+		klog.Errorf("Invalid BPOW_FAIRNESS_POLICY %s, using default %s", name, FairnessCappedShare)
+	}
+	minClients, err := strconv.Atoi(utils.GetEnv("BPOW_FAIRNESS_MIN_CLIENTS", strconv.Itoa(defaultFairnessMinClients)))
+	if err != nil || minClients < 0 {
+		klog.Errorf("Invalid BPOW_FAIRNESS_MIN_CLIENTS, using default %d", defaultFairnessMinClients)
+		minClients = defaultFairnessMinClients
+	}
+	return &CappedShareFairness{
+		MaxShare:   getFairnessFloat("BPOW_FAIRNESS_MAX_SHARE", defaultFairnessMaxShare),
+		MinClients: minClients,
+	}
+}
+
+func getFairnessFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(utils.GetEnv(key, strconv.FormatFloat(fallback, 'f', -1, 64)), 64)
+	if err != nil || value <= 0 || math.IsInf(value, 0) {
+		klog.Errorf("Invalid %s, using default %v", key, fallback)
+		return fallback
+	}
+	return value
+}
+
+// Keep the candidates allowed through, in order, up to n
+// If nobody is allowed nobody is held back, the request has to go somewhere
+func pickAllowed(ranked []*Client, n int, allowed func(*Client) bool) []*Client {
+	picked := []*Client{}
+	for _, c := range ranked {
+		if len(picked) == n {
+			break
+		}
+		if allowed(c) {
+			picked = append(picked, c)
+		}
+	}
+	if len(picked) == 0 && n < len(ranked) {
+		return ranked[:n]
+	} else if len(picked) == 0 {
+		return ranked
+	}
+	return picked
+}
+
+// CappedShareFairness holds back accounts that earned MaxShare or more of the payout period's score
+type CappedShareFairness struct {
+	MaxShare float64
+	// Nobody is held back with fewer clients connected than this
+	MinClients int
+}
+
+func (p *CappedShareFairness) Pick(ranked []*Client, n int, state *FairnessState) []*Client {
+	if state.Connected < p.MinClients {
+		return pickAllowed(ranked, n, func(*Client) bool { return true })
+	}
+	return pickAllowed(ranked, n, func(c *Client) bool {
+		return state.Shares.Accounts[c.Email] < p.MaxShare
+	})
+}
+
+func (p *CappedShareFairness) Dispatched(client *Client, now time.Time) {}
+
+func (p *CappedShareFairness) Disconnected(client *Client) {}
+
+// TokenBucketFairness gives every account a bucket of requests that refills at Rate per second, up to Size
+// An account however many rigs it has only gets requests while it has tokens
+type TokenBucketFairness struct {
+	Rate float64
+	Size float64
+	// Keyed by email
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewTokenBucketFairness(rate float64, size float64) *TokenBucketFairness {
+	return &TokenBucketFairness{Rate: rate, Size: size, buckets: make(map[string]*tokenBucket)}
+}
+
+// Tokens an account has now, a bucket we haven't seen is full
+func (p *TokenBucketFairness) tokens(email string, now time.Time) float64 {
+	bucket, ok := p.buckets[email]
+	if !ok {
+		return p.Size
+	}
+	return math.Min(p.Size, bucket.tokens+now.Sub(bucket.updated).Seconds()*p.Rate)
+}
+
+func (p *TokenBucketFairness) Pick(ranked []*Client, n int, state *FairnessState) []*Client {
+	// Each worker picked takes a token, so an account can't get more picks than it has tokens
+	spent := map[string]float64{}
+	picked := pickAllowed(ranked, n, func(c *Client) bool {
+		if p.tokens(c.Email, state.Now)-spent[c.Email] < 1 {
+			return false
+		}
+		spent[c.Email]++
+		return true
+	})
+	// Full buckets are the same as no bucket
+	for email := range p.buckets {
+		if p.tokens(email, state.Now) >= p.Size {
+			delete(p.buckets, email)
+		}
+	}
+	return picked
+}
+
+func (p *TokenBucketFairness) Dispatched(client *Client, now time.Time) {
+	p.buckets[client.Email] = &tokenBucket{
+		tokens:  math.Max(0, p.tokens(client.Email, now)-1),
+		updated: now,
+	}
+}
+
+// Buckets outlive connections, reconnecting doesn't refill them
+func (p *TokenBucketFairness) Disconnected(client *Client) {}
+
+// WeightedRoundRobinFairness takes turns between workers, each gets turns in proportion to its hashrate
+// Hashrates are what workers say in their hello, and are limited to HashrateLimit times the median so nobody can claim every turn
+type WeightedRoundRobinFairness struct {
+	HashrateLimit float64
+	// Smooth weighted round robin credit, keyed by worker ID
+	current map[string]float64
+}
+
+func NewWeightedRoundRobinFairness(hashrateLimit float64) *WeightedRoundRobinFairness {
+	return &WeightedRoundRobinFairness{HashrateLimit: hashrateLimit, current: make(map[string]float64)}
+}
+
+// Workers that didn't say their hashrate are assumed to be typical
+func (p *WeightedRoundRobinFairness) weights(candidates []*Client) map[*Client]float64 {
+	reported := []float64{}
+	for _, c := range candidates {
+		if c.Hello != nil && c.Hello.Hashrate > 0 {
+			reported = append(reported, c.Hello.Hashrate)
+		}
+	}
+	median := 1.0
+	if len(reported) > 0 {
+		sort.Float64s(reported)
+		median = reported[len(reported)/2]
+	}
+	weights := make(map[*Client]float64, len(candidates))
+	for _, c := range candidates {
+		weight := median
+		if c.Hello != nil && c.Hello.Hashrate > 0 {
+			weight = math.Min(c.Hello.Hashrate, median*p.HashrateLimit)
+		}
+		weights[c] = weight
+	}
+	return weights
+}
+
+func (p *WeightedRoundRobinFairness) Pick(ranked []*Client, n int, state *FairnessState) []*Client {
+	if n >= len(ranked) {
+		return ranked
+	}
+	// Workers with free capacity take turns first, busy ones only fill in
+	free, busy := []*Client{}, []*Client{}
+	for _, c := range ranked {
+		if c.hasCapacity() {
+			free = append(free, c)
+		} else {
+			busy = append(busy, c)
+		}
+	}
+	picked := p.turns(free, n)
+	for _, c := range busy {
+		if len(picked) == n {
+			break
+		}
+		picked = append(picked, c)
+	}
+	return picked
+}
+
+// Smooth weighted round robin, everybody gains their weight and whoever has the most credit takes a turn
+func (p *WeightedRoundRobinFairness) turns(candidates []*Client, n int) []*Client {
+	weights := p.weights(candidates)
+	picked := []*Client{}
+	remaining := append([]*Client{}, candidates...)
+	for len(picked) < n && len(remaining) > 0 {
+		total := 0.0
+		best := -1
+		for i, c := range remaining {
+			p.current[c.WorkerID] += weights[c]
+			total += weights[c]
+			if best < 0 || p.current[c.WorkerID] > p.current[remaining[best].WorkerID] {
+				best = i
+			}
+		}
+		chosen := remaining[best]
+		p.current[chosen.WorkerID] -= total
+		picked = append(picked, chosen)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return picked
+}
+
+func (p *WeightedRoundRobinFairness) Dispatched(client *Client, now time.Time) {}
+
+func (p *WeightedRoundRobinFairness) Disconnected(client *Client) {
+	delete(p.current, client.WorkerID)
+}
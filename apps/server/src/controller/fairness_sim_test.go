@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+// A synthetic worker for the simulation
+type simWorker struct {
+	email string
+	rig   string
+	// Hashes per second it really does, and what it says in its hello
+	hashrate float64
+	claimed  float64
+}
+
+// Replay a population of workers to see how a fairness policy shares out the work
+type simulation struct {
+	workers []simWorker
+	// Requests arrive this far apart
+	interval time.Duration
+	// Workers each request is sent to, the fastest of them wins it
+	redundancy int
+	seed       int64
+}
+
+type simResult struct {
+	requests int
+	// Work won and requests received by each account
+	won        map[string]int
+	dispatched map[string]int
+}
+
+func (r *simResult) share(email string) float64 {
+	return float64(r.won[email]) / float64(r.requests)
+}
+
+// Accounts with the same number of rigs of the same hashrate, named prefix0, prefix1...
+func simAccounts(prefix string, accounts int, rigs int, hashrate float64) []simWorker {
+	workers := []simWorker{}
+	for a := 0; a < accounts; a++ {
+		for r := 0; r < rigs; r++ {
+			workers = append(workers, simWorker{email: fmt.Sprintf("%s%d", prefix, a), rig: fmt.Sprintf("rig%d", r), hashrate: hashrate, claimed: hashrate})
+		}
+	}
+	return workers
+}
+
+func (s *simulation) run(policy FairnessPolicy, requests int) *simResult {
+	random := rand.New(rand.NewSource(s.seed))
+	dispatcher := &Dispatcher{LatencyWeight: 1, CapacityWeight: 1, FairnessWeight: 2, RigFairnessWeight: 1}
+	clients := make([]*Client, len(s.workers))
+	hashrates := make(map[*Client]float64, len(s.workers))
+	for i, w := range s.workers {
+		clients[i] = &Client{
+			Email:    w.email,
+			WorkerID: WorkerID(w.email, w.rig),
+			Capacity: 1,
+			Hello:    &serializableModels.ClientHello{Hashrate: w.claimed},
+		}
+		hashrates[clients[i]] = w.hashrate
+	}
+
+	result := &simResult{requests: requests, won: map[string]int{}, dispatched: map[string]int{}}
+	accountScores, rigScores := map[string]float64{}, map[string]float64{}
+	total := 0.0
+	now := time.Unix(0, 0)
+	for i := 0; i < requests; i++ {
+		now = now.Add(s.interval)
+		shares := &database.ClientScoreShares{Accounts: map[string]float64{}, Rigs: map[string]float64{}}
+		for email, score := range accountScores {
+			shares.Accounts[email] = score / total
+		}
+		for worker, score := range rigScores {
+			shares.Rigs[worker] = score / total
+		}
+		state := &FairnessState{Shares: shares, Connected: len(clients), Now: now}
+		picked := policy.Pick(dispatcher.Rank(clients, shares), s.redundancy, state)
+
+		// Solving is a race, each worker finishes after an exponential time with its hashrate as the rate
+		var winner *Client
+		best := math.Inf(1)
+		for _, c := range picked {
+			policy.Dispatched(c, now)
+			result.dispatched[c.Email]++
+			solve := random.ExpFloat64() / hashrates[c]
+			if solve < best {
+				winner, best = c, solve
+			}
+		}
+		if winner == nil {
+			continue
+		}
+		// Like the hub we only hear back from the winner
+		winner.recordLatency(time.Duration(best * float64(time.Second)))
+		result.won[winner.Email]++
+		accountScores[winner.Email]++
+		rigScores[winner.WorkerID]++
+		total++
+	}
+	return result
+}
+
+// Nobody is held back, to compare the policies against
+type noFairness struct{}
+
+func (noFairness) Pick(ranked []*Client, n int, state *FairnessState) []*Client {
+	return pickAllowed(ranked, n, func(*Client) bool { return true })
+}
+func (noFairness) Dispatched(client *Client, now time.Time) {}
+func (noFairness) Disconnected(client *Client)              {}
+
+func TestSimulateWhale(t *testing.T) {
+	// One account with 10 fast rigs among 20 hobbyists, it has most of the hashrate
+	sim := &simulation{
+		workers:    append(simAccounts("whale", 1, 10, 10), simAccounts("hobbyist", 20, 1, 1)...),
+		interval:   100 * time.Millisecond,
+		redundancy: 2,
+		seed:       1,
+	}
+	requests := 2000
+	duration := time.Duration(requests) * sim.interval
+
+	baseline := sim.run(noFairness{}, requests)
+	capped := sim.run(&CappedShareFairness{MaxShare: 0.15, MinClients: 5}, requests)
+	bucket := sim.run(NewTokenBucketFairness(1, 10), requests)
+	roundRobin := sim.run(NewWeightedRoundRobinFairness(4), requests)
+	t.Logf("whale share: none %.2f, capped share %.2f, token bucket %.2f, round robin %.2f", baseline.share("whale0"), capped.share("whale0"), bucket.share("whale0"), roundRobin.share("whale0"))
+
+	// Held back once it passes the cap, it can overshoot by a request or so
+	if share := capped.share("whale0"); share > 0.16 {
+		t.Errorf("Capped share let the whale win %.2f of the work", share)
+	}
+	// One request per second, and the bucket it started with
+	if dispatched := bucket.dispatched["whale0"]; float64(dispatched) > duration.Seconds()+10 {
+		t.Errorf("Token bucket sent the whale %d requests in %v", dispatched, duration)
+	}
+	// Ranking by latency keeps sending work to whoever was fast before, so some hobbyists never get any
+	// The token bucket and round robin make everybody take turns
+	for a := 0; a < 20; a++ {
+		email := fmt.Sprintf("hobbyist%d", a)
+		if bucket.won[email] == 0 {
+			t.Errorf("Token bucket never gave %s any work", email)
+		}
+		if roundRobin.won[email] == 0 {
+			t.Errorf("Round robin never gave %s any work", email)
+		}
+	}
+}
+
+func TestSimulateRoundRobinByHashrate(t *testing.T) {
+	sim := &simulation{
+		workers: []simWorker{
+			{email: "a", rig: "default", hashrate: 1, claimed: 1},
+			{email: "b", rig: "default", hashrate: 2, claimed: 2},
+			{email: "c", rig: "default", hashrate: 3, claimed: 3},
+			{email: "d", rig: "default", hashrate: 4, claimed: 4},
+		},
+		interval:   time.Second,
+		redundancy: 1,
+		seed:       1,
+	}
+	result := sim.run(NewWeightedRoundRobinFairness(4), 1000)
+	// Turns are in proportion to hashrate
+	for email, expected := range map[string]int{"a": 100, "b": 200, "c": 300, "d": 400} {
+		if math.Abs(float64(result.dispatched[email]-expected)) > 5 {
+			t.Errorf("%s got %d turns, expected about %d", email, result.dispatched[email], expected)
+		}
+	}
+}
+
+func TestSimulateRoundRobinLiar(t *testing.T) {
+	// One worker says it's a thousand times faster than it is
+	workers := simAccounts("honest", 10, 1, 1)
+	workers = append(workers, simWorker{email: "liar", rig: "default", hashrate: 1, claimed: 1000})
+	sim := &simulation{workers: workers, interval: time.Second, redundancy: 1, seed: 1}
+	result := sim.run(NewWeightedRoundRobinFairness(4), 1400)
+
+	// It's counted as 4 times the median, so it gets 4 turns for every 10 the others share
+	utils.AssertEqual(t, 400, result.dispatched["liar"])
+	utils.AssertEqual(t, 100, result.dispatched["honest0"])
+}
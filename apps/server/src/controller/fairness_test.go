@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestNewFairnessPolicy(t *testing.T) {
+	defer os.Unsetenv("BPOW_FAIRNESS_POLICY")
+	defer os.Unsetenv("BPOW_FAIRNESS_MAX_SHARE")
+	defer os.Unsetenv("BPOW_FAIRNESS_BUCKET_RATE")
+
+	// The 15% cap we always had
+	os.Unsetenv("BPOW_FAIRNESS_POLICY")
+	utils.AssertEqual(t, &CappedShareFairness{MaxShare: 0.15, MinClients: 5}, NewFairnessPolicy())
+	os.Setenv("BPOW_FAIRNESS_MAX_SHARE", "0.25")
+	utils.AssertEqual(t, 0.25, NewFairnessPolicy().(*CappedShareFairness).MaxShare)
+	os.Setenv("BPOW_FAIRNESS_MAX_SHARE", "-1")
+	utils.AssertEqual(t, 0.15, NewFairnessPolicy().(*CappedShareFairness).MaxShare)
+	os.Unsetenv("BPOW_FAIRNESS_MAX_SHARE")
+
+	os.Setenv("BPOW_FAIRNESS_POLICY", FairnessTokenBucket)
+	os.Setenv("BPOW_FAIRNESS_BUCKET_RATE", "0.5")
+	bucket := NewFairnessPolicy().(*TokenBucketFairness)
+	utils.AssertEqual(t, 0.5, bucket.Rate)
+	utils.AssertEqual(t, 30.0, bucket.Size)
+
+	os.Setenv("BPOW_FAIRNESS_POLICY", FairnessWeightedRoundRobin)
+	utils.AssertEqual(t, 4.0, NewFairnessPolicy().(*WeightedRoundRobinFairness).HashrateLimit)
+
+	os.Setenv("BPOW_FAIRNESS_POLICY", "nope")
+	_, ok := NewFairnessPolicy().(*CappedShareFairness)
+	utils.AssertEqual(t, true, ok)
+}
+
+func TestCappedShareFairness(t *testing.T) {
+	policy := &CappedShareFairness{MaxShare: 0.15, MinClients: 3}
+	big := &Client{Email: "big", WorkerID: "big/default"}
+	bigRig := &Client{Email: "big", WorkerID: "big/other"}
+	small := &Client{Email: "small", WorkerID: "small/default"}
+	state := &FairnessState{Shares: &database.ClientScoreShares{Accounts: map[string]float64{"big": 0.5, "small": 0.1}}, Connected: 3}
+
+	// The whole account is held back, however many rigs it has
+	utils.AssertEqual(t, []*Client{small}, policy.Pick([]*Client{big, bigRig, small}, 2, state))
+	// Unless there's nobody else
+	utils.AssertEqual(t, []*Client{big}, policy.Pick([]*Client{big, bigRig}, 1, state))
+	// Or too few clients to be picky
+	state.Connected = 2
+	utils.AssertEqual(t, []*Client{big, bigRig}, policy.Pick([]*Client{big, bigRig, small}, 2, state))
+}
+
+func TestTokenBucketFairness(t *testing.T) {
+	policy := NewTokenBucketFairness(1, 2)
+	a := &Client{Email: "a", WorkerID: "a/one"}
+	aRig := &Client{Email: "a", WorkerID: "a/two"}
+	b := &Client{Email: "b", WorkerID: "b/default"}
+	now := time.Unix(0, 0)
+	state := &FairnessState{Shares: &database.ClientScoreShares{}, Now: now}
+
+	// Two tokens, one for each rig
+	picked := policy.Pick([]*Client{a, aRig, b}, 3, state)
+	utils.AssertEqual(t, []*Client{a, aRig, b}, picked)
+	for _, c := range picked {
+		policy.Dispatched(c, now)
+	}
+	// Out of tokens, b has one left
+	utils.AssertEqual(t, []*Client{b}, policy.Pick([]*Client{a, aRig, b}, 2, state))
+	policy.Dispatched(b, now)
+	// Nobody has tokens, the request still goes out
+	utils.AssertEqual(t, []*Client{a}, policy.Pick([]*Client{a, aRig, b}, 1, state))
+
+	// A second later a and b have one again, one rig of a gets it
+	state.Now = now.Add(time.Second)
+	utils.AssertEqual(t, []*Client{a, b}, policy.Pick([]*Client{a, aRig, b}, 3, state))
+	// Reconnecting doesn't refill the bucket
+	policy.Disconnected(a)
+	utils.AssertEqual(t, 1.0, policy.tokens("a", state.Now))
+
+	// Buckets that refilled are forgotten
+	state.Now = now.Add(time.Minute)
+	policy.Pick([]*Client{b}, 1, state)
+	utils.AssertEqual(t, 0, len(policy.buckets))
+}
+
+func TestWeightedRoundRobinFairness(t *testing.T) {
+	policy := NewWeightedRoundRobinFairness(4)
+	fast := &Client{Email: "fast", WorkerID: "fast/default", Capacity: 1, Hello: &serializableModels.ClientHello{Hashrate: 3}}
+	slow := &Client{Email: "slow", WorkerID: "slow/default", Capacity: 1, Hello: &serializableModels.ClientHello{Hashrate: 1}}
+	// Said nothing, counted as the median
+	quiet := &Client{Email: "quiet", WorkerID: "quiet/default", Capacity: 1}
+	state := &FairnessState{Shares: &database.ClientScoreShares{}}
+
+	turns := map[*Client]int{}
+	for i := 0; i < 700; i++ {
+		turns[policy.Pick([]*Client{slow, quiet, fast}, 1, state)[0]]++
+	}
+	// Weights 3, 3 and 1
+	utils.AssertEqual(t, 300, turns[fast])
+	utils.AssertEqual(t, 300, turns[quiet])
+	utils.AssertEqual(t, 100, turns[slow])
+
+	// Busy workers only fill in
+	busy := &Client{Email: "busy", WorkerID: "busy/default", Capacity: 1, InFlight: 1, Hello: &serializableModels.ClientHello{Hashrate: 100}}
+	picked := policy.Pick([]*Client{busy, slow}, 2, state)
+	utils.AssertEqual(t, []*Client{busy, slow}, picked)
+	picked = policy.Pick([]*Client{busy, slow, fast}, 2, state)
+	utils.AssertEqual(t, 2, len(picked))
+	utils.AssertEqual(t, false, picked[0] == busy || picked[1] == busy)
+
+	policy.Disconnected(fast)
+	_, ok := policy.current[fast.WorkerID]
+	utils.AssertEqual(t, false, ok)
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/bananocoin/boompow/libs/utils/validation"
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+)
+
+// Returned by a dispatch that was interrupted to upgrade or cancel the flight
+var errFlightInterrupted = errors.New("interrupted")
+
+// A caller waiting on a flight
+type flightWaiter struct {
+	request serializableModels.ClientMessage
+	// Closed when this caller no longer wants the work
+	cancel    chan struct{}
+	cancelled bool
+}
+
+// flight is the work request for a hash, every caller that wants work for the hash at the same time waits on it
+type flight struct {
+	hash string
+	// Hardest difficulty any waiter asked for
+	difficulty serializableModels.Difficulty
+	// Most urgent priority any waiter asked with
+	priority serializableModels.Priority
+	waiters  []*flightWaiter
+	// The waiter the current attempt is requested as, its service gets credit for the work
+	credited *flightWaiter
+	// Signals the current attempt to stop, when the difficulty or priority went up or every waiter cancelled
+	interrupt chan struct{}
+	done      chan struct{}
+	response  *serializableModels.ClientWorkResponse
+	err       error
+}
+
+// flightGroup makes sure there's only one flight per hash
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+	// Sends the request to workers and waits up to timeout for work, returns errFlightInterrupted if interrupt fires first
+	dispatch func(request serializableModels.ClientMessage, interrupt <-chan struct{}, timeout time.Duration) (*serializableModels.ClientWorkResponse, error)
+	// How long all attempts of a flight can take together
+	timeout time.Duration
+}
+
+func newFlightGroup(dispatch func(serializableModels.ClientMessage, <-chan struct{}, time.Duration) (*serializableModels.ClientWorkResponse, error), timeout time.Duration) *flightGroup {
+	return &flightGroup{
+		flights:  make(map[string]*flight),
+		dispatch: dispatch,
+		timeout:  timeout,
+	}
+}
+
+// Do waits for work for the request, joining the flight for its hash if there is one
+// A request for a harder difficulty than the flight's upgrades it, so every waiter gets work good enough for them
+// A request with a higher priority upgrades it too, so a live request isn't stuck behind a precache one
+func (g *flightGroup) Do(request serializableModels.ClientMessage) (*serializableModels.ClientWorkResponse, error) {
+	f, waiter := g.join(request)
+	select {
+	case <-f.done:
+		if waiter != f.credited && !waiter.request.Precache && f.err == nil {
+			// Somebody else's request generated this work, so the service gets no work result for it
+			if err := database.GetRedisDB().IncrementCoalescedRequests(waiter.request.RequesterEmail); err != nil {
+				klog.Errorf("Error counting coalesced request for %s: %v", waiter.request.RequesterEmail, err)
+			}
+		}
+		return f.response, f.err
+	case <-waiter.cancel:
+		g.leave(f, waiter)
+		return nil, ErrWorkCancelled
+	}
+}
+
+func (g *flightGroup) join(request serializableModels.ClientMessage) (*flight, *flightWaiter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	waiter := &flightWaiter{
+		request: request,
+		cancel:  make(chan struct{}),
+	}
+	key := strings.ToUpper(request.Hash)
+	f, ok := g.flights[key]
+	if !ok {
+		f = &flight{
+			hash:       request.Hash,
+			difficulty: request.Difficulty,
+			priority:   request.EffectivePriority(),
+			waiters:    []*flightWaiter{waiter},
+			interrupt:  make(chan struct{}, 1),
+			done:       make(chan struct{}),
+		}
+		g.flights[key] = f
+		go g.run(f)
+		return f, waiter
+	}
+	f.waiters = append(f.waiters, waiter)
+	if request.Difficulty > f.difficulty {
+		klog.V(3).Infof("Upgrading request for %s to %s", f.hash, request.Difficulty)
+		f.difficulty = request.Difficulty
+		f.signal()
+	}
+	if priority := request.EffectivePriority(); priority.Before(f.priority) {
+		klog.V(3).Infof("Upgrading request for %s to %s priority", f.hash, priority)
+		f.priority = priority
+		f.signal()
+	}
+	return f, waiter
+}
+
+// Stop waiting, the flight stops when nobody is waiting for it
+func (g *flightGroup) leave(f *flight, waiter *flightWaiter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, w := range f.waiters {
+		if w == waiter {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(f.waiters) == 0 {
+		f.signal()
+	}
+}
+
+// Cancel the requester's waiters for the hash, returns how many were cancelled
+func (g *flightGroup) Cancel(requesterEmail string, hash string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f, ok := g.flights[strings.ToUpper(hash)]
+	if !ok {
+		return 0
+	}
+	cancelled := 0
+	for _, waiter := range f.waiters {
+		if waiter.request.RequesterEmail != requesterEmail || waiter.cancelled {
+			continue
+		}
+		close(waiter.cancel)
+		waiter.cancelled = true
+		cancelled++
+	}
+	return cancelled
+}
+
+// Must be called with the lock held
+func (f *flight) signal() {
+	select {
+	case f.interrupt <- struct{}{}:
+	default:
+	}
+}
+
+// Request work until it meets the flight's difficulty, nobody is waiting anymore, or we run out of time
+func (g *flightGroup) run(f *flight) {
+	deadline := time.Now().Add(g.timeout)
+	for {
+		request, ok := g.nextAttempt(f)
+		if !ok {
+			return
+		}
+		response, err := g.dispatch(request, f.interrupt, time.Until(deadline))
+		if err == nil && g.complete(f, response) {
+			return
+		} else if err != nil && !errors.Is(err, errFlightInterrupted) {
+			g.finish(f, nil, err)
+			return
+		}
+		// Upgraded, or the work was for the difficulty from before an upgrade
+		if time.Now().After(deadline) {
+			g.finish(f, nil, errors.New("timeout"))
+			return
+		}
+	}
+}
+
+// Build the request for the next attempt from the waiters
+// Returns false and finishes the flight if nobody is waiting
+func (g *flightGroup) nextAttempt(f *flight) (serializableModels.ClientMessage, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Don't let an interrupt from before this attempt stop it
+	select {
+	case <-f.interrupt:
+	default:
+	}
+	if len(f.waiters) == 0 {
+		g.finishLocked(f, nil, ErrWorkCancelled)
+		return serializableModels.ClientMessage{}, false
+	}
+	// Credit the first service that asked, precache only gets credit if it's all that's waiting
+	f.credited = f.waiters[0]
+	for _, waiter := range f.waiters {
+		if !waiter.request.Precache {
+			f.credited = waiter
+			break
+		}
+	}
+	request := f.credited.request
+	request.RequestID = uuid.NewString()
+	request.Difficulty = f.difficulty
+	request.DifficultyMultiplier = f.difficulty.CeilMultiplier()
+	request.Priority = f.priority
+	for _, waiter := range f.waiters {
+		if request.Network == "" {
+			request.Network = waiter.request.Network
+		}
+	}
+	return request, true
+}
+
+// Finish with the work if it meets the difficulty, which may have gone up while the work was on its way
+func (g *flightGroup) complete(f *flight, response *serializableModels.ClientWorkResponse) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !validation.IsWorkValid(f.hash, uint64(f.difficulty), response.Result) {
+		return false
+	}
+	g.finishLocked(f, response, nil)
+	return true
+}
+
+func (g *flightGroup) finish(f *flight, response *serializableModels.ClientWorkResponse, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.finishLocked(f, response, err)
+}
+
+// Must be called with the lock held
+func (g *flightGroup) finishLocked(f *flight, response *serializableModels.ClientWorkResponse, err error) {
+	key := strings.ToUpper(f.hash)
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	f.response = response
+	f.err = err
+	close(f.done)
+}
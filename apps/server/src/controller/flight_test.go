@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+// Meets x64 but not x800
+const flightTestHash = "3F93C5CD2E314FA16702189041E68E68C07B27961BF37F0B7705145BEFBA3AA3"
+const flightTestWork = "205452237a9b01f4"
+
+func flightTestRequest(requesterEmail string, multiplier float64) serializableModels.ClientMessage {
+	return serializableModels.ClientMessage{
+		RequesterEmail: requesterEmail,
+		MessageType:    serializableModels.WorkGenerate,
+		Hash:           flightTestHash,
+		Difficulty:     serializableModels.DifficultyFromMultiplier(multiplier),
+	}
+}
+
+// Dispatch that records its requests and answers when release is closed, or stops when interrupted
+type fakeDispatch struct {
+	mu       sync.Mutex
+	requests []serializableModels.ClientMessage
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func newFakeDispatch() *fakeDispatch {
+	return &fakeDispatch{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (d *fakeDispatch) dispatch(request serializableModels.ClientMessage, interrupt <-chan struct{}, timeout time.Duration) (*serializableModels.ClientWorkResponse, error) {
+	d.mu.Lock()
+	d.requests = append(d.requests, request)
+	d.mu.Unlock()
+	select {
+	case d.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-d.release:
+		return &serializableModels.ClientWorkResponse{RequestID: request.RequestID, Hash: request.Hash, Result: flightTestWork}, nil
+	case <-interrupt:
+		return nil, errFlightInterrupted
+	case <-time.After(timeout):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (d *fakeDispatch) Requests() []serializableModels.ClientMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]serializableModels.ClientMessage{}, d.requests...)
+}
+
+type flightResult struct {
+	response *serializableModels.ClientWorkResponse
+	err      error
+}
+
+func doAsync(g *flightGroup, request serializableModels.ClientMessage) chan flightResult {
+	result := make(chan flightResult, 1)
+	go func() {
+		response, err := g.Do(request)
+		result <- flightResult{response, err}
+	}()
+	return result
+}
+
+// Wait until the group has this many waiters for the test hash
+func waitForWaiters(t *testing.T, g *flightGroup, n int) {
+	for i := 0; i < 100; i++ {
+		g.mu.Lock()
+		f, ok := g.flights[flightTestHash]
+		waiting := ok && len(f.waiters) == n
+		g.mu.Unlock()
+		if waiting {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d waiters", n)
+}
+
+func TestFlightSharesWork(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	d := newFakeDispatch()
+	g := newFlightGroup(d.dispatch, time.Minute)
+	before, _ := database.GetRedisDB().GetCoalescedRequests()
+
+	first := doAsync(g, flightTestRequest("service1", 1))
+	<-d.started
+	second := doAsync(g, flightTestRequest("service2", 1))
+	waitForWaiters(t, g, 2)
+	close(d.release)
+
+	for _, result := range []flightResult{<-first, <-second} {
+		utils.AssertEqual(t, nil, result.err)
+		utils.AssertEqual(t, flightTestWork, result.response.Result)
+	}
+	utils.AssertEqual(t, 1, len(d.Requests()))
+	// The first service's request got the work result, the second shared it
+	utils.AssertEqual(t, "service1", d.Requests()[0].RequesterEmail)
+	after, _ := database.GetRedisDB().GetCoalescedRequests()
+	utils.AssertEqual(t, before["service1"], after["service1"])
+	utils.AssertEqual(t, before["service2"]+1, after["service2"])
+}
+
+func TestFlightUpgrades(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	d := newFakeDispatch()
+	g := newFlightGroup(d.dispatch, time.Minute)
+
+	low := doAsync(g, flightTestRequest("service1", 1))
+	<-d.started
+	high := doAsync(g, flightTestRequest("service2", 64))
+	// Requested again at the higher difficulty
+	<-d.started
+	close(d.release)
+
+	utils.AssertEqual(t, nil, (<-low).err)
+	utils.AssertEqual(t, nil, (<-high).err)
+	requests := d.Requests()
+	utils.AssertEqual(t, 2, len(requests))
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(64), requests[1].Difficulty)
+	utils.AssertEqual(t, 64, requests[1].DifficultyMultiplier)
+	utils.AssertEqual(t, true, requests[0].RequestID != requests[1].RequestID)
+}
+
+func TestFlightUpgradesPriority(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	d := newFakeDispatch()
+	g := newFlightGroup(d.dispatch, time.Minute)
+
+	precache := flightTestRequest("precache", 1)
+	precache.Precache = true
+	background := doAsync(g, precache)
+	<-d.started
+	live := doAsync(g, flightTestRequest("service1", 1))
+	// Requested again so it isn't queued behind other precache requests
+	<-d.started
+	close(d.release)
+
+	utils.AssertEqual(t, nil, (<-background).err)
+	utils.AssertEqual(t, nil, (<-live).err)
+	requests := d.Requests()
+	utils.AssertEqual(t, 2, len(requests))
+	utils.AssertEqual(t, serializableModels.PriorityPrecache, requests[0].Priority)
+	utils.AssertEqual(t, serializableModels.PriorityInteractive, requests[1].Priority)
+	utils.AssertEqual(t, "service1", requests[1].RequesterEmail)
+}
+
+func TestFlightRetriesWorkBelowDifficulty(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	d := newFakeDispatch()
+	close(d.release)
+	g := newFlightGroup(d.dispatch, 100*time.Millisecond)
+
+	// The work is never good enough, so we keep asking until we run out of time
+	_, err := g.Do(flightTestRequest("service1", 800))
+	utils.AssertEqual(t, "timeout", err.Error())
+	utils.AssertEqual(t, true, len(d.Requests()) > 1)
+}
+
+func TestFlightCancel(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	d := newFakeDispatch()
+	g := newFlightGroup(d.dispatch, time.Minute)
+
+	mine := doAsync(g, flightTestRequest("mine", 1))
+	<-d.started
+	theirs := doAsync(g, flightTestRequest("theirs", 1))
+	waitForWaiters(t, g, 2)
+
+	utils.AssertEqual(t, 1, g.Cancel("mine", flightTestHash))
+	utils.AssertEqual(t, ErrWorkCancelled, (<-mine).err)
+	waitForWaiters(t, g, 1)
+	// Other requesters still get their work
+	close(d.release)
+	utils.AssertEqual(t, nil, (<-theirs).err)
+
+	// Nothing left to cancel
+	utils.AssertEqual(t, 0, g.Cancel("mine", flightTestHash))
+}
+
+func TestFlightStopsWhenEverybodyCancels(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	d := newFakeDispatch()
+	g := newFlightGroup(d.dispatch, time.Minute)
+
+	mine := doAsync(g, flightTestRequest("mine", 1))
+	<-d.started
+	utils.AssertEqual(t, 1, g.Cancel("mine", flightTestHash))
+	utils.AssertEqual(t, ErrWorkCancelled, (<-mine).err)
+
+	// The flight is gone, so the next request starts a new one
+	for i := 0; i < 100; i++ {
+		g.mu.Lock()
+		_, ok := g.flights[flightTestHash]
+		g.mu.Unlock()
+		if !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Flight wasn't stopped")
+}
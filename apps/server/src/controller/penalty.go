@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	"github.com/bananocoin/boompow/libs/utils"
+	"k8s.io/klog/v2"
+)
+
+type PenaltyAction int
+
+const (
+	PenaltyNone PenaltyAction = iota
+	// Stop sending work to the worker
+	PenaltyExclude
+	// Close the worker's connections and refuse new ones
+	PenaltyDisconnect
+	// Ban the account
+	PenaltyBan
+)
+
+// PenaltyThresholds are the number of invalid results after which each penalty kicks in
+type PenaltyThresholds struct {
+	Exclude    int
+	Disconnect int
+	Ban        int
+}
+
+func NewPenaltyThresholds() *PenaltyThresholds {
+	return &PenaltyThresholds{
+		Exclude:    getThreshold("BPOW_INVALID_WORK_EXCLUDE_THRESHOLD", 3),
+		Disconnect: getThreshold("BPOW_INVALID_WORK_DISCONNECT_THRESHOLD", 5),
+		Ban:        getThreshold("BPOW_INVALID_WORK_BAN_THRESHOLD", 10),
+	}
+}
+
+func getThreshold(key string, fallback int) int {
+	threshold, err := strconv.Atoi(utils.GetEnv(key, strconv.Itoa(fallback)))
+	if err != nil || threshold < 1 {
+		klog.Errorf("Invalid %s, using default %d", key, fallback)
+		return fallback
+	}
+	return threshold
+}
+
+// ActionFor returns the harshest penalty for this many invalid results
+func (p *PenaltyThresholds) ActionFor(invalidResultCount int) PenaltyAction {
+	switch {
+	case invalidResultCount >= p.Ban:
+		return PenaltyBan
+	case invalidResultCount >= p.Disconnect:
+		return PenaltyDisconnect
+	case invalidResultCount >= p.Exclude:
+		return PenaltyExclude
+	default:
+		return PenaltyNone
+	}
+}
+
+// Count an invalid result against the client's account and apply whatever penalty it earned
+func (h *Hub) penalize(client *Client, hash string) {
+	user, err := h.UserRepo.IncrementInvalidResultCount(client.Email)
+	if err != nil {
+		klog.Errorf("Error incrementing invalid result count for %s: %v", client.Email, err)
+		return
+	}
+	action := h.Penalties.ActionFor(user.InvalidResultCount)
+	// Only the result that crosses a threshold records the step, later ones just enforce it
+	previous := h.Penalties.ActionFor(user.InvalidResultCount - 1)
+	reason := fmt.Sprintf("%d invalid results, last for %s from %s", user.InvalidResultCount, hash, client.IPAddress)
+
+	var auditAction models.AuditAction
+	switch action {
+	case PenaltyNone:
+		return
+	case PenaltyExclude:
+		auditAction = models.AUDIT_WORKER_EXCLUDED
+	case PenaltyDisconnect:
+		auditAction = models.AUDIT_WORKER_DISCONNECTED
+	case PenaltyBan:
+		auditAction = models.AUDIT_USER_BANNED
+	}
+	if action != previous {
+		klog.Warningf("Penalizing %s (%s)", client.Email, reason)
+		// A ban is saved with its audit log
+		if action == PenaltyBan {
+			if err := h.UserRepo.SetBanned(user.ID, true, &repository.AuditEntry{Action: auditAction, Reason: reason}); err != nil {
+				klog.Errorf("Error banning %s: %v", client.Email, err)
+			}
+		} else if err := h.AuditRepo.RecordAction(user.ID, nil, auditAction, reason); err != nil {
+			klog.Errorf("Error recording audit log for %s: %v", client.Email, err)
+		}
+	}
+
+	// Enforce on every connection of this account
+	toDisconnect := []*Client{}
+	func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for c := range h.Clients {
+			if c.Email != client.Email {
+				continue
+			}
+			c.Excluded = true
+			if action >= PenaltyDisconnect {
+				toDisconnect = append(toDisconnect, c)
+			}
+		}
+	}()
+	for _, c := range toDisconnect {
+		h.Unregister <- c
+	}
+}
@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestPenaltyThresholds(t *testing.T) {
+	thresholds := &PenaltyThresholds{
+		Exclude:    3,
+		Disconnect: 5,
+		Ban:        10,
+	}
+
+	utils.AssertEqual(t, PenaltyNone, thresholds.ActionFor(0))
+	utils.AssertEqual(t, PenaltyNone, thresholds.ActionFor(2))
+	utils.AssertEqual(t, PenaltyExclude, thresholds.ActionFor(3))
+	utils.AssertEqual(t, PenaltyExclude, thresholds.ActionFor(4))
+	utils.AssertEqual(t, PenaltyDisconnect, thresholds.ActionFor(5))
+	utils.AssertEqual(t, PenaltyBan, thresholds.ActionFor(10))
+	utils.AssertEqual(t, PenaltyBan, thresholds.ActionFor(100))
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/net"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+)
+
+// How long we watch an account for the block after the one a service requested work for
+const precacheWatchExpiry = config.PRECACHE_VALID_MINUTES * time.Minute
+
+// A hash a service requested work for, and the account it belongs to
+type watchedHash struct {
+	account   string
+	watchedAt time.Time
+}
+
+// Precacher watches a network's node for confirmed blocks, and generates work for the next block of accounts services requested work for
+type Precacher struct {
+	Network  *config.Network
+	workRepo repository.WorkRepo
+	// Accounts we get confirmations for, nil if the network has no RPC to look accounts up, then we get every confirmation
+	accounts *net.AccountFilter
+	// Hashes waiting for us to look up their account
+	lookups chan string
+	mu      sync.Mutex
+	watched map[string]watchedHash
+	// For node RPC calls
+	httpClient *http.Client
+}
+
+func NewPrecacher(network *config.Network, workRepo repository.WorkRepo) *Precacher {
+	p := &Precacher{
+		Network:  network,
+		workRepo: workRepo,
+		lookups:  make(chan string, 100),
+		watched:  make(map[string]watchedHash),
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+	if network.RPCURL != "" {
+		p.accounts = net.NewAccountFilter()
+	}
+	return p
+}
+
+// Start watching the node
+func (p *Precacher) Start() {
+	callbackChan := make(chan *net.WSCallbackMsg, 100)
+	go net.StartNanoWSClient(p.Network.WSURL, &callbackChan, p.accounts)
+	if p.accounts != nil {
+		go p.lookupWorker()
+	}
+	go func() {
+		for msg := range callbackChan {
+			p.handleConfirmation(msg)
+		}
+	}()
+}
+
+// Watch the account of a hash a service requested work for, so we notice its next block
+func (p *Precacher) Watch(hash string) {
+	if p.accounts == nil {
+		return
+	}
+	select {
+	case p.lookups <- strings.ToUpper(hash):
+	default:
+		klog.Errorf("Precache lookups for %s are backed up, not watching %s", p.Network.Name, hash)
+	}
+}
+
+// Look up the accounts of watched hashes, and stop watching accounts that haven't had a block in a while
+func (p *Precacher) lookupWorker() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case hash := <-p.lookups:
+			// The node of another network won't know the hash
+			account, err := net.BlockAccount(p.httpClient, p.Network.RPCURL, hash)
+			if err != nil {
+				klog.V(3).Infof("Not watching %s on %s: %v", hash, p.Network.Name, err)
+				continue
+			}
+			p.mu.Lock()
+			if _, ok := p.watched[hash]; !ok {
+				p.watched[hash] = watchedHash{account: account, watchedAt: time.Now()}
+				p.accounts.Add(account)
+			}
+			p.mu.Unlock()
+		case <-ticker.C:
+			p.expire(time.Now().Add(-precacheWatchExpiry))
+		}
+	}
+}
+
+// Stop watching hashes watched before the cutoff
+func (p *Precacher) expire(cutoff time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for hash, watched := range p.watched {
+		if watched.watchedAt.Before(cutoff) {
+			delete(p.watched, hash)
+			p.accounts.Remove(watched.account)
+		}
+	}
+}
+
+// Stop watching a hash once its next block confirmed
+func (p *Precacher) unwatch(hash string) {
+	if p.accounts == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if watched, ok := p.watched[hash]; ok {
+		delete(p.watched, hash)
+		p.accounts.Remove(watched.account)
+	}
+}
+
+func (p *Precacher) handleConfirmation(msg *net.WSCallbackMsg) {
+	previous := strings.ToUpper(msg.Block.Previous)
+	p.unwatch(previous)
+	// Without a filter most blocks are for accounts we never watched, so they aren't misses
+	ok, err := database.GetRedisDB().TakePrecache(previous, precacheWatchExpiry, p.accounts != nil)
+	if err != nil {
+		klog.Errorf("Error checking precache for %s: %v", previous, err)
+		return
+	} else if !ok {
+		return
+	}
+
+	// We can't know if the next block is a send or a receive until it's published, send work is good for both
+	difficulty := p.Network.SendDifficulty
+
+	// We want to precache this if we don't have it
+	_, err = p.workRepo.RetrieveWorkFromCache(msg.Hash, uint64(difficulty))
+	if err == nil {
+		// Already cached
+		return
+	}
+
+	workRequest := serializableModels.ClientMessage{
+		RequesterEmail: p.Network.PrecacheRequester,
+		BlockAward:     true,
+		MessageType:    serializableModels.WorkGenerate,
+		RequestID:      uuid.NewString(),
+		Hash:           msg.Hash,
+		Difficulty:     difficulty,
+		Network:        p.Network.Name,
+		Precache:       true,
+		Priority:       serializableModels.PriorityPrecache,
+	}
+
+	BroadcastWorkRequestAndWait(workRequest)
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func testNetwork() *config.Network {
+	return &config.Network{
+		Name:              "nano",
+		SendDifficulty:    serializableModels.DifficultyFromMultiplier(64),
+		ReceiveDifficulty: serializableModels.DifficultyFromMultiplier(1),
+		RPCURL:            "http://localhost:7076",
+		MaxDifficulty:     serializableModels.DifficultyFromMultiplier(64),
+	}
+}
+
+func TestWatchPrecacheNetwork(t *testing.T) {
+	nano := NewPrecacher(testNetwork(), nil)
+	bananoNetwork := testNetwork()
+	bananoNetwork.Name = "banano"
+	banano := NewPrecacher(bananoNetwork, nil)
+	w := &WorkRequester{Precachers: []*Precacher{nano, banano}}
+
+	// Only the request's network looks the hash up
+	w.watchPrecache("A", "banano")
+	utils.AssertEqual(t, 0, len(nano.lookups))
+	utils.AssertEqual(t, 1, len(banano.lookups))
+	// We don't know which node has it otherwise
+	w.watchPrecache("B", "")
+	utils.AssertEqual(t, 1, len(nano.lookups))
+	utils.AssertEqual(t, 2, len(banano.lookups))
+}
+
+func TestPrecacherWatchExpiry(t *testing.T) {
+	p := NewPrecacher(testNetwork(), nil)
+	p.watched["A"] = watchedHash{account: "nano_1", watchedAt: time.Now().Add(-2 * precacheWatchExpiry)}
+	p.watched["B"] = watchedHash{account: "nano_2", watchedAt: time.Now()}
+	p.accounts.Add("nano_1")
+	p.accounts.Add("nano_2")
+
+	p.expire(time.Now().Add(-precacheWatchExpiry))
+	utils.AssertEqual(t, false, p.accounts.Contains("nano_1"))
+	utils.AssertEqual(t, true, p.accounts.Contains("nano_2"))
+
+	p.unwatch("B")
+	utils.AssertEqual(t, false, p.accounts.Contains("nano_2"))
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"k8s.io/klog/v2"
+)
+
+// Names of the limits in a ServiceQuota, as reported in errors
+const (
+	QuotaRequestsPerMinute = "requestsPerMinute"
+	QuotaRequestsPerDay    = "requestsPerDay"
+	QuotaMaxInFlight       = "maxInFlight"
+	QuotaMaxDifficulty     = "maxDifficulty"
+)
+
+// QuotaError is returned when a request would take a service over one of its limits
+type QuotaError struct {
+	Limit string
+	Max   string
+	// When the limit resets, zero if waiting doesn't help
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota_exceeded:%s is limited to %s", e.Limit, e.Max)
+}
+
+// acquireQuota checks the request against the service's quota and counts it
+// The returned release must be called once the request is done, if there's no error
+func acquireQuota(requester *models.User, difficulty serializableModels.Difficulty, now time.Time) (func(), error) {
+	quota := requester.Quota
+	if quota.MaxDifficulty != 0 && difficulty > quota.MaxDifficulty {
+		return nil, &QuotaError{Limit: QuotaMaxDifficulty, Max: quota.MaxDifficulty.String()}
+	}
+
+	redis := database.GetRedisDB()
+	release := func() {}
+	if quota.MaxInFlight > 0 {
+		ok, err := redis.AcquireQuotaInFlight(requester.Email, quota.MaxInFlight)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, &QuotaError{Limit: QuotaMaxInFlight, Max: fmt.Sprint(quota.MaxInFlight)}
+		}
+		release = func() {
+			if err := redis.ReleaseQuotaInFlight(requester.Email); err != nil {
+				klog.Errorf("Error releasing in-flight quota for %s: %v", requester.Email, err)
+			}
+		}
+	}
+
+	if quota.RequestsPerMinute <= 0 && quota.RequestsPerDay <= 0 {
+		return release, nil
+	}
+	minute, day, err := redis.IncrementQuotaRequests(requester.Email, now)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	var exceeded *QuotaError
+	if quota.RequestsPerMinute > 0 && minute > quota.RequestsPerMinute {
+		exceeded = &QuotaError{Limit: QuotaRequestsPerMinute, Max: fmt.Sprint(quota.RequestsPerMinute), RetryAfter: now.Truncate(time.Minute).Add(time.Minute).Sub(now)}
+	} else if quota.RequestsPerDay > 0 && day > quota.RequestsPerDay {
+		midnight := time.Date(now.UTC().Year(), now.UTC().Month(), now.UTC().Day()+1, 0, 0, 0, 0, time.UTC)
+		exceeded = &QuotaError{Limit: QuotaRequestsPerDay, Max: fmt.Sprint(quota.RequestsPerDay), RetryAfter: midnight.Sub(now)}
+	}
+	if exceeded != nil {
+		release()
+		// Rejected requests don't use up quota
+		if err := redis.DecrementQuotaRequests(requester.Email, now); err != nil {
+			klog.Errorf("Error returning quota for %s: %v", requester.Email, err)
+		}
+		return nil, exceeded
+	}
+	return release, nil
+}
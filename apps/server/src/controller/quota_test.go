@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func quotaErrorLimit(err error) string {
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErr.Limit
+	}
+	return ""
+}
+
+func TestQuotaUnlimited(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	requester := &models.User{Email: "quota-unlimited@service.com"}
+	for i := 0; i < 10; i++ {
+		release, err := acquireQuota(requester, serializableModels.DifficultyFromMultiplier(64), time.Now())
+		utils.AssertEqual(t, nil, err)
+		release()
+	}
+}
+
+func TestQuotaMaxDifficulty(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	requester := &models.User{
+		Email: "quota-difficulty@service.com",
+		Quota: models.ServiceQuota{MaxDifficulty: serializableModels.DifficultyFromMultiplier(8)},
+	}
+	release, err := acquireQuota(requester, serializableModels.DifficultyFromMultiplier(8), time.Now())
+	utils.AssertEqual(t, nil, err)
+	release()
+	_, err = acquireQuota(requester, serializableModels.DifficultyFromMultiplier(16), time.Now())
+	utils.AssertEqual(t, QuotaMaxDifficulty, quotaErrorLimit(err))
+}
+
+func TestQuotaRequestsPerMinute(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	requester := &models.User{
+		Email: "quota-minute@service.com",
+		Quota: models.ServiceQuota{RequestsPerMinute: 2, RequestsPerDay: 3},
+	}
+	now := time.Date(2022, 1, 1, 12, 0, 15, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		release, err := acquireQuota(requester, 0, now)
+		utils.AssertEqual(t, nil, err)
+		release()
+	}
+	_, err := acquireQuota(requester, 0, now)
+	utils.AssertEqual(t, QuotaRequestsPerMinute, quotaErrorLimit(err))
+	utils.AssertEqual(t, 45*time.Second, err.(*QuotaError).RetryAfter)
+
+	// The rejected request didn't count
+	usage, err := database.GetRedisDB().GetQuotaUsage(requester.Email, now)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, usage.RequestsThisMinute)
+	utils.AssertEqual(t, 2, usage.RequestsToday)
+
+	// Next minute there's room again, until the day runs out
+	release, err := acquireQuota(requester, 0, now.Add(time.Minute))
+	utils.AssertEqual(t, nil, err)
+	release()
+	_, err = acquireQuota(requester, 0, now.Add(2*time.Minute))
+	utils.AssertEqual(t, QuotaRequestsPerDay, quotaErrorLimit(err))
+	utils.AssertEqual(t, 12*time.Hour-2*time.Minute-15*time.Second, err.(*QuotaError).RetryAfter)
+}
+
+func TestQuotaMaxInFlight(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	requester := &models.User{
+		Email: "quota-inflight@service.com",
+		Quota: models.ServiceQuota{MaxInFlight: 1},
+	}
+	release, err := acquireQuota(requester, 0, time.Now())
+	utils.AssertEqual(t, nil, err)
+	_, err = acquireQuota(requester, 0, time.Now())
+	utils.AssertEqual(t, QuotaMaxInFlight, quotaErrorLimit(err))
+
+	usage, _ := database.GetRedisDB().GetQuotaUsage(requester.Email, time.Now())
+	utils.AssertEqual(t, 1, usage.InFlight)
+	release()
+	release, err = acquireQuota(requester, 0, time.Now())
+	utils.AssertEqual(t, nil, err)
+	release()
+	usage, _ = database.GetRedisDB().GetQuotaUsage(requester.Email, time.Now())
+	utils.AssertEqual(t, 0, usage.InFlight)
+}
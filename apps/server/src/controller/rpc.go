@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	"github.com/bananocoin/boompow/apps/server/src/middleware"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/bananocoin/boompow/libs/utils/validation"
+	"k8s.io/klog/v2"
+)
+
+// Largest request body we'll read, node RPC requests are tiny
+const maxRPCBodyBytes = 64 * 1024
+
+// Request in the same format as the nano/banano node RPC
+// Multipliers are relative to the base difficulty fffffe0000000000, like everywhere else in BoomPoW
+type rpcRequest struct {
+	Action     string `json:"action"`
+	Hash       string `json:"hash"`
+	Work       string `json:"work"`
+	Difficulty string `json:"difficulty"`
+	Multiplier string `json:"multiplier"`
+	// Not in the node RPC, optional, which network the work is for
+	Network string `json:"network"`
+}
+
+type rpcWorkGenerateResponse struct {
+	Hash       string `json:"hash"`
+	Work       string `json:"work"`
+	Difficulty string `json:"difficulty"`
+	Multiplier string `json:"multiplier"`
+}
+
+type rpcWorkValidateResponse struct {
+	// Only included if the request had a difficulty or multiplier
+	Valid        string `json:"valid,omitempty"`
+	ValidAll     string `json:"valid_all"`
+	ValidReceive string `json:"valid_receive"`
+	Difficulty   string `json:"difficulty"`
+	Multiplier   string `json:"multiplier"`
+}
+
+type rpcSuccessResponse struct {
+	Success string `json:"success"`
+}
+
+type rpcErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// RPCHandler serves work_generate, work_validate and work_cancel for wallets and tools that speak the node RPC
+// Requires a service token in the Authorization header, same as the workGenerate mutation
+func RPCHandler(workRequester *WorkRequester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requester := middleware.AuthorizedServiceToken(r.Context())
+		if requester == nil {
+			writeRPCResponse(w, http.StatusForbidden, rpcErrorResponse{Error: "access denied"})
+			return
+		}
+
+		var request rpcRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRPCBodyBytes)).Decode(&request); err != nil {
+			writeRPCResponse(w, http.StatusBadRequest, rpcErrorResponse{Error: "Unable to parse JSON"})
+			return
+		}
+
+		var response interface{}
+		var err error
+		switch request.Action {
+		case "work_generate":
+			// Work requested from no_reward addresses isn't rewarded
+			response, err = rpcWorkGenerate(workRequester, requester.User, &request, !middleware.IPNoReward(r.Context()))
+		case "work_validate":
+			response, err = rpcWorkValidate(&request)
+		case "work_cancel":
+			response, err = rpcWorkCancel(requester.User, &request)
+		default:
+			err = errors.New("Unknown command")
+		}
+		if err != nil {
+			// The node reports errors with a 200
+			writeRPCResponse(w, http.StatusOK, rpcErrorResponse{Error: err.Error()})
+			return
+		}
+		writeRPCResponse(w, http.StatusOK, response)
+	}
+}
+
+func writeRPCResponse(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		klog.Errorf("Error writing RPC response %v", err)
+	}
+}
+
+// Wallets that don't name a network get banano's thresholds, it's the network BoomPoW is for
+const rpcDefaultNetwork = "banano"
+
+// The network the request is for, the default or else the first configured one if it doesn't say
+func rpcNetwork(request *rpcRequest) (*config.Network, error) {
+	if request.Network != "" {
+		network, err := requestNetwork(request.Network)
+		if err != nil {
+			return nil, errors.New("Unknown network")
+		}
+		return network, nil
+	}
+	if network := config.GetNetwork(rpcDefaultNetwork); network != nil {
+		return network, nil
+	}
+	return config.GetNetworks()[0], nil
+}
+
+// The difficulty the request asks for, the network's send threshold like the node if it doesn't say
+// Returns whether one was given
+func rpcDifficulty(request *rpcRequest, network *config.Network) (uint64, bool, error) {
+	if request.Difficulty != "" {
+		difficulty, err := strconv.ParseUint(request.Difficulty, 16, 64)
+		if err != nil || len(request.Difficulty) != 16 {
+			return 0, false, errors.New("Bad difficulty")
+		}
+		return difficulty, true, nil
+	}
+	if request.Multiplier != "" {
+		multiplier, err := strconv.ParseFloat(request.Multiplier, 64)
+		if err != nil || multiplier <= 0 || math.IsInf(multiplier, 0) || math.IsNaN(multiplier) {
+			return 0, false, errors.New("Bad multiplier")
+		}
+		return validation.MultiplierToDifficulty(multiplier), true, nil
+	}
+	return uint64(network.SendDifficulty), false, nil
+}
+
+func formatDifficulty(difficulty uint64) string {
+	return fmt.Sprintf("%016x", difficulty)
+}
+
+func formatMultiplier(difficulty uint64) string {
+	return strconv.FormatFloat(validation.DifficultyToMultiplier(difficulty), 'f', 6, 64)
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func rpcWorkGenerate(workRequester *WorkRequester, requester *models.User, request *rpcRequest, blockAward bool) (*rpcWorkGenerateResponse, error) {
+	network, err := rpcNetwork(request)
+	if err != nil {
+		return nil, err
+	}
+	difficulty, _, err := rpcDifficulty(request, network)
+	if err != nil {
+		return nil, err
+	}
+	if serializableModels.Difficulty(difficulty) > network.MaxDifficulty {
+		return nil, errors.New("Difficulty above config maximum")
+	}
+
+	work, err := workRequester.RequestWork(requester, request.Hash, serializableModels.Difficulty(difficulty), request.Network, blockAward)
+	if errors.Is(err, ErrInvalidHash) {
+		return nil, errors.New("Bad block hash")
+	} else if errors.Is(err, ErrWorkCancelled) {
+		return nil, errors.New("Cancelled")
+	} else if quotaErr := (*QuotaError)(nil); errors.As(err, &quotaErr) {
+		return nil, fmt.Errorf("Quota exceeded, %s is limited to %s", quotaErr.Limit, quotaErr.Max)
+	} else if err != nil {
+		return nil, err
+	}
+
+	value, err := validation.WorkValue(request.Hash, work)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcWorkGenerateResponse{
+		Hash:       strings.ToUpper(request.Hash),
+		Work:       work,
+		Difficulty: formatDifficulty(value),
+		Multiplier: formatMultiplier(value),
+	}, nil
+}
+
+// A block hash is 32 bytes of hex, checked up front so we answer like the node does
+func rpcValidHash(hash string) bool {
+	decoded, err := hex.DecodeString(hash)
+	return err == nil && len(decoded) == 32
+}
+
+func rpcWorkValidate(request *rpcRequest) (*rpcWorkValidateResponse, error) {
+	if !rpcValidHash(request.Hash) {
+		return nil, errors.New("Bad block hash")
+	}
+	network, err := rpcNetwork(request)
+	if err != nil {
+		return nil, err
+	}
+	difficulty, explicit, err := rpcDifficulty(request, network)
+	if err != nil {
+		return nil, err
+	}
+	value, err := validation.WorkValue(request.Hash, request.Work)
+	if err != nil {
+		return nil, errors.New("Bad work")
+	}
+
+	response := &rpcWorkValidateResponse{
+		// Sends need the most work, so work good for a send is good for any block
+		ValidAll:     formatBool(value >= uint64(network.SendDifficulty)),
+		ValidReceive: formatBool(value >= uint64(network.ReceiveDifficulty)),
+		Difficulty:   formatDifficulty(value),
+		Multiplier:   formatMultiplier(value),
+	}
+	if explicit {
+		response.Valid = formatBool(value >= difficulty)
+	}
+	return response, nil
+}
+
+func rpcWorkCancel(requester *models.User, request *rpcRequest) (*rpcSuccessResponse, error) {
+	if !rpcValidHash(request.Hash) {
+		return nil, errors.New("Bad block hash")
+	}
+	// Like the node, it's not an error if there was nothing to cancel
+	CancelWorkRequest(requester.Email, request.Hash)
+	return &rpcSuccessResponse{Success: ""}, nil
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestRPCDifficulty(t *testing.T) {
+	banano := config.GetNetwork("banano")
+	nano := config.GetNetwork("nano")
+
+	// Like the node, the send threshold when the request doesn't say
+	difficulty, explicit, err := rpcDifficulty(&rpcRequest{}, banano)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, explicit)
+	utils.AssertEqual(t, uint64(0xfffffe0000000000), difficulty)
+	difficulty, _, err = rpcDifficulty(&rpcRequest{}, nano)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, uint64(0xfffffff800000000), difficulty)
+
+	difficulty, explicit, err = rpcDifficulty(&rpcRequest{Difficulty: "fffffff800000000"}, banano)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, explicit)
+	utils.AssertEqual(t, uint64(0xfffffff800000000), difficulty)
+
+	difficulty, _, err = rpcDifficulty(&rpcRequest{Multiplier: "64"}, banano)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, uint64(0xfffffff800000000), difficulty)
+
+	_, _, err = rpcDifficulty(&rpcRequest{Difficulty: "zz"}, banano)
+	utils.AssertEqual(t, true, err != nil)
+	_, _, err = rpcDifficulty(&rpcRequest{Multiplier: "-1"}, banano)
+	utils.AssertEqual(t, true, err != nil)
+}
+
+func TestRPCNetwork(t *testing.T) {
+	network, err := rpcNetwork(&rpcRequest{})
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "banano", network.Name)
+	network, err = rpcNetwork(&rpcRequest{Network: "Nano"})
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "nano", network.Name)
+	_, err = rpcNetwork(&rpcRequest{Network: "dogecoin"})
+	utils.AssertEqual(t, "Unknown network", err.Error())
+}
+
+func TestRPCWorkValidate(t *testing.T) {
+	request := &rpcRequest{
+		Hash: "3F93C5CD2E314FA16702189041E68E68C07B27961BF37F0B7705145BEFBA3AA3",
+		Work: "205452237a9b01f4",
+	}
+	response, err := rpcWorkValidate(request)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "1", response.ValidReceive)
+	utils.AssertEqual(t, "1", response.ValidAll)
+	utils.AssertEqual(t, "", response.Valid)
+
+	request.Multiplier = "800"
+	response, err = rpcWorkValidate(request)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "0", response.Valid)
+
+	// Work that's only good enough for a receive on nano
+	request = &rpcRequest{Hash: strings.Repeat("0", 64), Work: "000000000048f5b9", Network: "nano"}
+	response, err = rpcWorkValidate(request)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "1", response.ValidReceive)
+	utils.AssertEqual(t, "0", response.ValidAll)
+	// On banano every block takes the same
+	request.Network = "banano"
+	response, err = rpcWorkValidate(request)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "1", response.ValidAll)
+
+	request.Work = "zz"
+	_, err = rpcWorkValidate(request)
+	utils.AssertEqual(t, true, err != nil)
+	request.Network = "dogecoin"
+	_, err = rpcWorkValidate(request)
+	utils.AssertEqual(t, "Unknown network", err.Error())
+}
+
+func TestRPCRequiresServiceToken(t *testing.T) {
+	handler := RPCHandler(nil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`{"action":"work_validate"}`)))
+	utils.AssertEqual(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRPCWorkGenerateUnknownNetwork(t *testing.T) {
+	// Turned away before anything is requested
+	_, err := rpcWorkGenerate(nil, nil, &rpcRequest{Hash: strings.Repeat("A", 64), Network: "dogecoin"}, true)
+	utils.AssertEqual(t, "Unknown network", err.Error())
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"k8s.io/klog/v2"
+)
+
+// How long we wait for a service's webhook to respond
+const webhookTimeout = 10 * time.Second
+
+// Headers a webhook callback is signed with, see SignWebhook
+const (
+	WebhookTimestampHeader = "X-BoomPow-Timestamp"
+	WebhookSignatureHeader = "X-BoomPow-Signature"
+)
+
+// SignWebhook is the HMAC-SHA256 of the timestamp, a dot and the body, keyed with the service's secret
+// The timestamp is signed too so a callback can't be replayed later
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Special purpose ranges that aren't reachable on the internet, on top of what net.IP can tell us
+// Shared address space is where some clouds put their metadata service, like 100.100.100.200
+var webhookBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64 could reach any of the above
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Webhooks are sent from inside the cluster, so they may only go to public addresses
+func webhookAddressAllowed(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	// IPv4 mapped addresses are checked as IPv4
+	addr = addr.Unmap()
+	for _, prefix := range webhookBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checked on the address we actually connect to, after DNS, so a host can't resolve somewhere else once validated
+func webhookDialControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !webhookAddressAllowed(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: webhookDialControl,
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		// No proxy from the environment, it would be the one dialed and skip the check
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+		// A redirect could point anywhere, services have to give the final URL
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// ValidateWebhookURL checks that the URL is https and its host resolves to public addresses only
+func ValidateWebhookURL(webhookURL string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return fmt.Errorf("bad_request:webhook url must be https")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("bad_request:webhook host can't be resolved")
+	}
+	for _, addr := range addrs {
+		if !webhookAddressAllowed(addr.IP) {
+			return fmt.Errorf("bad_request:webhook host must be a public address")
+		}
+	}
+	return nil
+}
+
+// POST the status to the service, we don't retry since they can still poll for it
+func (w *WorkRequester) sendWebhook(requester *models.User, status *models.WorkRequestStatus) {
+	// Webhooks set before they had to be https aren't sent anymore
+	if !strings.HasPrefix(*requester.WebhookURL, "https://") {
+		klog.Warningf("Not calling webhook %s for %s, it isn't https", *requester.WebhookURL, status.RequestID)
+		return
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		klog.Errorf("Error serializing webhook for %s: %v", status.RequestID, err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, *requester.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		klog.Errorf("Error building webhook %s for %s: %v", *requester.WebhookURL, status.RequestID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if requester.WebhookSecret != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(*requester.WebhookSecret, timestamp, body))
+	}
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		klog.Errorf("Error calling webhook %s for %s: %v", *requester.WebhookURL, status.RequestID, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		klog.Errorf("Webhook %s for %s returned %s", *requester.WebhookURL, status.RequestID, resp.Status)
+	}
+}
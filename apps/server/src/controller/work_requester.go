@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/bananocoin/boompow/libs/utils"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+var ErrInvalidHash = errors.New("bad_request:invalid hash")
+var ErrUnknownNetwork = errors.New("bad_request:unknown network")
+
+// WorkRequester is the path every work request from a service goes through, whether it waits for the result or not
+type WorkRequester struct {
+	WorkRepo repository.WorkRepo
+	// Told about hashes we generated work for, so they can watch for the next block
+	Precachers []*Precacher
+	httpClient *http.Client
+}
+
+func NewWorkRequester(workRepo repository.WorkRepo) *WorkRequester {
+	return &WorkRequester{
+		WorkRepo:   workRepo,
+		httpClient: newWebhookClient(),
+	}
+}
+
+// Find the network a request says it's for, nil if it didn't say
+func requestNetwork(name string) (*config.Network, error) {
+	if name == "" {
+		return nil, nil
+	}
+	network := config.GetNetwork(name)
+	if network == nil {
+		return nil, ErrUnknownNetwork
+	}
+	return network, nil
+}
+
+// Hardest work we ask for on the network, or on any network if we don't know which
+func maxDifficultyFor(network *config.Network) serializableModels.Difficulty {
+	if network != nil {
+		return network.MaxDifficulty
+	}
+	return serializableModels.DifficultyFromMultiplier(config.MAX_WORK_DIFFICULTY_MULTIPLIER)
+}
+
+// Check the hash and network and alter the difficulty to be in a valid range if it isn't
+func normalizeWorkRequest(hash string, difficulty serializableModels.Difficulty, networkName string) (serializableModels.Difficulty, *config.Network, error) {
+	_, err := hex.DecodeString(hash)
+	if err != nil || len(hash) != 64 {
+		return 0, nil, ErrInvalidHash
+	}
+	network, err := requestNetwork(networkName)
+	if err != nil {
+		return 0, nil, err
+	}
+	// 1 is NANO receive and banano base difficulty
+	minDifficulty := serializableModels.DifficultyFromMultiplier(1)
+	maxDifficulty := maxDifficultyFor(network)
+	if difficulty < minDifficulty {
+		return minDifficulty, network, nil
+	} else if difficulty > maxDifficulty {
+		return maxDifficulty, network, nil
+	}
+	return difficulty, network, nil
+}
+
+// Build the message we send to workers, the network is recorded with the work result if we know it
+func newWorkRequest(requester *models.User, hash string, difficulty serializableModels.Difficulty, network *config.Network, blockAward bool) serializableModels.ClientMessage {
+	networkName := ""
+	if network != nil {
+		networkName = network.Name
+	}
+	priority := serializableModels.PriorityInteractive
+	if slices.Contains(utils.GetBulkServices(), requester.Email) {
+		priority = serializableModels.PriorityBulk
+	}
+	return serializableModels.ClientMessage{
+		RequesterEmail:       requester.Email,
+		BlockAward:           blockAward && !requester.RewardsExcluded,
+		MessageType:          serializableModels.WorkGenerate,
+		RequestID:            uuid.NewString(),
+		Hash:                 hash,
+		DifficultyMultiplier: difficulty.CeilMultiplier(),
+		Difficulty:           difficulty,
+		Priority:             priority,
+		Network:              networkName,
+	}
+}
+
+// RequestWork returns work for the hash, waiting for a worker to compute it if it isn't cached
+// The network is optional, empty if the service didn't say
+func (w *WorkRequester) RequestWork(requester *models.User, hash string, difficulty serializableModels.Difficulty, networkName string, blockAward bool) (string, error) {
+	difficulty, network, err := normalizeWorkRequest(hash, difficulty, networkName)
+	if err != nil {
+		return "", err
+	}
+	release, err := acquireQuota(requester, difficulty, time.Now())
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return w.retrieveOrGenerate(newWorkRequest(requester, hash, difficulty, network, blockAward))
+}
+
+// RequestWorkAsync returns a request ID right away
+// The result can be polled with GetWorkStatus, and is sent to the service's webhook if it has one
+func (w *WorkRequester) RequestWorkAsync(requester *models.User, hash string, difficulty serializableModels.Difficulty, networkName string, blockAward bool) (string, error) {
+	difficulty, network, err := normalizeWorkRequest(hash, difficulty, networkName)
+	if err != nil {
+		return "", err
+	}
+	release, err := acquireQuota(requester, difficulty, time.Now())
+	if err != nil {
+		return "", err
+	}
+	workRequest := newWorkRequest(requester, hash, difficulty, network, blockAward)
+	status := &models.WorkRequestStatus{
+		RequestID:            workRequest.RequestID,
+		Hash:                 hash,
+		DifficultyMultiplier: workRequest.DifficultyMultiplier,
+		Difficulty:           difficulty,
+		Status:               models.WORK_PENDING,
+		CreatedAt:            time.Now(),
+	}
+	if err := database.GetRedisDB().SetWorkStatus(requester.Email, status); err != nil {
+		release()
+		return "", err
+	}
+
+	go func() {
+		result, err := w.retrieveOrGenerate(workRequest)
+		release()
+		completedAt := time.Now()
+		status.CompletedAt = &completedAt
+		if err != nil {
+			status.Status = models.WORK_FAILED
+			status.Error = err.Error()
+		} else {
+			status.Status = models.WORK_COMPLETED
+			status.Result = result
+		}
+		if err := database.GetRedisDB().SetWorkStatus(requester.Email, status); err != nil {
+			klog.Errorf("Error saving work status %s: %v", status.RequestID, err)
+		}
+		if err := database.GetRedisDB().PublishWorkStatus(requester.Email, status); err != nil {
+			klog.Errorf("Error publishing work status %s: %v", status.RequestID, err)
+		}
+		if requester.WebhookURL != nil {
+			w.sendWebhook(requester, status)
+		}
+	}()
+
+	return workRequest.RequestID, nil
+}
+
+// GetWorkStatus returns the status of an asynchronous request made by this requester
+func (w *WorkRequester) GetWorkStatus(requester *models.User, requestID string) (*models.WorkRequestStatus, error) {
+	return database.GetRedisDB().GetWorkStatus(requester.Email, requestID)
+}
+
+// SubscribeCompletions receives this requester's asynchronous requests as they finish on any replica, until ctx is done
+func (w *WorkRequester) SubscribeCompletions(ctx context.Context, requester *models.User) (<-chan *models.WorkRequestStatus, error) {
+	return database.GetRedisDB().SubscribeWorkStatus(ctx, requester.Email)
+}
+
+func (w *WorkRequester) retrieveOrGenerate(workRequest serializableModels.ClientMessage) (string, error) {
+	// First try to retrieve from cache
+	// We only want cached results that meet the required difficulty
+	workResult, err := w.WorkRepo.RetrieveWorkFromCache(workRequest.Hash, workRequest.Threshold())
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if workResult != "" {
+		if err := database.GetRedisDB().IncrementCacheHits(workRequest.RequesterEmail); err != nil {
+			klog.Errorf("Error counting cache hit for %s: %v", workRequest.RequesterEmail, err)
+		}
+		return workResult, nil
+	}
+
+	resp, err := BroadcastWorkRequestAndWait(workRequest)
+	if err != nil {
+		return "", err
+	}
+
+	// Register the hash so we can precache the next block
+	if err := database.GetRedisDB().AddPrecache(strings.ToUpper(workRequest.Hash), workRequest.RequesterEmail, config.PRECACHE_MAX_ENTRIES); err != nil {
+		klog.Errorf("Error registering %s for precache: %v", workRequest.Hash, err)
+	}
+	w.watchPrecache(workRequest.Hash, workRequest.Network)
+
+	return resp.Result, nil
+}
+
+// Have the request's network watch for the hash's next block, every network if the request didn't name one
+// Each watch costs a lookup on the network's node
+func (w *WorkRequester) watchPrecache(hash string, networkName string) {
+	for _, precacher := range w.Precachers {
+		if networkName == "" || precacher.Network.Name == networkName {
+			precacher.Watch(hash)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestNormalizeWorkRequest(t *testing.T) {
+	hash := strings.Repeat("A", 64)
+
+	difficulty, _, err := normalizeWorkRequest(hash, 0, "")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(1), difficulty)
+
+	// Fractional multipliers are kept as they are
+	difficulty, _, err = normalizeWorkRequest(hash, serializableModels.DifficultyFromMultiplier(1.5), "")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(1.5), difficulty)
+
+	difficulty, _, err = normalizeWorkRequest(hash, serializableModels.DifficultyFromMultiplier(1000), "")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(config.MAX_WORK_DIFFICULTY_MULTIPLIER), difficulty)
+
+	_, _, err = normalizeWorkRequest("ZZ", 0, "")
+	utils.AssertEqual(t, ErrInvalidHash, err)
+	_, _, err = normalizeWorkRequest(strings.Repeat("A", 63), 0, "")
+	utils.AssertEqual(t, ErrInvalidHash, err)
+}
+
+func TestNormalizeWorkRequestNetwork(t *testing.T) {
+	hash := strings.Repeat("A", 64)
+
+	// The network is looked up and its own max difficulty applies
+	difficulty, network, err := normalizeWorkRequest(hash, serializableModels.DifficultyFromMultiplier(1000), "Banano")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "banano", network.Name)
+	utils.AssertEqual(t, network.MaxDifficulty, difficulty)
+	utils.AssertEqual(t, "banano", newWorkRequest(&models.User{Email: "a@b.c"}, hash, difficulty, network, true).Network)
+
+	// Networks can cap difficulty below the global max
+	capped := serializableModels.DifficultyFromMultiplier(8)
+	utils.AssertEqual(t, capped, maxDifficultyFor(&config.Network{MaxDifficulty: capped}))
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(config.MAX_WORK_DIFFICULTY_MULTIPLIER), maxDifficultyFor(nil))
+
+	_, _, err = normalizeWorkRequest(hash, 0, "dogecoin")
+	utils.AssertEqual(t, ErrUnknownNetwork, err)
+	utils.AssertEqual(t, "", newWorkRequest(&models.User{Email: "a@b.c"}, hash, difficulty, nil, true).Network)
+}
+
+func TestNewWorkRequestRewardsExcluded(t *testing.T) {
+	hash := strings.Repeat("A", 64)
+	difficulty := serializableModels.DifficultyFromMultiplier(1)
+
+	utils.AssertEqual(t, true, newWorkRequest(&models.User{Email: "a@b.c"}, hash, difficulty, nil, true).BlockAward)
+	utils.AssertEqual(t, false, newWorkRequest(&models.User{Email: "a@b.c"}, hash, difficulty, nil, false).BlockAward)
+	// Excluded services never award work, whatever they ask for
+	utils.AssertEqual(t, false, newWorkRequest(&models.User{Email: "a@b.c", RewardsExcluded: true}, hash, difficulty, nil, true).BlockAward)
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	utils.AssertEqual(t, nil, ValidateWebhookURL("https://1.1.1.1/callback"))
+	utils.AssertEqual(t, nil, ValidateWebhookURL("https://[2606:4700:4700::1111]/callback"))
+	utils.AssertEqual(t, true, ValidateWebhookURL("http://1.1.1.1/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("ftp://example.com") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("example.com") != nil)
+	// Nothing inside the cluster or the cloud provider's metadata service
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://localhost/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://127.0.0.1/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://10.0.0.5/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://169.254.169.254/latest/meta-data") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://0.0.0.0/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://[::1]/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://[::ffff:127.0.0.1]/callback") != nil)
+	// Nor shared address space or other ranges that aren't on the internet
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://100.100.100.200/latest/meta-data") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://[::ffff:100.64.0.1]/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://0.1.2.3/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://192.0.0.8/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://198.18.0.1/callback") != nil)
+	utils.AssertEqual(t, true, ValidateWebhookURL("https://[64:ff9b::a00:5]/callback") != nil)
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	// What the host resolves to when we connect is checked again
+	utils.AssertEqual(t, nil, webhookDialControl("tcp4", "1.1.1.1:443", nil))
+	utils.AssertEqual(t, true, webhookDialControl("tcp4", "127.0.0.1:443", nil) != nil)
+	utils.AssertEqual(t, true, webhookDialControl("tcp4", "192.168.1.1:443", nil) != nil)
+	utils.AssertEqual(t, true, webhookDialControl("tcp6", "[fe80::1]:443", nil) != nil)
+	utils.AssertEqual(t, true, webhookDialControl("tcp4", "100.100.100.200:80", nil) != nil)
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"requestId":"abc"}`)
+	signature := SignWebhook("secret", "1700000000", body)
+	utils.AssertEqual(t, "sha256=", signature[:7])
+	utils.AssertEqual(t, 7+64, len(signature))
+	utils.AssertEqual(t, signature, SignWebhook("secret", "1700000000", body))
+	// Another secret, timestamp or body doesn't match
+	utils.AssertEqual(t, true, signature != SignWebhook("other", "1700000000", body))
+	utils.AssertEqual(t, true, signature != SignWebhook("secret", "1700000001", body))
+	utils.AssertEqual(t, true, signature != SignWebhook("secret", "1700000000", []byte(`{"requestId":"abd"}`)))
+}
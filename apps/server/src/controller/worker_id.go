@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bananocoin/boompow/libs/utils"
+	"k8s.io/klog/v2"
+)
+
+// Rig of workers that don't name one
+const defaultRigName = "default"
+
+// Connections one account may have open if BPOW_MAX_CONNECTIONS_PER_ACCOUNT isn't set
+const defaultMaxConnectionsPerAccount = 10
+
+// Accounts sharing one IP before we log it as suspicious, NAT makes a few normal
+const ipAccountsWarnThreshold = 3
+
+var ErrInvalidRigName = errors.New("invalid rig name")
+
+var rigNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// ParseRigName checks the rig name a worker sent, workers that didn't send one are the default rig
+func ParseRigName(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return defaultRigName, nil
+	}
+	if !rigNamePattern.MatchString(raw) {
+		return "", ErrInvalidRigName
+	}
+	return raw, nil
+}
+
+// WorkerID identifies one rig of an account
+func WorkerID(email string, rig string) string {
+	return email + "/" + rig
+}
+
+func getMaxConnectionsPerAccount() int {
+	max, err := strconv.Atoi(utils.GetEnv("BPOW_MAX_CONNECTIONS_PER_ACCOUNT", strconv.Itoa(defaultMaxConnectionsPerAccount)))
+	if err != nil || max < 1 {
+		klog.Errorf("Invalid BPOW_MAX_CONNECTIONS_PER_ACCOUNT, using default %d", defaultMaxConnectionsPerAccount)
+		return defaultMaxConnectionsPerAccount
+	}
+	return max
+}
+
+// CanConnect says whether another rig of the account may connect
+// A rig that's already connected can always reconnect, its new connection replaces the old one
+func (h *Hub) CanConnect(email string, workerID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.canConnect(email, workerID)
+}
+
+// Requires the lock
+func (h *Hub) canConnect(email string, workerID string) bool {
+	connections := 0
+	for c := range h.Clients {
+		if c.Email == email && c.WorkerID != workerID {
+			connections++
+		}
+	}
+	return connections < h.MaxConnectionsPerAccount
+}
+
+// Accounts connected from an IP, requires the lock
+func (h *Hub) accountsOnIP(ip string) int {
+	accounts := map[string]bool{}
+	for c := range h.Clients {
+		if c.IPAddress == ip {
+			accounts[c.Email] = true
+		}
+	}
+	return len(accounts)
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"os"
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestParseRigName(t *testing.T) {
+	rig, err := ParseRigName("")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "default", rig)
+	rig, err = ParseRigName(" gpu-box_2.local ")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "gpu-box_2.local", rig)
+
+	_, err = ParseRigName("rig/1")
+	utils.AssertEqual(t, ErrInvalidRigName, err)
+	_, err = ParseRigName("012345678901234567890123456789012")
+	utils.AssertEqual(t, ErrInvalidRigName, err)
+}
+
+func TestCanConnect(t *testing.T) {
+	hub := &Hub{Clients: make(map[*Client]bool), MaxConnectionsPerAccount: 2}
+	hub.Clients[&Client{Email: "a", WorkerID: WorkerID("a", "one"), IPAddress: "1"}] = true
+	hub.Clients[&Client{Email: "a", WorkerID: WorkerID("a", "two"), IPAddress: "1"}] = true
+	hub.Clients[&Client{Email: "b", WorkerID: WorkerID("b", "one"), IPAddress: "1"}] = true
+
+	// At the cap, but a rig that's already connected can replace its connection
+	utils.AssertEqual(t, false, hub.CanConnect("a", WorkerID("a", "three")))
+	utils.AssertEqual(t, true, hub.CanConnect("a", WorkerID("a", "two")))
+	// Other accounts behind the same IP aren't affected
+	utils.AssertEqual(t, true, hub.CanConnect("b", WorkerID("b", "two")))
+	utils.AssertEqual(t, 2, hub.accountsOnIP("1"))
+}
+
+func TestRegisterReplacesRig(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	hub := &Hub{Clients: make(map[*Client]bool), Fairness: NewWeightedRoundRobinFairness(defaultFairnessHashrateLimit), MaxConnectionsPerAccount: 1}
+	old := &Client{Email: "a", WorkerID: WorkerID("a", "one"), ID: "old", Send: make(chan []byte, 1)}
+	hub.register(old)
+	utils.AssertEqual(t, 1, len(hub.Clients))
+
+	// Reconnecting the same rig drops the old connection
+	reconnected := &Client{Email: "a", WorkerID: WorkerID("a", "one"), ID: "new", Send: make(chan []byte, 1)}
+	hub.register(reconnected)
+	utils.AssertEqual(t, 1, len(hub.Clients))
+	utils.AssertEqual(t, true, hub.Clients[reconnected])
+	_, open := <-old.Send
+	utils.AssertEqual(t, false, open)
+
+	// Another rig over the cap is turned away
+	another := &Client{Email: "a", WorkerID: WorkerID("a", "two"), ID: "another", Send: make(chan []byte, 1)}
+	hub.register(another)
+	utils.AssertEqual(t, 1, len(hub.Clients))
+	_, open = <-another.Send
+	utils.AssertEqual(t, false, open)
+}
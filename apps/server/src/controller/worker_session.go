@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+)
+
+// How many session snapshots can wait to be saved before we start dropping them
+const WorkerSessionBuffer = 1000
+
+// Counters for a client's session, atomic since the session job reads them outside the hub goroutine
+type sessionCounters struct {
+	// Set when the hub registers the client
+	connectedAt time.Time
+	sent        atomic.Int64
+	won         atomic.Int64
+	invalid     atomic.Int64
+	solveTimeMs atomic.Int64
+	// Unix nanoseconds, 0 until it wins one
+	lastWonAt atomic.Int64
+}
+
+// Count a request the client answered first
+func (s *sessionCounters) recordWin(solveTime time.Duration, now time.Time) {
+	s.won.Add(1)
+	s.solveTimeMs.Add(solveTime.Milliseconds())
+	s.lastWonAt.Store(now.UnixNano())
+}
+
+// Snapshot of the client's session to save, requires the lock
+// Nil if the client's ID isn't a UUID, which only happens in tests
+func (c *Client) sessionSnapshot(now time.Time, ended bool) *models.WorkerSession {
+	id, err := uuid.Parse(c.ID)
+	if err != nil {
+		return nil
+	}
+	session := &models.WorkerSession{
+		ID:             id,
+		UserID:         c.UserID,
+		Rig:            c.Rig,
+		IPAddress:      c.IPAddress,
+		ConnectedAt:    c.session.connectedAt,
+		UpdatedAt:      now,
+		RequestsSent:   c.session.sent.Load(),
+		RequestsWon:    c.session.won.Load(),
+		InvalidResults: c.session.invalid.Load(),
+		SolveTimeMs:    c.session.solveTimeMs.Load(),
+	}
+	if c.Hello != nil {
+		session.ClientVersion = c.Hello.ClientVersion
+	}
+	if ended {
+		session.DisconnectedAt = &now
+	}
+	if lastWonAt := c.session.lastWonAt.Load(); lastWonAt > 0 {
+		wonAt := time.Unix(0, lastWonAt)
+		session.LastWonAt = &wonAt
+	}
+	return session
+}
+
+// Queue the client's session to be saved, requires the lock
+// Never blocks the hub, if the database falls behind snapshots are dropped and the next one catches up
+func (h *Hub) saveSession(client *Client, ended bool) {
+	if h.Sessions == nil {
+		return
+	}
+	session := client.sessionSnapshot(time.Now(), ended)
+	if session == nil {
+		return
+	}
+	select {
+	case h.Sessions <- session:
+	default:
+		klog.Warningf("Worker session queue is full, dropped session %s of %s", session.ID, client.WorkerID)
+	}
+}
+
+// FlushSessions saves the counters of every connected client
+func (h *Hub) FlushSessions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.Clients {
+		h.saveSession(client, false)
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+	"github.com/google/uuid"
+)
+
+func TestWorkerSessionSnapshots(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	sessions := make(chan *models.WorkerSession, 10)
+	hub := &Hub{Clients: make(map[*Client]bool), Fairness: &CappedShareFairness{}, MaxConnectionsPerAccount: 1, Sessions: sessions}
+	userID := uuid.New()
+	client := &Client{Email: "a", UserID: userID, Rig: "one", WorkerID: WorkerID("a", "one"), ID: uuid.NewString(), IPAddress: "1.2.3.4", Send: make(chan []byte, 1)}
+
+	// Registering opens the session
+	hub.register(client)
+	session := <-sessions
+	utils.AssertEqual(t, client.ID, session.ID.String())
+	utils.AssertEqual(t, userID, session.UserID)
+	utils.AssertEqual(t, "one", session.Rig)
+	utils.AssertEqual(t, true, session.DisconnectedAt == nil)
+	utils.AssertEqual(t, true, session.LastWonAt == nil)
+
+	// Flushing saves the counters so far
+	client.Hello = &serializableModels.ClientHello{ClientVersion: "1.0.0"}
+	client.session.sent.Add(3)
+	client.session.recordWin(200*time.Millisecond, time.Now())
+	client.session.invalid.Add(1)
+	hub.FlushSessions()
+	session = <-sessions
+	utils.AssertEqual(t, "1.0.0", session.ClientVersion)
+	utils.AssertEqual(t, int64(3), session.RequestsSent)
+	utils.AssertEqual(t, int64(1), session.RequestsWon)
+	utils.AssertEqual(t, int64(1), session.InvalidResults)
+	utils.AssertEqual(t, int64(200), session.SolveTimeMs)
+	utils.AssertEqual(t, true, session.LastWonAt != nil)
+
+	// Going away closes it
+	hub.remove(client)
+	session = <-sessions
+	utils.AssertEqual(t, true, session.DisconnectedAt != nil)
+	utils.AssertEqual(t, int64(3), session.RequestsSent)
+}
+
+func TestWorkerSessionQueueFull(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	sessions := make(chan *models.WorkerSession, 1)
+	hub := &Hub{Clients: make(map[*Client]bool), Sessions: sessions}
+	for i := 0; i < 3; i++ {
+		hub.Clients[&Client{ID: uuid.NewString(), Send: make(chan []byte, 1)}] = true
+	}
+
+	// The hub never waits on the database, extra snapshots are dropped
+	hub.FlushSessions()
+	utils.AssertEqual(t, 1, len(sessions))
+
+	// Without a channel nothing is saved
+	hub.Sessions = nil
+	hub.FlushSessions()
+}
@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/bananocoin/boompow/apps/server/src/middleware"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
 	"github.com/bananocoin/boompow/libs/utils/net"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"k8s.io/klog/v2"
 )
@@ -19,6 +21,15 @@ var (
 type ClientWSMessage struct {
 	ClientEmail string `json:"email"`
 	msg         []byte
+	client      *Client
+}
+
+// The rig that sent the message, the account's default rig if we don't know
+func (m ClientWSMessage) workerID() string {
+	if m.client != nil && m.client.WorkerID != "" {
+		return m.client.WorkerID
+	}
+	return WorkerID(m.ClientEmail, defaultRigName)
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -43,7 +54,7 @@ func (c *Client) readPump() {
 			break
 		}
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		msgObj := ClientWSMessage{ClientEmail: c.Email, msg: message}
+		msgObj := ClientWSMessage{ClientEmail: c.Email, msg: message, client: c}
 		c.Hub.Response <- msgObj
 	}
 }
@@ -97,19 +108,28 @@ func WorkerChl(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Denied and rate limited addresses were already turned away by the IP policy middleware
 	clientIP := net.GetIPAddress(r)
 
-	// Block hetzner datacenters
-	if net.IsIPInHetznerRange(clientIP) {
+	// Refuse workers that returned too much invalid work
+	penalty := hub.Penalties.ActionFor(provider.User.InvalidResultCount)
+	if penalty >= PenaltyDisconnect {
 		w.WriteHeader(http.StatusForbidden)
 		w.Write([]byte("403 - Forbidden"))
 		return
 	}
 
-	// Block IPs already connected
-	if hub.AlreadyConnected(clientIP) {
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("403 - Forbidden"))
+	// Several rigs can share an account, up to a limit
+	rig, err := ParseRigName(r.Header.Get(serializableModels.RigHeader))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("400 - Invalid Rig Name"))
+		return
+	}
+	workerID := WorkerID(provider.User.Email, rig)
+	if !hub.CanConnect(provider.User.Email, workerID) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("429 - Too Many Connections"))
 		return
 	}
 
@@ -118,7 +138,7 @@ func WorkerChl(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		klog.Error(err)
 		return
 	}
-	client := &Client{Hub: hub, Conn: conn, Send: make(chan []byte, 256), IPAddress: clientIP, Email: provider.User.Email}
+	client := &Client{Hub: hub, Conn: conn, Send: make(chan []byte, 256), IPAddress: clientIP, Email: provider.User.Email, UserID: provider.User.ID, Rig: rig, WorkerID: workerID, ID: uuid.NewString(), Capacity: 1, Excluded: penalty >= PenaltyExclude, NoReward: middleware.IPNoReward(r.Context())}
 	client.Hub.Register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
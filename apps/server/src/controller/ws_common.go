@@ -7,12 +7,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bananocoin/boompow/apps/server/src/config"
 	"github.com/bananocoin/boompow/apps/server/src/database"
 	"github.com/bananocoin/boompow/apps/server/src/models"
 	"github.com/bananocoin/boompow/apps/server/src/repository"
 	serializableModels "github.com/bananocoin/boompow/libs/models"
 	"github.com/bananocoin/boompow/libs/utils"
 	"github.com/bananocoin/boompow/libs/utils/validation"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"golang.org/x/exp/slices"
 	"k8s.io/klog/v2"
@@ -44,10 +46,41 @@ type Client struct {
 	// Buffered channel of outbound messages.
 	Send chan []byte
 
-	// IP Address
+	// IP Address, only used to spot abuse
 	IPAddress string
 
 	Email string
+
+	// Account the connection belongs to
+	UserID uuid.UUID
+
+	// Name of the rig this connection is from, several rigs can share an account
+	Rig string
+
+	// Account and rig, see WorkerID
+	WorkerID string
+
+	// Unique identifier for this connection
+	ID string
+
+	// Number of concurrent requests this worker says it can handle
+	Capacity int
+
+	// What the worker told us it can do, nil until it says hello
+	Hello *serializableModels.ClientHello
+
+	// Returned too many invalid results, don't send it work
+	Excluded bool
+
+	// Connected from an address the IP policy doesn't reward
+	NoReward bool
+
+	// Dispatch bookkeeping, only touched from the hub goroutine
+	InFlight   int
+	AvgLatency time.Duration
+
+	// What the worker did this connection, saved to its worker session
+	session sessionCounters
 }
 
 var Upgrader = websocket.Upgrader{}
@@ -58,8 +91,14 @@ type Hub struct {
 	// Registered clients.
 	Clients map[*Client]bool
 
-	// Outbound messages to the client
-	Broadcast chan []byte
+	// Work requests to send to a selection of clients
+	Dispatch chan *DispatchRequest
+
+	// Dispatch requests waiting to be sent, only touched from the hub goroutine
+	queue *dispatchQueue
+
+	// Requests that have been answered or given up on
+	Finished chan string
 
 	// Inbound messages from client
 	Response chan ClientWSMessage
@@ -73,45 +112,165 @@ type Hub struct {
 	// Channel to broadcast stats to
 	StatsChan *chan repository.WorkMessage
 
+	// Channel to save worker sessions to, nil to not save them
+	Sessions chan<- *models.WorkerSession
+
+	// Decides which clients get which request
+	Dispatcher *Dispatcher
+
+	// Keeps any one account from taking the whole pool
+	Fairness FairnessPolicy
+
+	// Most connections one account may have open
+	MaxConnectionsPerAccount int
+
+	// For penalizing clients that return invalid work
+	UserRepo  repository.UserRepo
+	AuditRepo repository.AuditRepo
+	Penalties *PenaltyThresholds
+
+	// Which clients each open request was sent to, keyed by request ID
+	// Only touched from the hub goroutine
+	assignments map[string]*assignment
+
 	mu sync.Mutex
 }
 
-func (h *Hub) AlreadyConnected(ip string) bool {
+// DispatchRequest asks the hub to send a work request to some of the clients
+type DispatchRequest struct {
+	RequestID            string
+	Hash                 string
+	DifficultyMultiplier int
+	Precache             bool
+	Priority             serializableModels.Priority
+	Message              []byte
+	// Send to every eligible client that hasn't been asked yet
+	Broadcast bool
+}
+
+// assignment tracks the clients a request was dispatched to and when
+type assignment struct {
+	hash    string
+	clients map[*Client]time.Time
+}
+
+// DisconnectAccount closes every connection of an account, for when it's banned
+func (h *Hub) DisconnectAccount(email string) {
+	toDisconnect := []*Client{}
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	for c := range h.Clients {
-		if c.IPAddress == ip {
-			return true
+		if c.Email == email {
+			toDisconnect = append(toDisconnect, c)
 		}
 	}
-	return false
+	h.mu.Unlock()
+	for _, c := range toDisconnect {
+		h.Unregister <- c
+	}
 }
 
-func NewHub(statsChan *chan repository.WorkMessage) *Hub {
+// EnforceIPPolicy closes the connections of workers on addresses the policy now denies
+// The middleware only checks them when they connect, so this runs after every reload
+func (h *Hub) EnforceIPPolicy(policy *config.IPPolicy) {
+	toDisconnect := []*Client{}
+	h.mu.Lock()
+	for c := range h.Clients {
+		if decision := policy.Evaluate(c.IPAddress); decision.Action == config.IPActionDeny {
+			klog.Infof("Disconnecting %s from %s, denied by %s", c.WorkerID, c.IPAddress, decision.Rule)
+			toDisconnect = append(toDisconnect, c)
+		}
+	}
+	h.mu.Unlock()
+	for _, c := range toDisconnect {
+		h.Unregister <- c
+	}
+}
+
+// Add a client, replacing an older connection of the same rig, requires the lock
+// Clients over their account's connection cap are turned away, the check before the upgrade can race
+func (h *Hub) register(client *Client) {
+	if !h.canConnect(client.Email, client.WorkerID) {
+		klog.Warningf("Refusing %s from %s, account has too many connections", client.WorkerID, client.IPAddress)
+		close(client.Send)
+		return
+	}
+	for c := range h.Clients {
+		if c.WorkerID == client.WorkerID {
+			klog.V(3).Infof("%s reconnected, dropping its old connection", client.WorkerID)
+			h.remove(c)
+		}
+	}
+	h.Clients[client] = true
+	client.session.connectedAt = time.Now()
+	h.saveSession(client, false)
+	if accounts := h.accountsOnIP(client.IPAddress); accounts >= ipAccountsWarnThreshold {
+		klog.Warningf("%d accounts connected from %s, latest %s", accounts, client.IPAddress, client.Email)
+	}
+	// Keep global state of connected clients
+	database.GetRedisDB().AddConnectedClient(client.ID)
+	publishConnectedWorkers()
+}
+
+// Drop a client, requires the lock
+func (h *Hub) remove(client *Client) {
+	delete(h.Clients, client)
+	close(client.Send)
+	h.Fairness.Disconnected(client)
+	h.saveSession(client, true)
+	// Keep global state of connected clients
+	database.GetRedisDB().RemoveConnectedClient(client.ID)
+	publishConnectedWorkers()
+}
+
+func NewHub(statsChan *chan repository.WorkMessage, sessions chan<- *models.WorkerSession, userRepo repository.UserRepo, auditRepo repository.AuditRepo) *Hub {
 	return &Hub{
-		Broadcast:  make(chan []byte, 100),
-		Response:   make(chan ClientWSMessage),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Clients:    make(map[*Client]bool),
-		StatsChan:  statsChan,
+		Dispatch:    make(chan *DispatchRequest, 100),
+		queue:       newDispatchQueue(),
+		Finished:    make(chan string, 100),
+		Response:    make(chan ClientWSMessage),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		Clients:     make(map[*Client]bool),
+		StatsChan:   statsChan,
+		Sessions:    sessions,
+		Dispatcher:  NewDispatcher(),
+		Fairness:    NewFairnessPolicy(),
+		UserRepo:    userRepo,
+		AuditRepo:   auditRepo,
+		Penalties:   NewPenaltyThresholds(),
+		assignments: make(map[string]*assignment),
+
+		MaxConnectionsPerAccount: getMaxConnectionsPerAccount(),
 	}
 }
 
+// Let stats subscribers know the number of connected workers changed
+func publishConnectedWorkers() {
+	nConnectedClients, err := database.GetRedisDB().GetNumberConnectedClients()
+	if err != nil {
+		klog.Errorf("Error retrieving connected clients %v", err)
+		return
+	}
+	models.GetStatsInstance().SetConnectedWorkers(int(nConnectedClients))
+}
+
 func (h *Hub) BlockAwardedWorker(blockAwardedChan <-chan serializableModels.ClientMessage) {
 	for ba := range blockAwardedChan {
 		func() {
 			h.mu.Lock()
 			defer h.mu.Unlock()
+			bytes, err := json.Marshal(ba)
+			if err != nil {
+				klog.Errorf("Error marshalling block awarded message %s", err)
+				return
+			}
+			klog.V(3).Infof("Awarding to %s", ba.ProviderWorker)
+			if err := database.GetRedisDB().UpdateClientScore(ba.ProviderEmail, ba.ProviderWorker, int(ba.DifficultyMultiplier)); err != nil {
+				klog.Errorf("Error updating score for %s: %v", ba.ProviderWorker, err)
+			}
+			// Every rig of the account hears about it, the pool share is the account's
 			for c := range h.Clients {
 				if c.Email == ba.ProviderEmail {
-					bytes, err := json.Marshal(ba)
-					if err != nil {
-						klog.Errorf("Error marshalling block awarded message %s", err)
-						break
-					}
-					fmt.Printf("Awarding to %s", c.IPAddress)
-					database.GetRedisDB().UpdateClientScore(c.IPAddress, int(ba.DifficultyMultiplier))
 					WriteChannelSafe(c.Send, bytes)
 				}
 			}
@@ -126,22 +285,25 @@ func (h *Hub) Run() {
 			func() {
 				h.mu.Lock()
 				defer h.mu.Unlock()
-				h.Clients[client] = true
-				// Keep global state of connected clients
-				database.GetRedisDB().AddConnectedClient(client.IPAddress)
+				h.register(client)
 			}()
+			h.drain()
 		case client := <-h.Unregister:
 			func() {
 				h.mu.Lock()
 				defer h.mu.Unlock()
 				if _, ok := h.Clients[client]; ok {
-					delete(h.Clients, client)
-					close(client.Send)
-					// Keep global state of connected clients
-					database.GetRedisDB().RemoveConnectedClient(client.IPAddress)
+					h.remove(client)
 				}
 			}()
 		case message := <-h.Response:
+			// See if this is a hello, anything else is a work response
+			var envelope clientMessageEnvelope
+			if err := json.Unmarshal(message.msg, &envelope); err == nil && envelope.MessageType == serializableModels.Hello {
+				h.hello(message)
+				h.drain()
+				continue
+			}
 			// Try to unmarshal as ClientWorkResponse
 			var workResponse serializableModels.ClientWorkResponse
 			err := json.Unmarshal(message.msg, &workResponse)
@@ -150,38 +312,48 @@ func (h *Hub) Run() {
 				klog.Errorf("Error unmarshalling work response: %s", err)
 				continue
 			}
-			// If this channel exists, send response
-			activeChannel := ActiveChannels.Get(workResponse.RequestID)
-			if activeChannel != nil {
+			// If this request is still in flight and open, send response
+			activeChannel := InFlightRequests.Get(workResponse.RequestID)
+			_, open := h.assignments[workResponse.RequestID]
+			if activeChannel != nil && open && InFlightRequests.Err(workResponse.RequestID) == nil {
 				// Validate this work
-				if !validation.IsWorkValid(activeChannel.Hash, activeChannel.DifficultyMultiplier, workResponse.Result) {
-					klog.Errorf("Received invalid work for %s", activeChannel.Hash)
-					// ! TODO - penalize this bad client
+				if !validation.IsWorkValid(activeChannel.Hash, uint64(activeChannel.Difficulty), workResponse.Result) {
+					klog.Errorf("Received invalid work for %s from %s", activeChannel.Hash, message.ClientEmail)
+					if message.client != nil {
+						message.client.session.invalid.Add(1)
+						go h.penalize(message.client, activeChannel.Hash)
+					}
 					continue
 				}
-				// Send work cancel command to all clients
-				workCancel := &serializableModels.ClientMessage{
-					MessageType: serializableModels.WorkCancel,
-					Hash:        activeChannel.Hash,
-				}
-				bytes, err := json.Marshal(workCancel)
-				if err != nil {
-					klog.Errorf("Failed to marshal work cancel command: %v", err)
-				} else {
-					ActiveHub.Broadcast <- bytes
+				if message.client != nil {
+					if dispatchedAt, ok := h.assignments[workResponse.RequestID].clients[message.client]; ok {
+						message.client.recordLatency(time.Since(dispatchedAt))
+						message.client.session.recordWin(time.Since(dispatchedAt), time.Now())
+					}
 				}
+				// Send work cancel command to everybody else working on it
+				h.finish(workResponse.RequestID)
+				h.drain()
 				// Credit this client for this work
 				// Except for some services people can abuse, like BananoVault
 				if slices.Contains(utils.GetBannedRewards(), activeChannel.RequesterEmail) {
 					activeChannel.BlockAward = false
 				}
+				// Nor workers on addresses the IP policy doesn't reward
+				blockAward := activeChannel.BlockAward
+				if message.client != nil && message.client.NoReward {
+					blockAward = false
+				}
 				statsMessage := repository.WorkMessage{
-					BlockAward:           activeChannel.BlockAward,
+					BlockAward:           blockAward,
 					ProvidedByEmail:      message.ClientEmail,
+					ProvidedByWorker:     message.workerID(),
 					RequestedByEmail:     activeChannel.RequesterEmail,
 					Hash:                 activeChannel.Hash,
 					Result:               workResponse.Result,
 					DifficultyMultiplier: activeChannel.DifficultyMultiplier,
+					Difficulty:           activeChannel.Difficulty,
+					Network:              activeChannel.Network,
 					Precache:             activeChannel.Precache,
 				}
 				*h.StatsChan <- statsMessage
@@ -189,31 +361,162 @@ func (h *Hub) Run() {
 			} else {
 				klog.V(3).Infof("Received work response for hash %s, but no channel exists", workResponse.Hash)
 			}
-		case message := <-h.Broadcast:
-			func() {
-				h.mu.Lock()
-				defer h.mu.Unlock()
-				toExclude, err := database.GetRedisDB().FilterOverperformingClients()
-				if err != nil {
-					klog.Errorf("Error filtering overperforming clients: %v", err)
-					toExclude = []string{}
-				}
-				if len(h.Clients) < 5 {
-					toExclude = []string{}
-					klog.V(3).Infof("Not enough clients to exclude any")
-				}
-				for client := range h.Clients {
-					if len(toExclude) > 0 && slices.Contains(toExclude, client.IPAddress) {
-						continue
-					}
-					select {
-					case client.Send <- message:
-					default:
-						close(client.Send)
-						delete(h.Clients, client)
-					}
-				}
-			}()
+		case request := <-h.Dispatch:
+			h.queue.push(request)
+			h.drain()
+		case requestID := <-h.Finished:
+			h.finish(requestID)
+			h.drain()
+		}
+	}
+}
+
+// Used to peek at the type of a message sent by a client
+type clientMessageEnvelope struct {
+	MessageType serializableModels.MessageType `json:"request_type"`
+}
+
+// Store the capabilities a client advertised
+func (h *Hub) hello(message ClientWSMessage) {
+	var hello serializableModels.ClientHello
+	if err := json.Unmarshal(message.msg, &hello); err != nil {
+		klog.Errorf("Error unmarshalling hello: %s", err)
+		return
+	}
+	if hello.Version > serializableModels.ClientHelloVersion {
+		klog.Warningf("Client %s sent hello version %d, we only understand %d", message.ClientEmail, hello.Version, serializableModels.ClientHelloVersion)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if message.client == nil {
+		return
+	}
+	message.client.Hello = &hello
+	if hello.Concurrency > 0 {
+		message.client.Capacity = hello.Concurrency
+	}
+	klog.V(3).Infof("Client %s version %s says hello, difficulty %d-%d, %d GPUs, %d CPU threads, %.0f H/s", message.ClientEmail, hello.ClientVersion, hello.MinDifficulty, hello.MaxDifficulty, hello.Devices.GPUCount, hello.Devices.CPUThreads, hello.Hashrate)
+}
+
+// Dispatch queued requests, most urgent first
+// Interactive requests always go out right away, lower priorities wait until a worker that accepts them has free capacity
+func (h *Hub) drain() {
+	for {
+		free := h.freeWorkers()
+		request := h.queue.take(func(request *DispatchRequest) bool {
+			return request.Priority == serializableModels.PriorityInteractive || acceptedByAny(free, request)
+		})
+		if request == nil {
+			return
+		}
+		h.dispatch(request)
+	}
+}
+
+func (h *Hub) freeWorkers() []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	free := []*Client{}
+	for client := range h.Clients {
+		if !client.Excluded && client.hasCapacity() {
+			free = append(free, client)
+		}
+	}
+	return free
+}
+
+// Whether any of the clients would take the request, the same check dispatch makes
+func acceptedByAny(clients []*Client, request *DispatchRequest) bool {
+	for _, client := range clients {
+		if client.Hello == nil || client.Hello.Accepts(request.DifficultyMultiplier, request.Precache) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send a work request to the best clients for it, or to everybody not yet asked if it's a broadcast
+func (h *Hub) dispatch(request *DispatchRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, ok := h.assignments[request.RequestID]
+	if !ok {
+		if request.Broadcast {
+			// Already answered
+			return
+		}
+		a = &assignment{hash: request.Hash, clients: make(map[*Client]time.Time)}
+		h.assignments[request.RequestID] = a
+	}
+
+	candidates := []*Client{}
+	for client := range h.Clients {
+		if _, asked := a.clients[client]; asked || client.Excluded {
+			continue
+		}
+		// Don't bother sending requests the worker would ignore
+		if client.Hello != nil && !client.Hello.Accepts(request.DifficultyMultiplier, request.Precache) {
+			continue
+		}
+		candidates = append(candidates, client)
+	}
+
+	shares, err := database.GetRedisDB().GetClientScoreShares()
+	if err != nil {
+		klog.Errorf("Error retrieving client score shares: %v", err)
+		shares = &database.ClientScoreShares{}
+	}
+	state := &FairnessState{Shares: shares, Connected: len(h.Clients), Now: time.Now()}
+	ranked, n := candidates, len(candidates)
+	if !request.Broadcast {
+		ranked, n = h.Dispatcher.Rank(candidates, shares), h.Dispatcher.RedundancyFor(request.DifficultyMultiplier)
+	}
+	selected := h.Fairness.Pick(ranked, n, state)
+
+	asked := 0
+	for _, client := range selected {
+		select {
+		case client.Send <- request.Message:
+			a.clients[client] = state.Now
+			client.InFlight++
+			client.session.sent.Add(1)
+			asked++
+			h.Fairness.Dispatched(client, state.Now)
+		default:
+			h.remove(client)
+		}
+	}
+	InFlightRequests.AddWorkersAsked(request.RequestID, asked)
+	klog.V(3).Infof("Dispatched %s to %d clients (broadcast: %v)", request.Hash, len(selected), request.Broadcast)
+}
+
+// Close out a request, tell the clients working on it to stop
+func (h *Hub) finish(requestID string) {
+	h.queue.remove(requestID)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, ok := h.assignments[requestID]
+	if !ok {
+		return
+	}
+	delete(h.assignments, requestID)
+
+	workCancel := &serializableModels.ClientMessage{
+		MessageType: serializableModels.WorkCancel,
+		Hash:        a.hash,
+	}
+	bytes, err := json.Marshal(workCancel)
+	if err != nil {
+		klog.Errorf("Failed to marshal work cancel command: %v", err)
+	}
+	for client := range a.clients {
+		client.InFlight--
+		if _, connected := h.Clients[client]; !connected || err != nil {
+			continue
+		}
+		select {
+		case client.Send <- bytes:
+		default:
 		}
 	}
 }
@@ -234,48 +537,103 @@ func WriteChannelSafe(out chan []byte, msg []byte) (err error) {
 	return err
 }
 
-// Channels for reach specific work request
-var ActiveChannels = models.NewSyncArray()
+// Work requests waiting on workers
+var InFlightRequests = models.NewInFlightRegistry()
 
 // Timeout waiting for work response from client
 const WORK_TIMEOUT_S = time.Second * 30
 
-// Method to handle a work request response
-// 1) Broadcast to every client
-// 2) Create a channel for the response
-// 3) Wait for response on the channel until timeout
+var ErrWorkCancelled = errors.New("cancelled")
+
+// Requests for the same hash at the same time share one request to workers
+var workFlights = newFlightGroup(dispatchAndWait, WORK_TIMEOUT_S)
+
+// CancelWorkRequest stops waiting for the requester's pending work on this hash, returns whether anything was pending
+// The work is still generated if somebody else is waiting for it
+func CancelWorkRequest(requesterEmail string, hash string) bool {
+	return workFlights.Cancel(requesterEmail, hash) > 0
+}
+
+// BroadcastWorkRequestAndWait waits for work for the request, sharing it with other requests for the same hash
 func BroadcastWorkRequestAndWait(workRequest serializableModels.ClientMessage) (*serializableModels.ClientWorkResponse, error) {
+	// Requests made with only a multiplier get the matching difficulty, and vice versa
+	if workRequest.Difficulty == 0 {
+		workRequest.Difficulty = serializableModels.Difficulty(workRequest.Threshold())
+	}
+	workRequest.DifficultyMultiplier = workRequest.Difficulty.CeilMultiplier()
+	return workFlights.Do(workRequest)
+}
+
+// Method to handle a work request response
+// 1) Create a channel for the response
+// 2) Dispatch to the best workers for it
+// 3) If nobody answered by the fallback deadline, broadcast to everybody else
+// 4) Wait for response on the channel until the request's deadline, or until interrupted or cancelled
+func dispatchAndWait(workRequest serializableModels.ClientMessage, interrupt <-chan struct{}, timeoutAfter time.Duration) (*serializableModels.ClientWorkResponse, error) {
 	// Serialize
 	bytes, err := json.Marshal(workRequest)
 	if err != nil {
 		return nil, err
 	}
 	// Create channel for this hash
-	responseChan := make(chan []byte)
-	defer close(responseChan)
-	activeChannelObj := models.ActiveChannelObject{
+	responseChan := make(chan []byte, 1)
+	inFlight := &models.InFlightRequest{
 		BlockAward:           workRequest.BlockAward,
 		RequesterEmail:       workRequest.RequesterEmail,
 		RequestID:            workRequest.RequestID,
 		Hash:                 workRequest.Hash,
 		DifficultyMultiplier: workRequest.DifficultyMultiplier,
+		Difficulty:           workRequest.Difficulty,
+		Network:              workRequest.Network,
 		Chan:                 responseChan,
 		Precache:             workRequest.Precache,
+		Priority:             workRequest.EffectivePriority(),
+		Deadline:             time.Now().Add(timeoutAfter),
+	}
+	if !InFlightRequests.Put(inFlight) {
+		return nil, fmt.Errorf("request %s is already in flight", workRequest.RequestID)
+	}
+	// Runs last, after the channel is closed, so the hub is never blocked writing to it
+	defer func() { ActiveHub.Finished <- workRequest.RequestID }()
+	defer close(responseChan)
+	defer InFlightRequests.Delete(workRequest.RequestID)
+	dispatchRequest := DispatchRequest{
+		RequestID:            workRequest.RequestID,
+		Hash:                 workRequest.Hash,
+		DifficultyMultiplier: workRequest.DifficultyMultiplier,
+		Precache:             workRequest.Precache,
+		Priority:             workRequest.EffectivePriority(),
+		Message:              bytes,
 	}
-	ActiveChannels.Put(&activeChannelObj)
-	defer ActiveChannels.Delete(workRequest.RequestID)
-	ActiveHub.Broadcast <- bytes
-	select {
-	case response := <-activeChannelObj.Chan:
-		var workResponse serializableModels.ClientWorkResponse
-		err := json.Unmarshal(response, &workResponse)
-		if err != nil {
-			return nil, err
+	ActiveHub.Dispatch <- &dispatchRequest
+
+	fallback := time.NewTimer(ActiveHub.Dispatcher.FallbackDeadline)
+	defer fallback.Stop()
+	for {
+		select {
+		case response := <-inFlight.Chan:
+			var workResponse serializableModels.ClientWorkResponse
+			err := json.Unmarshal(response, &workResponse)
+			if err != nil {
+				return nil, err
+			}
+			return &workResponse, nil
+		case <-interrupt:
+			klog.V(3).Infof("Work request interrupted %s", workRequest.Hash)
+			return nil, errFlightInterrupted
+		case <-fallback.C:
+			klog.V(3).Infof("No response for %s within %v, broadcasting", workRequest.Hash, ActiveHub.Dispatcher.FallbackDeadline)
+			broadcastRequest := dispatchRequest
+			broadcastRequest.Broadcast = true
+			ActiveHub.Dispatch <- &broadcastRequest
+		case <-inFlight.Done():
+			err := InFlightRequests.Err(workRequest.RequestID)
+			if err == models.ErrInFlightExpired {
+				klog.Errorf("Work request timed out %s", workRequest.Hash)
+				return nil, err
+			}
+			klog.V(3).Infof("Work request cancelled %s", workRequest.Hash)
+			return nil, ErrWorkCancelled
 		}
-		return &workResponse, nil
-	// 30
-	case <-time.After(WORK_TIMEOUT_S):
-		klog.Errorf("Work request timed out %s", workRequest.Hash)
-		return nil, errors.New("timeout")
 	}
 }
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestEnforceIPPolicy(t *testing.T) {
+	policyConfig, err := config.ParseIPPolicy([]byte(`{"rules": [
+		{"name": "hetzner", "action": "deny", "cidrs": ["198.51.100.0/24"]},
+		{"name": "vpn", "action": "no_reward", "cidrs": ["203.0.113.0/24"]}
+	]}`))
+	utils.AssertEqual(t, nil, err)
+	policy, err := config.BuildIPPolicy(policyConfig, http.DefaultClient)
+	utils.AssertEqual(t, nil, err)
+
+	hub := &Hub{Clients: make(map[*Client]bool), Unregister: make(chan *Client, 10)}
+	denied := &Client{WorkerID: "a", IPAddress: "198.51.100.7"}
+	noReward := &Client{WorkerID: "b", IPAddress: "203.0.113.7"}
+	allowed := &Client{WorkerID: "c", IPAddress: "192.0.2.7"}
+	for _, c := range []*Client{denied, noReward, allowed} {
+		hub.Clients[c] = true
+	}
+
+	// Only workers the policy now denies are dropped
+	hub.EnforceIPPolicy(policy)
+	utils.AssertEqual(t, 1, len(hub.Unregister))
+	utils.AssertEqual(t, denied, <-hub.Unregister)
+}
@@ -30,7 +30,7 @@ func NewConnection(config *Config) (*gorm.DB, error) {
 }
 
 func DropAndCreateTables(db *gorm.DB) error {
-	err := db.Migrator().DropTable(&models.User{}, &models.WorkResult{}, &models.Payment{})
+	err := db.Migrator().DropTable(&models.User{}, &models.WorkResult{}, &models.Payment{}, &models.AuditLog{}, &models.ServiceToken{}, &models.WorkerSession{})
 	if err != nil {
 		return err
 	}
@@ -42,13 +42,16 @@ func DropAndCreateTables(db *gorm.DB) error {
 	if err != nil {
 		return err
 	}
-	err = db.Migrator().CreateTable(&models.User{}, &models.WorkResult{}, &models.Payment{})
+	err = db.Migrator().CreateTable(&models.User{}, &models.WorkResult{}, &models.Payment{}, &models.AuditLog{}, &models.ServiceToken{}, &models.WorkerSession{})
 	return err
 }
 
+// Migrate creates the user type and adds any missing tables and columns, it's safe to run again
 func Migrate(db *gorm.DB) error {
-	createTypes(db)
-	return db.AutoMigrate(&models.User{}, &models.WorkResult{}, &models.Payment{})
+	if err := createTypes(db); err != nil {
+		return err
+	}
+	return db.AutoMigrate(&models.User{}, &models.WorkResult{}, &models.Payment{}, &models.AuditLog{}, &models.ServiceToken{}, &models.WorkerSession{})
 }
 
 // Create types in postgres
@@ -57,7 +60,7 @@ func createTypes(db *gorm.DB) error {
 
 	switch {
 	case result.RowsAffected == 0:
-		if err := db.Exec(fmt.Sprintf("CREATE TYPE %s AS ENUM ('%s', '%s');", models.PG_USER_TYPE_NAME, models.PROVIDER, models.REQUESTER)).Error; err != nil {
+		if err := db.Exec(fmt.Sprintf("CREATE TYPE %s AS ENUM ('%s', '%s', '%s');", models.PG_USER_TYPE_NAME, models.PROVIDER, models.REQUESTER, models.ADMIN)).Error; err != nil {
 			fmt.Printf("Error creating %s ENUM", models.PG_USER_TYPE_NAME)
 			return err
 		}
@@ -67,6 +70,7 @@ func createTypes(db *gorm.DB) error {
 		return result.Error
 
 	default:
-		return nil
+		// The type may be from before there were admins
+		return db.Exec(fmt.Sprintf("ALTER TYPE %s ADD VALUE IF NOT EXISTS '%s';", models.PG_USER_TYPE_NAME, models.ADMIN)).Error
 	}
 }
@@ -2,17 +2,20 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/bananocoin/boompow/apps/server/graph/model"
 	"github.com/bananocoin/boompow/apps/server/src/config"
+	"github.com/bananocoin/boompow/apps/server/src/models"
 	"github.com/bananocoin/boompow/libs/utils"
 	"github.com/go-redis/redis/v9"
-	"github.com/google/uuid"
 	"k8s.io/klog/v2"
 )
 
@@ -65,8 +68,8 @@ func GetRedisDB() *redisManager {
 }
 
 // del - Redis DEL
-func (r *redisManager) Del(key string) (int64, error) {
-	val, err := r.Client.Del(ctx, key).Result()
+func (r *redisManager) Del(keys ...string) (int64, error) {
+	val, err := r.Client.Del(ctx, keys...).Result()
 	return val, err
 }
 
@@ -82,6 +85,11 @@ func (r *redisManager) Set(key string, value string, expiry time.Duration) error
 	return err
 }
 
+// setnx - Redis SET NX, returns whether the key was set
+func (r *redisManager) SetNX(key string, value string, expiry time.Duration) (bool, error) {
+	return r.Client.SetNX(ctx, key, value, expiry).Result()
+}
+
 // hlen - Redis HLEN
 func (r *redisManager) Hlen(key string) (int64, error) {
 	val, err := r.Client.HLen(ctx, key).Result()
@@ -177,52 +185,293 @@ func (r *redisManager) WipeAllConnectedClients() (int64, error) {
 	return r.Del("clients")
 }
 
-// For service tokens
-func (r *redisManager) AddServiceToken(userID uuid.UUID, token string) error {
-	userIdStr := userID.String()
-	return r.Hset("servicetokens", token, userIdStr)
+// Service tokens from before they were kept in postgres, token -> user ID
+func (r *redisManager) GetLegacyServiceTokens() (map[string]string, error) {
+	return r.Hgetall("servicetokens")
 }
 
-func (r *redisManager) GetServiceTokenUser(serviceToken string) (string, error) {
-	user, err := r.Hget("servicetokens", serviceToken)
+// For caching work, with the difficulty it achieved
+func (r *redisManager) CacheWork(hash string, work *models.CachedWork) error {
+	serialized, err := json.Marshal(work)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return user, nil
+	return r.Set(fmt.Sprintf("cache:%s", hash), string(serialized), config.WORK_CACHE_MINUTES*time.Minute)
 }
 
-func (r *redisManager) GetServiceTokenForUser(userID uuid.UUID) (string, error) {
-	userIdStr := userID.String()
-	ret, err := r.Hgetall("servicetokens")
+func (r *redisManager) GetCachedWork(hash string) (*models.CachedWork, error) {
+	serialized, err := r.Get(fmt.Sprintf("cache:%s", hash))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	var work models.CachedWork
+	if err := json.Unmarshal([]byte(serialized), &work); err != nil {
+		return nil, err
 	}
+	return &work, nil
+}
+
+func (r *redisManager) UncacheWork(hash string) error {
+	_, err := r.Del(fmt.Sprintf("cache:%s", hash))
+	return err
+}
 
-	for k, v := range ret {
-		if v == userIdStr {
-			return k, nil
+// Count a service's request that was answered from the cache
+func (r *redisManager) IncrementCacheHits(requesterEmail string) error {
+	return r.Client.HIncrBy(ctx, "workcache:hits", requesterEmail, 1).Err()
+}
+
+// Requests answered from the cache for each service, by email
+func (r *redisManager) GetCacheHits() (map[string]int, error) {
+	return r.getCounts("workcache:hits")
+}
+
+// Count a service's request that shared work generated for another request
+func (r *redisManager) IncrementCoalescedRequests(requesterEmail string) error {
+	return r.Client.HIncrBy(ctx, "workflight:coalesced", requesterEmail, 1).Err()
+}
+
+// Requests that shared work generated for another request, for each service by email
+func (r *redisManager) GetCoalescedRequests() (map[string]int, error) {
+	return r.getCounts("workflight:coalesced")
+}
+
+func (r *redisManager) getCounts(key string) (map[string]int, error) {
+	ret, err := r.Hgetall(key)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(ret))
+	for field, count := range ret {
+		countInt, err := strconv.Atoi(count)
+		if err != nil {
+			continue
+		}
+		counts[field] = countInt
+	}
+	return counts, nil
+}
+
+// Quota usage keys, minute and day windows are in UTC
+func quotaMinuteKey(requesterEmail string, now time.Time) string {
+	return fmt.Sprintf("quota:minute:%s:%d", requesterEmail, now.Unix()/60)
+}
+
+func quotaDayKey(requesterEmail string, now time.Time) string {
+	return fmt.Sprintf("quota:day:%s:%s", requesterEmail, now.UTC().Format("20060102"))
+}
+
+func quotaInFlightKey(requesterEmail string) string {
+	return fmt.Sprintf("quota:inflight:%s", requesterEmail)
+}
+
+// Count a request against the service's per minute and per day quota, returns the counts including it
+func (r *redisManager) IncrementQuotaRequests(requesterEmail string, now time.Time) (int, int, error) {
+	pipe := r.Client.TxPipeline()
+	minute := pipe.Incr(ctx, quotaMinuteKey(requesterEmail, now))
+	pipe.Expire(ctx, quotaMinuteKey(requesterEmail, now), 2*time.Minute)
+	day := pipe.Incr(ctx, quotaDayKey(requesterEmail, now))
+	pipe.Expire(ctx, quotaDayKey(requesterEmail, now), 25*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return int(minute.Val()), int(day.Val()), nil
+}
+
+// Take back a request that was rejected, so it doesn't use up quota
+func (r *redisManager) DecrementQuotaRequests(requesterEmail string, now time.Time) error {
+	pipe := r.Client.TxPipeline()
+	pipe.Decr(ctx, quotaMinuteKey(requesterEmail, now))
+	pipe.Decr(ctx, quotaDayKey(requesterEmail, now))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Count a request the service is waiting on, returns false without counting it if it already has max in flight
+// The count expires so a replica that dies mid-request doesn't hold the service's quota forever
+func (r *redisManager) AcquireQuotaInFlight(requesterEmail string, max int) (bool, error) {
+	key := quotaInFlightKey(requesterEmail)
+	pipe := r.Client.TxPipeline()
+	inFlight := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, config.QUOTA_IN_FLIGHT_EXPIRY_MINUTES*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if int(inFlight.Val()) > max {
+		return false, r.ReleaseQuotaInFlight(requesterEmail)
+	}
+	return true, nil
+}
+
+func (r *redisManager) ReleaseQuotaInFlight(requesterEmail string) error {
+	key := quotaInFlightKey(requesterEmail)
+	inFlight, err := r.Client.Decr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if inFlight <= 0 {
+		// Expired while the request was running
+		_, err = r.Del(key)
+	}
+	return err
+}
+
+// GetQuotaUsage returns how much of its quota the service used in the current windows
+func (r *redisManager) GetQuotaUsage(requesterEmail string, now time.Time) (*models.QuotaUsage, error) {
+	pipe := r.Client.Pipeline()
+	minute := pipe.Get(ctx, quotaMinuteKey(requesterEmail, now))
+	day := pipe.Get(ctx, quotaDayKey(requesterEmail, now))
+	inFlight := pipe.Get(ctx, quotaInFlightKey(requesterEmail))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	usage := &models.QuotaUsage{}
+	usage.RequestsThisMinute, _ = minute.Int()
+	usage.RequestsToday, _ = day.Int()
+	usage.InFlight, _ = inFlight.Int()
+	return usage, nil
+}
+
+// Asynchronous work request status, keyed by requester so services can only see their own
+func (r *redisManager) SetWorkStatus(requesterEmail string, status *models.WorkRequestStatus) error {
+	serialized, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return r.Set(fmt.Sprintf("workstatus:%s:%s", requesterEmail, status.RequestID), string(serialized), config.WORK_STATUS_VALID_MINUTES*time.Minute)
+}
+
+func (r *redisManager) GetWorkStatus(requesterEmail string, requestID string) (*models.WorkRequestStatus, error) {
+	serialized, err := r.Get(fmt.Sprintf("workstatus:%s:%s", requesterEmail, requestID))
+	if err != nil {
+		return nil, err
+	}
+	var status models.WorkRequestStatus
+	if err := json.Unmarshal([]byte(serialized), &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Async work statuses are published per requester, so a service's subscription only gets its own
+func workStatusChannel(requesterEmail string) string {
+	return fmt.Sprintf("%s:workstatus:%s", keyPrefix, requesterEmail)
+}
+
+// PublishWorkStatus tells the requester's subscribers on every replica that a request finished
+func (r *redisManager) PublishWorkStatus(requesterEmail string, status *models.WorkRequestStatus) error {
+	serialized, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return r.Client.Publish(ctx, workStatusChannel(requesterEmail), serialized).Err()
+}
+
+// SubscribeWorkStatus receives the statuses published for the requester until subCtx is done, then closes the channel
+func (r *redisManager) SubscribeWorkStatus(subCtx context.Context, requesterEmail string) (<-chan *models.WorkRequestStatus, error) {
+	pubsub := r.Client.Subscribe(subCtx, workStatusChannel(requesterEmail))
+	// Wait for the subscription so nothing published after we return is missed
+	if _, err := pubsub.Receive(subCtx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	statuses := make(chan *models.WorkRequestStatus)
+	go func() {
+		defer close(statuses)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-subCtx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var status models.WorkRequestStatus
+				if err := json.Unmarshal([]byte(message.Payload), &status); err != nil {
+					klog.Errorf("Error decoding work status for %s: %v", requesterEmail, err)
+					continue
+				}
+				select {
+				case statuses <- &status:
+				case <-subCtx.Done():
+					return
+				}
+			}
 		}
+	}()
+	return statuses, nil
+}
+
+// Extends a lock only if owner still holds it, in one step so it can't expire and be taken by someone else in between
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// AcquireLock takes the named lock for owner, or extends it if owner already holds it
+// Returns false if somebody else holds it
+func (r *redisManager) AcquireLock(name string, owner string, expiry time.Duration) (bool, error) {
+	key := fmt.Sprintf("lock:%s", name)
+	acquired, err := r.SetNX(key, owner, expiry)
+	if err != nil || acquired {
+		return acquired, err
 	}
-	return "", errors.New("No Token")
+	renewed, err := renewLockScript.Run(ctx, r.Client, []string{key}, owner, expiry.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return renewed == 1, nil
 }
 
-// For caching work
-func (r *redisManager) CacheWork(hash string, result string) error {
-	// 5 minute cache
-	return r.Set(fmt.Sprintf("cache:%s", hash), result, 5*time.Minute)
+// Stats computed by whichever replica holds the stats job lock, so every replica serves the same stats
+func (r *redisManager) SetStats(stats *model.Stats) error {
+	serialized, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return r.Set("stats", string(serialized), 0)
+}
+
+func (r *redisManager) GetStats() (*model.Stats, error) {
+	serialized, err := r.Get("stats")
+	if err != nil {
+		return nil, err
+	}
+	var stats model.Stats
+	if err := json.Unmarshal([]byte(serialized), &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
 }
 
-func (r *redisManager) GetCachedWork(hash string) (string, error) {
-	return r.Get(fmt.Sprintf("cache:%s", hash))
+// Client scoring, kept for each account and for each rig (worker ID) of an account
+const (
+	accountScoresKey = "clientscores:accounts"
+	rigScoresKey     = "clientscores:rigs"
+)
+
+// ClientScoreShares is the fraction of the total score each account and each rig holds
+type ClientScoreShares struct {
+	// Keyed by email
+	Accounts map[string]float64
+	// Keyed by worker ID
+	Rigs map[string]float64
 }
 
-// Client scoring
-func (r *redisManager) UpdateClientScore(ip string, points int) error {
-	return r.Hset("clientscores", ip, strconv.Itoa(points+r.GetClientScore(ip)))
+func (r *redisManager) UpdateClientScore(email string, workerID string, points int) error {
+	pipe := r.Client.TxPipeline()
+	pipe.HIncrBy(ctx, accountScoresKey, email, int64(points))
+	pipe.HIncrBy(ctx, rigScoresKey, workerID, int64(points))
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-func (r *redisManager) GetClientScore(ip string) int {
-	score, err := r.Hget("clientscores", ip)
+func (r *redisManager) GetClientScore(email string) int {
+	score, err := r.Hget(accountScoresKey, email)
 	if err != nil {
 		return 0
 	}
@@ -233,34 +482,184 @@ func (r *redisManager) GetClientScore(ip string) int {
 	return scoreInt
 }
 
-func (r *redisManager) FilterOverperformingClients() ([]string, error) {
-	ret, err := r.Hgetall("clientscores")
+// Fraction of the total of a scores hash held by each of its fields
+func (r *redisManager) scoreShares(key string) (map[string]float64, error) {
+	ret, err := r.Hgetall(key)
 	if err != nil {
 		return nil, err
 	}
 	totalScore := 0
-	for _, score := range ret {
+	scores := map[string]int{}
+	for field, score := range ret {
 		scoreInt, err := strconv.Atoi(score)
 		if err != nil {
-			totalScore += 0
+			scoreInt = 0
 		}
+		scores[field] = scoreInt
 		totalScore += scoreInt
 	}
 
-	// Remove clients whos score makes up 15% or more of total
-	var toBroadcast []string
-	for ip, score := range ret {
-		score, err := strconv.Atoi(score)
-		if err != nil {
-			score = 0
-		}
-		if float64(score)/float64(totalScore) >= 0.15 {
-			toBroadcast = append(toBroadcast, ip)
+	shares := map[string]float64{}
+	for field, score := range scores {
+		if totalScore > 0 {
+			shares[field] = float64(score) / float64(totalScore)
+		} else {
+			shares[field] = 0
 		}
 	}
-	return toBroadcast, nil
+	return shares, nil
+}
+
+func (r *redisManager) GetClientScoreShares() (*ClientScoreShares, error) {
+	accounts, err := r.scoreShares(accountScoresKey)
+	if err != nil {
+		return nil, err
+	}
+	rigs, err := r.scoreShares(rigScoresKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientScoreShares{Accounts: accounts, Rigs: rigs}, nil
 }
 
 func (r *redisManager) WipeClientScores() (int64, error) {
-	return r.Del("clientscores")
+	// clientscores was keyed by IP before scores were kept per account
+	return r.Del(accountScoresKey, rigScoresKey, "clientscores")
+}
+
+// Precache registry, hashes we generated work for and are waiting for the next block of
+// Shared by every replica, entries expire and the oldest are evicted past a maximum
+const (
+	precacheEntriesKey = "precache:entries"
+	precacheIndexKey   = "precache:index"
+	precacheMetricsKey = "precache:metrics"
+)
+
+// AddPrecache registers a hash requested by a service, it keeps its first requester if it's already registered
+func (r *redisManager) AddPrecache(hash string, requesterEmail string, maxEntries int64) error {
+	added, err := r.Client.HSetNX(ctx, precacheEntriesKey, hash, requesterEmail).Result()
+	if err != nil {
+		return err
+	}
+	// Requested again, so wait longer for it
+	if err := r.Client.ZAdd(ctx, precacheIndexKey, redis.Z{Score: float64(time.Now().Unix()), Member: hash}).Err(); err != nil {
+		return err
+	}
+	if added {
+		r.Client.HIncrBy(ctx, precacheMetricsKey, fmt.Sprintf("entries:%s", requesterEmail), 1)
+	}
+
+	// Evict the oldest if we're over
+	count, err := r.Client.ZCard(ctx, precacheIndexKey).Result()
+	if err != nil || count <= maxEntries {
+		return err
+	}
+	oldest, err := r.Client.ZPopMin(ctx, precacheIndexKey, count-maxEntries).Result()
+	if err != nil {
+		return err
+	}
+	for _, z := range oldest {
+		r.removePrecache(z.Member.(string), "evicted")
+	}
+	return nil
+}
+
+// TakePrecache removes the hash from the registry, returns false if it wasn't registered
+// Only one replica gets true for a hash, countMiss counts it as a miss if it wasn't registered
+func (r *redisManager) TakePrecache(hash string, validFor time.Duration, countMiss bool) (bool, error) {
+	score, err := r.Client.ZScore(ctx, precacheIndexKey, hash).Result()
+	if errors.Is(err, redis.Nil) {
+		if countMiss {
+			r.Client.HIncrBy(ctx, precacheMetricsKey, "misses", 1)
+		}
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	r.Client.ZRem(ctx, precacheIndexKey, hash)
+	// The expiry job may not have gotten to it yet
+	if time.Since(time.Unix(int64(score), 0)) > validFor {
+		r.removePrecache(hash, "expired")
+		return false, nil
+	}
+	return r.removePrecache(hash, "hits"), nil
+}
+
+// ExpirePrecache removes hashes registered longer ago than validFor, returns how many
+func (r *redisManager) ExpirePrecache(validFor time.Duration) (int, error) {
+	cutoff := time.Now().Add(-validFor).Unix()
+	expired, err := r.Client.ZRangeByScore(ctx, precacheIndexKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff, 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	nExpired := 0
+	for _, hash := range expired {
+		r.Client.ZRem(ctx, precacheIndexKey, hash)
+		if r.removePrecache(hash, "expired") {
+			nExpired++
+		}
+	}
+	return nExpired, nil
+}
+
+// Delete the entry and count why, returns false if somebody else already deleted it
+func (r *redisManager) removePrecache(hash string, reason string) bool {
+	requesterEmail, err := r.Hget(precacheEntriesKey, hash)
+	if err != nil {
+		return false
+	}
+	deleted, err := r.Client.HDel(ctx, precacheEntriesKey, hash).Result()
+	if err != nil || deleted == 0 {
+		return false
+	}
+	r.Client.HIncrBy(ctx, precacheMetricsKey, reason, 1)
+	r.Client.HIncrBy(ctx, precacheMetricsKey, fmt.Sprintf("%s:%s", reason, requesterEmail), 1)
+	r.Client.HIncrBy(ctx, precacheMetricsKey, fmt.Sprintf("entries:%s", requesterEmail), -1)
+	return true
+}
+
+// GetPrecacheStats returns the overall stats, and the stats of each service by email
+func (r *redisManager) GetPrecacheStats() (*model.PrecacheStats, map[string]*model.PrecacheStats, error) {
+	metrics, err := r.Hgetall(precacheMetricsKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := r.Hlen(precacheEntriesKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	total := &model.PrecacheStats{Entries: int(entries)}
+	services := make(map[string]*model.PrecacheStats)
+	for field, value := range metrics {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		reason, requesterEmail, perService := strings.Cut(field, ":")
+		stats := total
+		if perService {
+			if _, ok := services[requesterEmail]; !ok {
+				services[requesterEmail] = &model.PrecacheStats{}
+			}
+			stats = services[requesterEmail]
+		}
+		switch reason {
+		case "entries":
+			if perService {
+				stats.Entries = count
+			}
+		case "hits":
+			stats.Hits = count
+		case "misses":
+			stats.Misses = count
+		case "expired":
+			stats.Expired = count
+		case "evicted":
+			stats.Evicted = count
+		}
+	}
+	return total, services, nil
 }
@@ -1,10 +1,15 @@
 package database
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
 	utils "github.com/bananocoin/boompow/libs/utils/testing"
+	goredis "github.com/go-redis/redis/v9"
 	"github.com/google/uuid"
 )
 
@@ -62,18 +67,171 @@ func TestRedis(t *testing.T) {
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, int64(0), ret)
 
-	// Service token bits
+	// Service tokens from before they were in postgres
 	uid := uuid.New()
-	if err := redis.AddServiceToken(uid, "token"); err != nil {
+	if err := redis.Hset("servicetokens", "token", uid.String()); err != nil {
 		t.Errorf("Error adding service token: %s", err)
 	}
-	uidStr, err := redis.GetServiceTokenUser("token")
+	legacy, err := redis.GetLegacyServiceTokens()
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, uid.String(), uidStr)
-	_, err = redis.GetServiceTokenUser("nonexistentoken")
+	utils.AssertEqual(t, 1, len(legacy))
+	utils.AssertEqual(t, uid.String(), legacy["token"])
+
+	// Work status bits
+	status := &models.WorkRequestStatus{
+		RequestID: "request",
+		Hash:      "hash",
+		Status:    models.WORK_PENDING,
+	}
+	if err := redis.SetWorkStatus("email", status); err != nil {
+		t.Errorf("Error setting work status: %s", err)
+	}
+	saved, err := redis.GetWorkStatus("email", "request")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, models.WORK_PENDING, saved.Status)
+	utils.AssertEqual(t, "hash", saved.Hash)
+	// Other requesters can't see it
+	_, err = redis.GetWorkStatus("other", "request")
 	utils.AssertEqual(t, true, err != nil)
+}
+
+func TestPrecacheRegistry(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	redis := GetRedisDB()
+
+	utils.AssertEqual(t, nil, redis.AddPrecache("A", "service1", 2))
+	utils.AssertEqual(t, nil, redis.AddPrecache("B", "service2", 2))
+	// Over the max, A is the oldest
+	redis.Client.ZAdd(ctx, precacheIndexKey, goredis.Z{Score: float64(time.Now().Add(-time.Minute).Unix()), Member: "A"})
+	utils.AssertEqual(t, nil, redis.AddPrecache("C", "service1", 2))
+
+	taken, err := redis.TakePrecache("A", time.Hour, true)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, taken)
+	taken, err = redis.TakePrecache("B", time.Hour, true)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, taken)
+	// Only once
+	taken, _ = redis.TakePrecache("B", time.Hour, false)
+	utils.AssertEqual(t, false, taken)
+
+	// Expire C
+	redis.Client.ZAdd(ctx, precacheIndexKey, goredis.Z{Score: float64(time.Now().Add(-2 * time.Hour).Unix()), Member: "C"})
+	expired, err := redis.ExpirePrecache(time.Hour)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, expired)
+
+	total, services, err := redis.GetPrecacheStats()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 0, total.Entries)
+	utils.AssertEqual(t, 1, total.Hits)
+	utils.AssertEqual(t, 1, total.Misses)
+	utils.AssertEqual(t, 1, total.Expired)
+	utils.AssertEqual(t, 1, total.Evicted)
+	utils.AssertEqual(t, 1, services["service1"].Evicted)
+	utils.AssertEqual(t, 1, services["service1"].Expired)
+	utils.AssertEqual(t, 0, services["service1"].Entries)
+	utils.AssertEqual(t, 1, services["service2"].Hits)
+}
+
+func TestWorkCache(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	redis := GetRedisDB()
+
+	work := &models.CachedWork{
+		Result:     "205452237a9b01f4",
+		Difficulty: serializableModels.DifficultyFromMultiplier(64),
+	}
+	utils.AssertEqual(t, nil, redis.CacheWork("hash", work))
+	cached, err := redis.GetCachedWork("hash")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, *work, *cached)
+
+	utils.AssertEqual(t, nil, redis.UncacheWork("hash"))
+	_, err = redis.GetCachedWork("hash")
+	utils.AssertEqual(t, true, err != nil)
+
+	// Cache hits
+	redis.IncrementCacheHits("service1")
+	redis.IncrementCacheHits("service1")
+	redis.IncrementCacheHits("service2")
+	hits, err := redis.GetCacheHits()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, hits["service1"])
+	utils.AssertEqual(t, 1, hits["service2"])
+}
+
+func TestClientScores(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	redis := GetRedisDB()
+	redis.WipeClientScores()
+
+	// One account with two rigs, and a smaller account
+	utils.AssertEqual(t, nil, redis.UpdateClientScore("a", "a/one", 6))
+	utils.AssertEqual(t, nil, redis.UpdateClientScore("a", "a/two", 2))
+	utils.AssertEqual(t, nil, redis.UpdateClientScore("b", "b/default", 2))
+	utils.AssertEqual(t, 8, redis.GetClientScore("a"))
+
+	shares, err := redis.GetClientScoreShares()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 0.8, shares.Accounts["a"])
+	utils.AssertEqual(t, 0.6, shares.Rigs["a/one"])
+	utils.AssertEqual(t, 0.2, shares.Rigs["b/default"])
 
-	tokenStr, err := redis.GetServiceTokenForUser(uid)
+	_, err = redis.WipeClientScores()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 0, redis.GetClientScore("a"))
+}
+
+func TestWorkStatusPubSub(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	redis := GetRedisDB()
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	statuses, err := redis.SubscribeWorkStatus(subCtx, "a@b.c")
+	utils.AssertEqual(t, nil, err)
+
+	// Other requesters' statuses don't reach this subscription
+	utils.AssertEqual(t, nil, redis.PublishWorkStatus("other@b.c", &models.WorkRequestStatus{RequestID: "other"}))
+	utils.AssertEqual(t, nil, redis.PublishWorkStatus("a@b.c", &models.WorkRequestStatus{RequestID: "mine", Status: models.WORK_COMPLETED}))
+	select {
+	case status := <-statuses:
+		utils.AssertEqual(t, "mine", status.RequestID)
+		utils.AssertEqual(t, models.WORK_COMPLETED, status.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for work status")
+	}
+
+	// Ending the subscription closes the channel
+	cancel()
+	select {
+	case _, open := <-statuses:
+		utils.AssertEqual(t, false, open)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the subscription to end")
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+
+	redis := GetRedisDB()
+	key := "lock:test-lock"
+	redis.Del(key)
+
+	// Takes it, then only extends it for the same owner
+	acquired, err := redis.AcquireLock("test-lock", "one", time.Minute)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, acquired)
+	acquired, err = redis.AcquireLock("test-lock", "two", time.Minute)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, acquired)
+	acquired, err = redis.AcquireLock("test-lock", "one", time.Hour)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, acquired)
+	ttl, err := redis.Client.TTL(context.Background(), key).Result()
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, "token", tokenStr)
+	utils.AssertEqual(t, true, ttl > time.Minute)
+	holder, _ := redis.Get(key)
+	utils.AssertEqual(t, "one", holder)
 }
@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/libs/utils"
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+)
+
+// Job is a task that runs periodically on one replica at a time
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Up to this much is added to every interval, so replicas don't all wake up at once
+	Jitter time.Duration
+	// Runs on the replica that holds the job's lock
+	Run func() error
+	// Optional, runs on the other replicas instead of Run
+	Follow func() error
+}
+
+// Supervisor runs jobs on their schedule, using a redis lock to elect the replica that runs each one
+// A job that fails or panics is logged and tried again on its next run
+type Supervisor struct {
+	// Identifies this replica as a lock holder
+	ReplicaID string
+	jobs      []*Job
+	mu        sync.Mutex
+	// Last time each job ran successfully on this replica
+	lastSuccess map[string]time.Time
+}
+
+func NewSupervisor() *Supervisor {
+	replicaID, err := os.Hostname()
+	if err != nil || replicaID == "" {
+		replicaID = uuid.NewString()
+	}
+	return &Supervisor{
+		ReplicaID:   replicaID,
+		lastSuccess: make(map[string]time.Time),
+	}
+}
+
+func (s *Supervisor) Add(job *Job) {
+	if job.Interval <= 0 {
+		klog.Errorf("Not scheduling job %s, interval must be positive", job.Name)
+		return
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every job right away and then on its schedule, until the context is done
+func (s *Supervisor) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+// LastSuccess returns when the job last ran successfully on this replica
+func (s *Supervisor) LastSuccess(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.lastSuccess[name]
+	return t, ok
+}
+
+func (s *Supervisor) loop(ctx context.Context, job *Job) {
+	for {
+		s.runOnce(job)
+		timer := time.NewTimer(nextDelay(job))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func nextDelay(job *Job) time.Duration {
+	if job.Jitter <= 0 {
+		return job.Interval
+	}
+	return job.Interval + time.Duration(rand.Int63n(int64(job.Jitter)))
+}
+
+func (s *Supervisor) runOnce(job *Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			klog.Errorf("Job %s panicked: %v", job.Name, r)
+		}
+	}()
+
+	// Hold the lock a little longer than the longest possible wait, so it survives until our next run
+	leader, err := database.GetRedisDB().AcquireLock(fmt.Sprintf("job:%s", job.Name), s.ReplicaID, 2*(job.Interval+job.Jitter))
+	if err != nil {
+		klog.Errorf("Error acquiring lock for job %s: %v", job.Name, err)
+		return
+	}
+
+	run := job.Run
+	if !leader {
+		if job.Follow == nil {
+			return
+		}
+		run = job.Follow
+	}
+	startT := time.Now()
+	if err := run(); err != nil {
+		klog.Errorf("Job %s failed after %v: %v", job.Name, time.Since(startT), err)
+		return
+	}
+	s.mu.Lock()
+	s.lastSuccess[job.Name] = time.Now()
+	s.mu.Unlock()
+	klog.V(3).Infof("Job %s finished in %v (leader: %t)", job.Name, time.Since(startT), leader)
+}
+
+// GetDuration reads a duration such as "10m" from the environment
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(utils.GetEnv(key, fallback.String()))
+	if err != nil || duration < 0 {
+		klog.Errorf("Invalid %s, using default %v", key, fallback)
+		return fallback
+	}
+	return duration
+}
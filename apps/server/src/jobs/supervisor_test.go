@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestOnlyLeaderRuns(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+
+	runs := 0
+	follows := 0
+	job := &Job{
+		Name:     "test",
+		Interval: time.Minute,
+		Run: func() error {
+			runs++
+			return nil
+		},
+		Follow: func() error {
+			follows++
+			return nil
+		},
+	}
+
+	leader := NewSupervisor()
+	leader.ReplicaID = "leader"
+	follower := NewSupervisor()
+	follower.ReplicaID = "follower"
+
+	leader.runOnce(job)
+	follower.runOnce(job)
+	// The leader keeps the lock on later runs
+	leader.runOnce(job)
+
+	utils.AssertEqual(t, 2, runs)
+	utils.AssertEqual(t, 1, follows)
+	_, ok := leader.LastSuccess("test")
+	utils.AssertEqual(t, true, ok)
+}
+
+func TestFailingJobs(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+
+	supervisor := NewSupervisor()
+	supervisor.runOnce(&Job{
+		Name:     "failing",
+		Interval: time.Minute,
+		Run: func() error {
+			return errors.New("failed")
+		},
+	})
+	_, ok := supervisor.LastSuccess("failing")
+	utils.AssertEqual(t, false, ok)
+
+	// Panics don't take down the supervisor
+	supervisor.runOnce(&Job{
+		Name:     "panicking",
+		Interval: time.Minute,
+		Run: func() error {
+			panic("panicked")
+		},
+	})
+	_, ok = supervisor.LastSuccess("panicking")
+	utils.AssertEqual(t, false, ok)
+}
+
+func TestNextDelay(t *testing.T) {
+	job := &Job{
+		Interval: time.Minute,
+		Jitter:   10 * time.Second,
+	}
+	for i := 0; i < 100; i++ {
+		delay := nextDelay(job)
+		utils.AssertEqual(t, true, delay >= time.Minute && delay < time.Minute+10*time.Second)
+	}
+
+	job.Jitter = 0
+	utils.AssertEqual(t, time.Minute, nextDelay(job))
+}
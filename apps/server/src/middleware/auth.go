@@ -3,18 +3,17 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/bananocoin/boompow/apps/server/src/database"
 	"github.com/bananocoin/boompow/apps/server/src/models"
 	"github.com/bananocoin/boompow/apps/server/src/repository"
-	"github.com/bananocoin/boompow/libs/utils"
 	"github.com/bananocoin/boompow/libs/utils/auth"
 	"github.com/bananocoin/boompow/libs/utils/net"
-	"github.com/google/uuid"
-	"golang.org/x/exp/slices"
 	"k8s.io/klog/v2"
 )
 
@@ -38,95 +37,104 @@ func formatGraphqlError(ctx context.Context, msg string) string {
 	return string(marshalled)
 }
 
-func AuthMiddleware(userRepo *repository.UserService) func(http.Handler) http.Handler {
+var errInvalidToken = errors.New("Invalid Token")
+
+// Determine who the authorization header belongs to, origin is only used for logging
+// Returns nil without an error if the request should continue unauthenticated
+func authenticate(header string, origin string, userRepo *repository.UserService, tokenRepo repository.ServiceTokenRepo) (*UserContextValue, error) {
+	// There are two types of tokens
+	// The first is a JWT token that is used to authenticate users
+	// The second is an "application" token that is used to authenticate services (no expiry)
+
+	// Allow unauthenticated users in
+	if header == "" {
+		return nil, nil
+	}
+
+	// Determine token type
+	if strings.HasPrefix(header, "resetpassword:") {
+		token := header[len("resetpassword:"):]
+		email, err := auth.ParseToken(token)
+		if err != nil {
+			return nil, errInvalidToken
+		}
+		// Get from redis
+		_, err = database.GetRedisDB().GetResetPasswordToken(email)
+		if err != nil {
+			return nil, errInvalidToken
+		}
+		// create user and check if user exists in db
+		user, err := userRepo.GetUser(nil, &email)
+		if err != nil {
+			return nil, nil
+		}
+		return &UserContextValue{User: user, AuthType: "token"}, nil
+	} else if strings.HasPrefix(header, "service:") {
+		// Service token, revoked and expired tokens aren't found
+		serviceToken, err := tokenRepo.AuthenticateServiceToken(header)
+		if err != nil {
+			klog.Errorf("INVALID TOKEN ATTEMPT %s", origin)
+			return nil, errInvalidToken
+		}
+		// create user and check if user exists in db
+		user, err := userRepo.GetUser(&serviceToken.UserID, nil)
+		if err != nil || user.Banned {
+			return nil, nil
+		}
+		return &UserContextValue{User: user, AuthType: "token"}, nil
+	}
+
+	email, err := auth.ParseToken(header)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	// create user and check if user exists in db
+	user, err := userRepo.GetUser(nil, &email)
+	if err != nil {
+		return nil, nil
+	}
+	return &UserContextValue{User: user, AuthType: "jwt"}, nil
+}
+
+func AuthMiddleware(userRepo *repository.UserService, tokenRepo repository.ServiceTokenRepo) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// There are two types of tokens
-			// The first is a JWT token that is used to authenticate users
-			// The second is an "application" token that is used to authenticate services (no expiry)
-			header := r.Header.Get("Authorization")
-
-			// Allow unauthenticated users in
-			if header == "" {
-				next.ServeHTTP(w, r)
+			contextValue, err := authenticate(r.Header.Get("Authorization"), net.GetIPAddress(r), userRepo, tokenRepo)
+			if err != nil {
+				http.Error(w, formatGraphqlError(r.Context(), err.Error()), http.StatusForbidden)
 				return
 			}
-
-			var ctx context.Context
-
-			// Determine token type
-			if strings.HasPrefix(header, "resetpassword:") {
-				token := header[len("resetpassword:"):]
-				email, err := auth.ParseToken(token)
-				if err != nil {
-					http.Error(w, formatGraphqlError(r.Context(), "Invalid Token"), http.StatusForbidden)
-					return
-				}
-				// Get from redis
-				_, err = database.GetRedisDB().GetResetPasswordToken(email)
-				if err != nil {
-					http.Error(w, formatGraphqlError(r.Context(), "Invalid Token"), http.StatusForbidden)
-					return
-				}
-				// create user and check if user exists in db
-				user, err := userRepo.GetUser(nil, &email)
-				if err != nil {
-					next.ServeHTTP(w, r)
-					return
-				}
-				// put it in context
-				ctx = context.WithValue(r.Context(), userCtxKey, &UserContextValue{User: user, AuthType: "token"})
-			} else if strings.HasPrefix(header, "service:") {
-				// Service token
-				if !slices.Contains(utils.GetServiceTokens(), header) {
-					klog.Errorf("INVALID TOKEN ATTEMPT 1 %s:%s", header, net.GetIPAddress(r))
-					http.Error(w, formatGraphqlError(r.Context(), "Invalid Token"), http.StatusForbidden)
-					return
-				}
-				userID, err := database.GetRedisDB().GetServiceTokenUser(header)
-				if err != nil {
-					klog.Errorf("INVALID TOKEN ATTEMPT %s:%s", header, net.GetIPAddress(r))
-					http.Error(w, formatGraphqlError(r.Context(), "Invalid Token"), http.StatusForbidden)
-					return
-				}
-				userUUID, err := uuid.Parse(userID)
-				if err != nil {
-					http.Error(w, formatGraphqlError(r.Context(), "Invalid Token"), http.StatusForbidden)
-					return
-				}
-				// create user and check if user exists in db
-				user, err := userRepo.GetUser(&userUUID, nil)
-				if err != nil || user.Banned {
-					next.ServeHTTP(w, r)
-					return
-				}
-				// put it in context
-				ctx = context.WithValue(r.Context(), userCtxKey, &UserContextValue{User: user, AuthType: "token"})
-			} else {
-				tokenStr := header
-				email, err := auth.ParseToken(tokenStr)
-				if err != nil {
-					http.Error(w, formatGraphqlError(r.Context(), "Invalid Token"), http.StatusForbidden)
-					return
-				}
-				// create user and check if user exists in db
-				user, err := userRepo.GetUser(nil, &email)
-				if err != nil {
-					next.ServeHTTP(w, r)
-					return
-				}
-				// put it in context
-				ctx = context.WithValue(r.Context(), userCtxKey, &UserContextValue{User: user, AuthType: "jwt"})
-
+			if contextValue == nil {
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			// and call the next with our new context
-			r = r.WithContext(ctx)
+			// put it in context and call the next with our new context
+			r = r.WithContext(context.WithValue(r.Context(), userCtxKey, contextValue))
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// WebsocketInitFunc authenticates graphql websocket connections with the Authorization field of the init payload
+// Browsers can't set headers on websockets, so this is the only way to authenticate subscriptions
+func WebsocketInitFunc(userRepo *repository.UserService, tokenRepo repository.ServiceTokenRepo) transport.WebsocketInitFunc {
+	return func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+		// The connection was upgraded from a request that already went through AuthMiddleware
+		if forContext(ctx) != nil {
+			return ctx, nil
+		}
+		contextValue, err := authenticate(initPayload.Authorization(), "websocket", userRepo, tokenRepo)
+		if err != nil {
+			return nil, err
+		}
+		if contextValue == nil {
+			return ctx, nil
+		}
+		return context.WithValue(ctx, userCtxKey, contextValue), nil
+	}
+}
+
 // forContext finds the user from the context. REQUIRES Middleware to have run.
 func forContext(ctx context.Context) *UserContextValue {
 	raw, _ := ctx.Value(userCtxKey).(*UserContextValue)
@@ -145,7 +153,7 @@ func AuthorizedUser(ctx context.Context) *UserContextValue {
 // AuthorizedProvider returns user from context if they are an authorized provider type
 func AuthorizedProvider(ctx context.Context) *UserContextValue {
 	contextValue := forContext(ctx)
-	if contextValue == nil || contextValue.User == nil || contextValue.AuthType != "jwt" || !contextValue.User.EmailVerified || contextValue.User.Type != models.PROVIDER {
+	if contextValue == nil || contextValue.User == nil || contextValue.AuthType != "jwt" || !contextValue.User.EmailVerified || contextValue.User.Banned || contextValue.User.Type != models.PROVIDER {
 		return nil
 	}
 	return contextValue
@@ -169,6 +177,15 @@ func AuthorizedServiceToken(ctx context.Context) *UserContextValue {
 	return contextValue
 }
 
+// AuthorizedAdmin returns user from context if they are logged in as an admin
+func AuthorizedAdmin(ctx context.Context) *UserContextValue {
+	contextValue := AuthorizedUser(ctx)
+	if contextValue == nil || !contextValue.User.EmailVerified || contextValue.User.Banned || contextValue.User.Type != models.ADMIN {
+		return nil
+	}
+	return contextValue
+}
+
 // AuthorizedChangePassword getsuser from context if they are authorized to change their password
 func AuthorizedChangePassword(ctx context.Context) *UserContextValue {
 	contextValue := forContext(ctx)
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	"github.com/bananocoin/boompow/libs/utils/net"
+	"github.com/go-chi/httprate"
+)
+
+var ipDecisionCtxKey = &contextKey{"ipDecision"}
+
+// IPPolicyMiddleware applies the IP policy to every request, worker websockets and GraphQL alike
+// Denied addresses get a 403 and rate limited ones a 429 past their rule's limit
+// The decision goes in the context so work from no_reward addresses isn't rewarded
+func IPPolicyMiddleware(policy func() *config.IPPolicy) func(http.Handler) http.Handler {
+	limiters := &ipRateLimiters{limiters: make(map[string]func(http.Handler) http.Handler)}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			decision := policy().Evaluate(net.GetIPAddress(r))
+			if decision.Action == config.IPActionDeny {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("403 - Forbidden"))
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ipDecisionCtxKey, &decision))
+			if decision.Action == config.IPActionRateLimit {
+				limiters.get(decision)(next).ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// One limiter per rule, so addresses under different rules don't share a budget
+type ipRateLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]func(http.Handler) http.Handler
+}
+
+func (l *ipRateLimiters) get(decision config.IPDecision) func(http.Handler) http.Handler {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// The limit can change when the policy is reloaded
+	key := fmt.Sprintf("%s/%d", decision.Rule, decision.RateLimit)
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = httprate.Limit(
+			decision.RateLimit,
+			time.Minute,
+			httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+				return net.GetIPAddress(r), nil
+			}),
+		)
+		l.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// IPDecisionFor finds what the IP policy said about the request, nil if the middleware didn't run
+func IPDecisionFor(ctx context.Context) *config.IPDecision {
+	raw, _ := ctx.Value(ipDecisionCtxKey).(*config.IPDecision)
+	return raw
+}
+
+// IPNoReward is true if work from the request's address shouldn't be rewarded
+func IPNoReward(ctx context.Context) bool {
+	decision := IPDecisionFor(ctx)
+	return decision != nil && decision.Action == config.IPActionNoReward
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bananocoin/boompow/apps/server/src/config"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestIPPolicyMiddleware(t *testing.T) {
+	policyConfig, err := config.ParseIPPolicy([]byte(`{"rules": [
+		{"name": "blocked", "action": "deny", "cidrs": ["203.0.113.0/24"]},
+		{"name": "vpn", "action": "no_reward", "cidrs": ["198.51.100.0/24"]},
+		{"name": "cloud", "action": "rate_limit", "rateLimit": 2, "cidrs": ["192.0.2.0/24"]}
+	]}`))
+	utils.AssertEqual(t, nil, err)
+	policy, err := config.BuildIPPolicy(policyConfig, http.DefaultClient)
+	utils.AssertEqual(t, nil, err)
+
+	var noReward bool
+	handler := IPPolicyMiddleware(func() *config.IPPolicy { return policy })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		noReward = IPNoReward(r.Context())
+	}))
+	serve := func(ip string) int {
+		request := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+		request.RemoteAddr = ip + ":443"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	utils.AssertEqual(t, http.StatusForbidden, serve("203.0.113.1"))
+
+	utils.AssertEqual(t, http.StatusOK, serve("198.51.100.1"))
+	utils.AssertEqual(t, true, noReward)
+	utils.AssertEqual(t, http.StatusOK, serve("127.0.0.1"))
+	utils.AssertEqual(t, false, noReward)
+
+	// The limit is per address
+	utils.AssertEqual(t, http.StatusOK, serve("192.0.2.1"))
+	utils.AssertEqual(t, http.StatusOK, serve("192.0.2.1"))
+	utils.AssertEqual(t, http.StatusTooManyRequests, serve("192.0.2.1"))
+	utils.AssertEqual(t, http.StatusOK, serve("192.0.2.2"))
+}
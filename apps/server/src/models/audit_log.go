@@ -0,0 +1,27 @@
+package models
+
+import "github.com/google/uuid"
+
+type AuditAction string
+
+const (
+	AUDIT_WORKER_EXCLUDED     AuditAction = "WORKER_EXCLUDED"
+	AUDIT_WORKER_DISCONNECTED AuditAction = "WORKER_DISCONNECTED"
+	AUDIT_USER_BANNED         AuditAction = "USER_BANNED"
+	AUDIT_USER_UNBANNED       AuditAction = "USER_UNBANNED"
+	AUDIT_SERVICE_APPROVED    AuditAction = "SERVICE_APPROVED"
+	AUDIT_QUOTA_SET           AuditAction = "QUOTA_SET"
+	AUDIT_REWARDS_EXCLUDED    AuditAction = "REWARDS_EXCLUDED"
+	AUDIT_REWARDS_INCLUDED    AuditAction = "REWARDS_INCLUDED"
+	AUDIT_ADMIN_GRANTED       AuditAction = "ADMIN_GRANTED"
+)
+
+// Record of an action taken against a user
+type AuditLog struct {
+	Base
+	UserID uuid.UUID `json:"userId" gorm:"index;not null"`
+	// Who took the action, nil if it was automatic
+	ActorID *uuid.UUID  `json:"actorId"`
+	Action  AuditAction `json:"action" gorm:"not null"`
+	Reason  string      `json:"reason"`
+}
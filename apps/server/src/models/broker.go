@@ -0,0 +1,47 @@
+package models
+
+import "sync"
+
+// How many values a subscriber can fall behind before it starts missing them
+const brokerBufferSize = 10
+
+// Broker fans out published values to every subscriber
+// Slow subscribers miss values rather than block the publisher
+type Broker[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+}
+
+func NewBroker[T any]() *Broker[T] {
+	return &Broker[T]{
+		subscribers: make(map[chan T]struct{}),
+	}
+}
+
+// Subscribe returns a channel of published values, and a function to stop receiving them that closes the channel
+func (b *Broker[T]) Subscribe() (<-chan T, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan T, brokerBufferSize)
+	b.subscribers[ch] = struct{}{}
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, ch)
+			close(ch)
+		})
+	}
+}
+
+func (b *Broker[T]) Publish(value T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- value:
+		default:
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker[int]()
+
+	first, unsubscribeFirst := broker.Subscribe()
+	second, unsubscribeSecond := broker.Subscribe()
+
+	broker.Publish(1)
+	utils.AssertEqual(t, 1, <-first)
+	utils.AssertEqual(t, 1, <-second)
+
+	// Unsubscribed channels are closed and don't receive anything else
+	unsubscribeFirst()
+	broker.Publish(2)
+	_, ok := <-first
+	utils.AssertEqual(t, false, ok)
+	utils.AssertEqual(t, 2, <-second)
+
+	// Full subscribers miss values instead of blocking
+	for i := 0; i < brokerBufferSize+5; i++ {
+		broker.Publish(i)
+	}
+	utils.AssertEqual(t, brokerBufferSize, len(second))
+
+	// Safe to call more than once
+	unsubscribeSecond()
+	unsubscribeSecond()
+}
@@ -0,0 +1,10 @@
+package models
+
+import serializableModels "github.com/bananocoin/boompow/libs/models"
+
+// CachedWork is a result and the difficulty it achieved, which can be more than was requested
+// It can answer any request for the same hash at or below that difficulty
+type CachedWork struct {
+	Result     string                        `json:"result"`
+	Difficulty serializableModels.Difficulty `json:"difficulty"`
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+)
+
+var (
+	// An in-flight request ran past its deadline
+	ErrInFlightExpired = errors.New("timeout")
+	// An in-flight request was cancelled before it got work
+	ErrInFlightCancelled = errors.New("cancelled")
+)
+
+// InFlightRequest is a work request we sent to workers and are waiting on
+type InFlightRequest struct {
+	BlockAward           bool
+	RequesterEmail       string
+	RequestID            string
+	Hash                 string
+	DifficultyMultiplier int
+	Difficulty           serializableModels.Difficulty
+	Network              string
+	Precache             bool
+	Priority             serializableModels.Priority
+	// Work responses for this request
+	Chan      chan []byte
+	CreatedAt time.Time
+	Deadline  time.Time
+
+	// Everything below is guarded by the registry's lock
+	workersAsked int
+	// Closed when the request expires or is cancelled, err says which
+	done  chan struct{}
+	err   error
+	timer *time.Timer
+}
+
+// Done is closed when the request expires or is cancelled
+func (r *InFlightRequest) Done() <-chan struct{} {
+	return r.done
+}
+
+// InFlightSnapshot is a copy of an in-flight request's state at one point in time
+type InFlightSnapshot struct {
+	RequestID            string
+	Hash                 string
+	RequesterEmail       string
+	DifficultyMultiplier int
+	Difficulty           serializableModels.Difficulty
+	Network              string
+	Precache             bool
+	Priority             serializableModels.Priority
+	CreatedAt            time.Time
+	Deadline             time.Time
+	WorkersAsked         int
+}
+
+// InFlightRegistry keeps the in-flight requests, indexed by request ID and by hash
+type InFlightRegistry struct {
+	mu   sync.RWMutex
+	byID map[string]*InFlightRequest
+	// Upper case hash -> request ID -> request
+	byHash map[string]map[string]*InFlightRequest
+}
+
+func NewInFlightRegistry() *InFlightRegistry {
+	return &InFlightRegistry{
+		byID:   make(map[string]*InFlightRequest),
+		byHash: make(map[string]map[string]*InFlightRequest),
+	}
+}
+
+// Put adds a request, it expires at its deadline if it's still here then
+// Returns false if a request with the same ID is already in flight
+func (r *InFlightRegistry) Put(request *InFlightRequest) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byID[request.RequestID]; ok {
+		return false
+	}
+	if request.CreatedAt.IsZero() {
+		request.CreatedAt = time.Now()
+	}
+	request.done = make(chan struct{})
+	r.byID[request.RequestID] = request
+	key := strings.ToUpper(request.Hash)
+	if r.byHash[key] == nil {
+		r.byHash[key] = make(map[string]*InFlightRequest)
+	}
+	r.byHash[key][request.RequestID] = request
+	if !request.Deadline.IsZero() {
+		request.timer = time.AfterFunc(time.Until(request.Deadline), func() {
+			r.stop(request.RequestID, ErrInFlightExpired)
+		})
+	}
+	return true
+}
+
+// Get the request with this ID, nil if it isn't in flight
+func (r *InFlightRegistry) Get(requestID string) *InFlightRequest {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byID[requestID]
+}
+
+func (r *InFlightRegistry) Exists(requestID string) bool {
+	return r.Get(requestID) != nil
+}
+
+func (r *InFlightRegistry) HashExists(hash string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byHash[strings.ToUpper(hash)]) > 0
+}
+
+// GetByHash returns the requests in flight for a hash
+func (r *InFlightRegistry) GetByHash(hash string) []*InFlightRequest {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	requests := []*InFlightRequest{}
+	for _, request := range r.byHash[strings.ToUpper(hash)] {
+		requests = append(requests, request)
+	}
+	return requests
+}
+
+// Delete removes a request once we're done waiting on it
+func (r *InFlightRegistry) Delete(requestID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	request, ok := r.byID[requestID]
+	if !ok {
+		return
+	}
+	if request.timer != nil {
+		request.timer.Stop()
+	}
+	delete(r.byID, requestID)
+	key := strings.ToUpper(request.Hash)
+	delete(r.byHash[key], requestID)
+	if len(r.byHash[key]) == 0 {
+		delete(r.byHash, key)
+	}
+}
+
+// Cancel stops whoever is waiting on the request, returns false if it isn't in flight or already stopped
+// The request stays in the registry until its waiter deletes it
+func (r *InFlightRegistry) Cancel(requestID string) bool {
+	return r.stop(requestID, ErrInFlightCancelled)
+}
+
+func (r *InFlightRegistry) stop(requestID string, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	request, ok := r.byID[requestID]
+	if !ok || request.err != nil {
+		return false
+	}
+	request.err = err
+	close(request.done)
+	return true
+}
+
+// Err says why the request stopped, nil if it's still running
+func (r *InFlightRegistry) Err(requestID string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if request, ok := r.byID[requestID]; ok {
+		return request.err
+	}
+	return nil
+}
+
+// AddWorkersAsked records that the request was sent to n more workers
+func (r *InFlightRegistry) AddWorkersAsked(requestID string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if request, ok := r.byID[requestID]; ok {
+		request.workersAsked += n
+	}
+}
+
+// Snapshot copies the requests in flight, oldest first
+func (r *InFlightRegistry) Snapshot() []InFlightSnapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	snapshot := make([]InFlightSnapshot, 0, len(r.byID))
+	for _, request := range r.byID {
+		snapshot = append(snapshot, InFlightSnapshot{
+			RequestID:            request.RequestID,
+			Hash:                 request.Hash,
+			RequesterEmail:       request.RequesterEmail,
+			DifficultyMultiplier: request.DifficultyMultiplier,
+			Difficulty:           request.Difficulty,
+			Network:              request.Network,
+			Precache:             request.Precache,
+			Priority:             request.Priority,
+			CreatedAt:            request.CreatedAt,
+			Deadline:             request.Deadline,
+			WorkersAsked:         request.workersAsked,
+		})
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].CreatedAt.Before(snapshot[j].CreatedAt)
+	})
+	return snapshot
+}
+
+func (r *InFlightRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byID)
+}
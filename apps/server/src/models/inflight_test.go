@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestInFlightRegistry(t *testing.T) {
+	registry := NewInFlightRegistry()
+
+	// Add a few items
+	now := time.Now()
+	for i, id := range []string{"1", "2", "3"} {
+		ok := registry.Put(&InFlightRequest{
+			RequesterEmail:       id,
+			RequestID:            id,
+			Hash:                 "abc",
+			DifficultyMultiplier: 1,
+			CreatedAt:            now.Add(time.Duration(i) * time.Second),
+			Chan:                 make(chan []byte),
+		})
+		utils.AssertEqual(t, true, ok)
+	}
+	utils.AssertEqual(t, false, registry.Put(&InFlightRequest{RequestID: "1", Hash: "def"}))
+
+	utils.AssertEqual(t, 3, registry.Len())
+	utils.AssertEqual(t, true, registry.Exists("1"))
+	utils.AssertEqual(t, "abc", registry.Get("1").Hash)
+	// Hashes are looked up case insensitive
+	utils.AssertEqual(t, true, registry.HashExists("ABC"))
+	utils.AssertEqual(t, 3, len(registry.GetByHash("abc")))
+
+	registry.AddWorkersAsked("2", 3)
+	registry.AddWorkersAsked("2", 1)
+	snapshot := registry.Snapshot()
+	utils.AssertEqual(t, 3, len(snapshot))
+	utils.AssertEqual(t, "1", snapshot[0].RequestID)
+	utils.AssertEqual(t, 4, snapshot[1].WorkersAsked)
+
+	registry.Delete("1")
+	utils.AssertEqual(t, (*InFlightRequest)(nil), registry.Get("1"))
+	utils.AssertEqual(t, 2, registry.Len())
+	registry.Delete("2")
+	registry.Delete("3")
+	utils.AssertEqual(t, false, registry.HashExists("abc"))
+}
+
+func TestInFlightCancel(t *testing.T) {
+	registry := NewInFlightRegistry()
+	request := &InFlightRequest{RequestID: "1", Hash: "abc"}
+	registry.Put(request)
+
+	utils.AssertEqual(t, nil, registry.Err("1"))
+	utils.AssertEqual(t, true, registry.Cancel("1"))
+	<-request.Done()
+	utils.AssertEqual(t, ErrInFlightCancelled, registry.Err("1"))
+	// Already stopped
+	utils.AssertEqual(t, false, registry.Cancel("1"))
+	utils.AssertEqual(t, false, registry.Cancel("2"))
+}
+
+func TestInFlightDeadline(t *testing.T) {
+	registry := NewInFlightRegistry()
+	request := &InFlightRequest{RequestID: "1", Hash: "abc", Deadline: time.Now().Add(10 * time.Millisecond)}
+	registry.Put(request)
+
+	select {
+	case <-request.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Request didn't expire")
+	}
+	utils.AssertEqual(t, ErrInFlightExpired, registry.Err("1"))
+	// Still there until its waiter deletes it
+	utils.AssertEqual(t, true, registry.Exists("1"))
+	registry.Delete("1")
+	utils.AssertEqual(t, 0, registry.Len())
+}
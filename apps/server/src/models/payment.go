@@ -10,7 +10,7 @@ type Payment struct {
 	Base
 	BlockHash *string            `json:"block_hash" gorm:"uniqueIndex"`
 	SendId    string             `json:"send_id" gorm:"uniqueIndex;not null"`
-	Amount uint `json:"amount"`
+	Amount    uint               `json:"amount"`
 	SendJson  models.SendRequest `json:"send_json" gorm:"type:jsonb;not null"`
 	PaidTo    uuid.UUID          `json:"user_id" gorm:"not null"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+)
+
+// ServiceQuota limits how much work a service can request, zero means unlimited
+type ServiceQuota struct {
+	RequestsPerMinute int                           `json:"requestsPerMinute" gorm:"default:0;not null"`
+	RequestsPerDay    int                           `json:"requestsPerDay" gorm:"default:0;not null"`
+	MaxInFlight       int                           `json:"maxInFlight" gorm:"default:0;not null"`
+	MaxDifficulty     serializableModels.Difficulty `json:"maxDifficulty" gorm:"type:varchar(16)"`
+}
+
+// QuotaUsage is how much of its quota a service has used
+type QuotaUsage struct {
+	RequestsThisMinute int
+	RequestsToday      int
+	InFlight           int
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceToken lets a service request work, we only keep a hash of the token itself
+type ServiceToken struct {
+	Base
+	UserID uuid.UUID `json:"userId" gorm:"index;not null"`
+	// Chosen by the service to tell its tokens apart
+	Name      string `json:"name" gorm:"not null"`
+	TokenHash string `json:"-" gorm:"uniqueIndex;not null"`
+	// Start of the token, shown so services can tell which token is which
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	// Never expires if nil
+	ExpiresAt *time.Time `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// Active returns whether the token can be used at this time
+func (t *ServiceToken) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
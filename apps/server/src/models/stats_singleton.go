@@ -9,7 +9,10 @@ import (
 var lock = &sync.Mutex{}
 
 type StatsSingleton struct {
+	mu    sync.Mutex
 	Stats *model.Stats
+	// Notified whenever the stats change
+	Updates *Broker[*model.Stats]
 }
 
 var statsInstance *StatsSingleton
@@ -19,9 +22,55 @@ func GetStatsInstance() *StatsSingleton {
 		lock.Lock()
 		defer lock.Unlock()
 		if statsInstance == nil {
-			statsInstance = &StatsSingleton{}
+			statsInstance = &StatsSingleton{
+				Updates: NewBroker[*model.Stats](),
+			}
 		}
 	}
 
 	return statsInstance
 }
+
+// What we show before stats have been computed
+func placeholderStats() *model.Stats {
+	return &model.Stats{
+		ConnectedWorkers:       -1,
+		TotalPaidBanano:        "N/A",
+		RegisteredServiceCount: -1,
+		Top10:                  nil,
+		Services:               nil,
+	}
+}
+
+// GetStats returns the latest stats, or placeholders if they haven't been computed yet
+func (s *StatsSingleton) GetStats() *model.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Stats == nil {
+		return placeholderStats()
+	}
+	return s.Stats
+}
+
+// SetStats replaces the stats and notifies subscribers
+func (s *StatsSingleton) SetStats(stats *model.Stats) {
+	s.mu.Lock()
+	s.Stats = stats
+	s.mu.Unlock()
+	s.Updates.Publish(stats)
+}
+
+// SetConnectedWorkers updates only the number of connected workers and notifies subscribers
+func (s *StatsSingleton) SetConnectedWorkers(connectedWorkers int) {
+	s.mu.Lock()
+	var stats model.Stats
+	if s.Stats != nil {
+		stats = *s.Stats
+	} else {
+		stats = *placeholderStats()
+	}
+	stats.ConnectedWorkers = connectedWorkers
+	s.Stats = &stats
+	s.mu.Unlock()
+	s.Updates.Publish(&stats)
+}
@@ -14,6 +14,7 @@ type UserType string
 const (
 	PROVIDER  UserType = "PROVIDER"
 	REQUESTER UserType = "REQUESTER"
+	ADMIN     UserType = "ADMIN"
 )
 
 func (ct *UserType) Scan(value interface{}) error {
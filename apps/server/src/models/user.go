@@ -24,4 +24,12 @@ type User struct {
 	Payments []Payment `gorm:"foreignKey:PaidTo"`
 	// Banned
 	Banned bool `json:"banned" gorm:"default:false;not null"`
+	// Work requested by this service isn't rewarded
+	RewardsExcluded bool `json:"rewardsExcluded" gorm:"default:false;not null"`
+	// Where we send the results of asynchronous work requests
+	WebhookURL *string `json:"webhookUrl"`
+	// Signs the webhook callbacks, so the service can tell they came from us
+	WebhookSecret *string `json:"-"`
+	// Usage limits for services
+	Quota ServiceQuota `json:"quota" gorm:"embedded;embeddedPrefix:quota_"`
 }
@@ -1,14 +1,25 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+	"github.com/google/uuid"
+)
 
 type WorkResult struct {
 	Base
-	Hash                 string    `json:"hash" gorm:"uniqueIndex;not null"`
-	DifficultyMultiplier int       `json:"difficulty_multiplier"`
-	Result               string    `json:"result" gorm:"not null"`
-	Awarded              bool      `json:"awarded" gorm:"default:false;not null"` // Whether or not this has been awarded
-	ProvidedBy           uuid.UUID `json:"providedBy" gorm:"not null"`
-	RequestedBy          uuid.UUID `json:"requestedBy" gorm:"not null"`
-	Precache             bool      `json:"precache" gorm:"default:false;not null"`
+	Hash string `json:"hash" gorm:"uniqueIndex;not null"`
+	// Whole multiplier at least as hard as Difficulty, rewards are based on this
+	DifficultyMultiplier int                           `json:"difficulty_multiplier"`
+	Difficulty           serializableModels.Difficulty `json:"difficulty" gorm:"type:varchar(16)"`
+	// What the work actually achieved, so we know which later requests it's good for
+	AchievedDifficulty serializableModels.Difficulty `json:"achieved_difficulty" gorm:"type:varchar(16)"`
+	// Network the work was for, empty if the requester didn't say
+	Network string `json:"network" gorm:"type:varchar(32)"`
+	// Rewards for this work are multiplied by this, it's the network's weight when the work was done
+	RewardWeight float64   `json:"reward_weight" gorm:"default:1;not null"`
+	Result       string    `json:"result" gorm:"not null"`
+	Awarded      bool      `json:"awarded" gorm:"default:false;not null"` // Whether or not this has been awarded
+	ProvidedBy   uuid.UUID `json:"providedBy" gorm:"not null"`
+	RequestedBy  uuid.UUID `json:"requestedBy" gorm:"not null"`
+	Precache     bool      `json:"precache" gorm:"default:false;not null"`
 }
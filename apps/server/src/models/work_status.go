@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	serializableModels "github.com/bananocoin/boompow/libs/models"
+)
+
+type WorkStatus string
+
+const (
+	WORK_PENDING   WorkStatus = "PENDING"
+	WORK_COMPLETED WorkStatus = "COMPLETED"
+	WORK_FAILED    WorkStatus = "FAILED"
+)
+
+// State of an asynchronous work request, kept in redis until it expires
+type WorkRequestStatus struct {
+	RequestID            string                        `json:"requestId"`
+	Hash                 string                        `json:"hash"`
+	DifficultyMultiplier int                           `json:"difficultyMultiplier"`
+	Difficulty           serializableModels.Difficulty `json:"difficulty"`
+	Status               WorkStatus                    `json:"status"`
+	Result               string                        `json:"result,omitempty"`
+	Error                string                        `json:"error,omitempty"`
+	CreatedAt            time.Time                     `json:"createdAt"`
+	CompletedAt          *time.Time                    `json:"completedAt,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkerSession is one connection of a worker, from when it connected to when it went away
+// The hub saves the counters as they grow, so sessions still open are up to date within a minute or so
+type WorkerSession struct {
+	// The connection's ID, the hub knows it before the session is saved
+	ID        uuid.UUID `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    uuid.UUID `json:"userId" gorm:"index;not null"`
+	Rig       string    `json:"rig" gorm:"not null"`
+	IPAddress string    `json:"ipAddress"`
+	// From the worker's hello, empty if it didn't say
+	ClientVersion string    `json:"clientVersion"`
+	ConnectedAt   time.Time `json:"connectedAt" gorm:"index;not null"`
+	// Nil while the worker is connected
+	DisconnectedAt *time.Time `json:"disconnectedAt"`
+	// Last time the counters were saved, a session left open by a server that went away ended around then
+	UpdatedAt time.Time `json:"updatedAt" gorm:"index;not null"`
+	// Requests sent to the worker
+	RequestsSent int64 `json:"requestsSent" gorm:"default:0;not null"`
+	// Requests the worker answered first
+	RequestsWon    int64 `json:"requestsWon" gorm:"default:0;not null"`
+	InvalidResults int64 `json:"invalidResults" gorm:"default:0;not null"`
+	// Time it took to solve the requests it won, added up
+	SolveTimeMs int64 `json:"solveTimeMs" gorm:"default:0;not null"`
+	// When it last won a request
+	LastWonAt *time.Time `json:"lastWonAt"`
+}
+
+// Uptime is how long the session lasted, or has lasted so far
+func (s *WorkerSession) Uptime(now time.Time) time.Duration {
+	end := now
+	if s.DisconnectedAt != nil {
+		end = *s.DisconnectedAt
+	}
+	if end.Before(s.ConnectedAt) {
+		return 0
+	}
+	return end.Sub(s.ConnectedAt)
+}
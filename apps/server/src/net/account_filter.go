@@ -0,0 +1,95 @@
+package net
+
+import (
+	"sort"
+	"sync"
+)
+
+// AccountFilter is the set of accounts we want confirmations for
+// Changes are sent to the node in batches with the update action, and the whole set is sent when we (re)subscribe
+type AccountFilter struct {
+	mu sync.Mutex
+	// Accounts we want
+	accounts map[string]int
+	// Accounts the node knows we want
+	sent map[string]bool
+	// Signals the websocket client that the set changed
+	changed chan struct{}
+}
+
+func NewAccountFilter() *AccountFilter {
+	return &AccountFilter{
+		accounts: make(map[string]int),
+		sent:     make(map[string]bool),
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Add an account, an account added more than once stays until it's removed as many times
+func (f *AccountFilter) Add(account string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accounts[account]++
+	f.notify()
+}
+
+func (f *AccountFilter) Remove(account string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accounts[account] <= 1 {
+		delete(f.accounts, account)
+	} else {
+		f.accounts[account]--
+	}
+	f.notify()
+}
+
+func (f *AccountFilter) Contains(account string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.accounts[account]
+	return ok
+}
+
+// Wake up the websocket client without blocking, one pending signal is enough
+func (f *AccountFilter) notify() {
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+// subscribeAccounts returns every account for a new subscription, they're all considered sent after this
+func (f *AccountFilter) subscribeAccounts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = make(map[string]bool, len(f.accounts))
+	accounts := make([]string, 0, len(f.accounts))
+	for account := range f.accounts {
+		f.sent[account] = true
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// pendingUpdate returns the accounts added and removed since we last told the node, they're considered sent after this
+func (f *AccountFilter) pendingUpdate() (add []string, del []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for account := range f.accounts {
+		if !f.sent[account] {
+			add = append(add, account)
+			f.sent[account] = true
+		}
+	}
+	for account := range f.sent {
+		if _, ok := f.accounts[account]; !ok {
+			del = append(del, account)
+			delete(f.sent, account)
+		}
+	}
+	sort.Strings(add)
+	sort.Strings(del)
+	return add, del
+}
@@ -0,0 +1,47 @@
+package net
+
+import (
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestAccountFilterUpdates(t *testing.T) {
+	filter := NewAccountFilter()
+	filter.Add("ban_1")
+	filter.Add("ban_2")
+
+	// A new subscription sends everything
+	utils.AssertEqual(t, []string{"ban_1", "ban_2"}, filter.subscribeAccounts())
+	add, del := filter.pendingUpdate()
+	utils.AssertEqual(t, 0, len(add))
+	utils.AssertEqual(t, 0, len(del))
+
+	filter.Add("ban_3")
+	filter.Remove("ban_1")
+	add, del = filter.pendingUpdate()
+	utils.AssertEqual(t, []string{"ban_3"}, add)
+	utils.AssertEqual(t, []string{"ban_1"}, del)
+
+	// Nothing changed since
+	add, del = filter.pendingUpdate()
+	utils.AssertEqual(t, 0, len(add))
+	utils.AssertEqual(t, 0, len(del))
+}
+
+func TestAccountFilterCountsAdds(t *testing.T) {
+	filter := NewAccountFilter()
+	filter.Add("ban_1")
+	filter.Add("ban_1")
+	filter.Remove("ban_1")
+	utils.AssertEqual(t, true, filter.Contains("ban_1"))
+	filter.Remove("ban_1")
+	utils.AssertEqual(t, false, filter.Contains("ban_1"))
+}
+
+func TestAccountFilterEmptySubscription(t *testing.T) {
+	// The node needs an empty list, not null, to filter everything out
+	accounts := NewAccountFilter().subscribeAccounts()
+	utils.AssertEqual(t, true, accounts != nil)
+	utils.AssertEqual(t, 0, len(accounts))
+}
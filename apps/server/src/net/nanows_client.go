@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -50,25 +51,65 @@ type WSCallbackMsg struct {
 	Amount  string          `json:"amount"`
 }
 
-func StartNanoWSClient(wsUrl string, callbackChan *chan *WSCallbackMsg) {
+// StartNanoWSClient sends confirmations from the node to callbackChan
+// With a filter we only get confirmations for its accounts, without one we get every confirmation
+func StartNanoWSClient(wsUrl string, callbackChan *chan *WSCallbackMsg, filter *AccountFilter) {
 	ctx, cancel := context.WithCancel(context.Background())
-	sentSubscribe := false
 	ws := recws.RecConn{}
+	// Guards writes to the socket and sentSubscribe, which the filter updates also use
+	var writeMu sync.Mutex
+	sentSubscribe := false
 	// Nano subscription request
-	subRequest := wsSubscribe{
-		Action: "subscribe",
-		Topic:  "confirmation",
-		Ack:    false,
-		Id:     guuid.New().String(),
-		// ! TODO - subscribe to only connected acounts
-		// Options: map[string][]string{
-		// 	"accounts": {
-		// 		account,
-		// 	},
-		// },
+	subRequest := func() wsSubscribe {
+		req := wsSubscribe{
+			Action: "subscribe",
+			Topic:  "confirmation",
+			Ack:    false,
+			Id:     guuid.New().String(),
+		}
+		if filter != nil {
+			req.Options = map[string][]string{
+				"accounts": filter.subscribeAccounts(),
+			}
+		}
+		return req
 	}
 	ws.Dial(wsUrl, nil)
 
+	if filter != nil {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-filter.changed:
+				}
+				writeMu.Lock()
+				// A new subscription sends every account anyway
+				if sentSubscribe {
+					add, del := filter.pendingUpdate()
+					if len(add) > 0 || len(del) > 0 {
+						err := ws.WriteJSON(wsSubscribe{
+							Action: "update",
+							Topic:  "confirmation",
+							Ack:    false,
+							Id:     guuid.New().String(),
+							Options: map[string][]string{
+								"accounts_add": add,
+								"accounts_del": del,
+							},
+						})
+						if err != nil {
+							klog.Infof("Error sending subscription update %s", ws.GetURL())
+							sentSubscribe = false
+						}
+					}
+				}
+				writeMu.Unlock()
+			}
+		}()
+	}
+
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc,
 		syscall.SIGHUP,
@@ -91,15 +132,19 @@ func StartNanoWSClient(wsUrl string, callbackChan *chan *WSCallbackMsg) {
 			return
 		default:
 			if !ws.IsConnected() {
+				writeMu.Lock()
 				sentSubscribe = false
+				writeMu.Unlock()
 				klog.Infof("Websocket disconnected %s", ws.GetURL())
 				time.Sleep(2 * time.Second)
 				continue
 			}
 
 			// Sent subscribe with ack
+			writeMu.Lock()
 			if !sentSubscribe {
-				if err := ws.WriteJSON(subRequest); err != nil {
+				if err := ws.WriteJSON(subRequest()); err != nil {
+					writeMu.Unlock()
 					klog.Infof("Error sending subscribe request %s", ws.GetURL())
 					time.Sleep(2 * time.Second)
 					continue
@@ -107,12 +152,15 @@ func StartNanoWSClient(wsUrl string, callbackChan *chan *WSCallbackMsg) {
 					sentSubscribe = true
 				}
 			}
+			writeMu.Unlock()
 
 			var confMessage ConfirmationResponse
 			err := ws.ReadJSON(&confMessage)
 			if err != nil {
 				klog.Infof("Error: ReadJSON %s", ws.GetURL())
+				writeMu.Lock()
 				sentSubscribe = false
+				writeMu.Unlock()
 				continue
 			}
 
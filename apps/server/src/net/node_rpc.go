@@ -0,0 +1,49 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type blockAccountRequest struct {
+	Action string `json:"action"`
+	Hash   string `json:"hash"`
+}
+
+type blockAccountResponse struct {
+	Account string `json:"account"`
+	Error   string `json:"error"`
+}
+
+// BlockAccount asks the node which account a block belongs to
+func BlockAccount(client *http.Client, rpcUrl string, hash string) (string, error) {
+	body, err := json.Marshal(blockAccountRequest{
+		Action: "block_account",
+		Hash:   hash,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Post(rpcUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("node returned %s", resp.Status)
+	}
+	var decoded blockAccountResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", err
+	}
+	if decoded.Error != "" {
+		return "", errors.New(decoded.Error)
+	}
+	if decoded.Account == "" {
+		return "", errors.New("node returned no account")
+	}
+	return decoded.Account, nil
+}
@@ -0,0 +1,31 @@
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestBlockAccount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req blockAccountRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		utils.AssertEqual(t, "block_account", req.Action)
+		if req.Hash == "A" {
+			w.Write([]byte(`{"account": "ban_1"}`))
+		} else {
+			w.Write([]byte(`{"error": "Block not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	account, err := BlockAccount(server.Client(), server.URL, "A")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "ban_1", account)
+
+	_, err = BlockAccount(server.Client(), server.URL, "B")
+	utils.AssertEqual(t, "Block not found", err.Error())
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditEntry is what gets written to the audit log along with a change to a user
+type AuditEntry struct {
+	// Nil for automatic actions
+	ActorID *uuid.UUID
+	Action  models.AuditAction
+	Reason  string
+}
+
+type AuditRepo interface {
+	RecordAction(userID uuid.UUID, actorID *uuid.UUID, action models.AuditAction, reason string) error
+	GetAuditLogs(userID *uuid.UUID, limit int) ([]models.AuditLog, error)
+}
+
+type AuditService struct {
+	Db *gorm.DB
+}
+
+var _ AuditRepo = &AuditService{}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{
+		Db: db,
+	}
+}
+
+// Save an action to the audit trail
+func (s *AuditService) RecordAction(userID uuid.UUID, actorID *uuid.UUID, action models.AuditAction, reason string) error {
+	return recordAction(s.Db, userID, &AuditEntry{ActorID: actorID, Action: action, Reason: reason})
+}
+
+// Pass a transaction to record it along with the change it's about, nothing is written for a nil entry
+func recordAction(tx *gorm.DB, userID uuid.UUID, entry *AuditEntry) error {
+	if entry == nil {
+		return nil
+	}
+	return tx.Create(&models.AuditLog{
+		UserID:  userID,
+		ActorID: entry.ActorID,
+		Action:  entry.Action,
+		Reason:  entry.Reason,
+	}).Error
+}
+
+// Get the most recent audit logs, optionally only for one user
+func (s *AuditService) GetAuditLogs(userID *uuid.UUID, limit int) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	query := s.Db.Order("created_at desc").Limit(limit)
+	if userID != nil {
+		query = query.Where("user_id = ?", userID)
+	}
+	err := query.Find(&logs).Error
+	return logs, err
+}
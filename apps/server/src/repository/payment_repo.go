@@ -4,6 +4,7 @@ import (
 	"github.com/bananocoin/boompow/apps/server/src/models"
 	serializableModels "github.com/bananocoin/boompow/libs/models"
 	"github.com/bananocoin/boompow/libs/utils/number"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -12,6 +13,7 @@ type PaymentRepo interface {
 	GetPendingPayments(tx *gorm.DB) ([]serializableModels.SendRequest, error)
 	SetBlockHash(tx *gorm.DB, sendId string, blockHash string) error
 	GetTotalPaidBanano() (float64, error)
+	GetPaymentsForUser(userID uuid.UUID, limit int, offset int) ([]models.Payment, error)
 }
 
 type PaymentService struct {
@@ -57,6 +59,13 @@ func (s *PaymentService) SetBlockHash(tx *gorm.DB, sendId string, blockHash stri
 	return tx.Model(&models.Payment{}).Where("send_id = ?", sendId).Update("block_hash", blockHash).Error
 }
 
+// Payments sent to a user, newest first
+func (s *PaymentService) GetPaymentsForUser(userID uuid.UUID, limit int, offset int) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := s.Db.Where("paid_to = ?", userID).Order("created_at desc").Limit(limit).Offset(offset).Find(&payments).Error
+	return payments, err
+}
+
 // Get total paid sum
 func (s *PaymentService) GetTotalPaidBanano() (float64, error) {
 	var totalPaid string
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrServiceTokenNameTaken = errors.New("bad_request:a token with this name already exists")
+var ErrServiceTokenTooShort = errors.New("bad_request:token is too short")
+
+// How often we record that a token was used, so every request isn't a write
+const serviceTokenLastUsedResolution = time.Minute
+
+// Characters of the token we keep in the clear, "service:" and a few more
+const serviceTokenPrefixLength = 12
+
+type ServiceTokenRepo interface {
+	CreateServiceToken(userID uuid.UUID, name string, expiresAt *time.Time) (string, *models.ServiceToken, error)
+	ImportServiceToken(userID uuid.UUID, token string) error
+	GetServiceTokens(userID uuid.UUID) ([]models.ServiceToken, error)
+	RotateServiceToken(userID uuid.UUID, id uuid.UUID) (string, *models.ServiceToken, error)
+	RevokeServiceToken(userID uuid.UUID, id uuid.UUID) (*models.ServiceToken, error)
+	AuthenticateServiceToken(token string) (*models.ServiceToken, error)
+}
+
+type ServiceTokenService struct {
+	Db *gorm.DB
+}
+
+var _ ServiceTokenRepo = &ServiceTokenService{}
+
+func NewServiceTokenService(db *gorm.DB) *ServiceTokenService {
+	return &ServiceTokenService{
+		Db: db,
+	}
+}
+
+// Tokens are random, so a plain hash is enough to make a leaked table useless
+func hashServiceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate a service token (for services to request work)
+func GenerateServiceToken() string {
+	return fmt.Sprintf("service:%s", uuid.New().String())
+}
+
+// CreateServiceToken makes a new token for the service, the token is returned only this once
+func (s *ServiceTokenService) CreateServiceToken(userID uuid.UUID, name string, expiresAt *time.Time) (string, *models.ServiceToken, error) {
+	token := GenerateServiceToken()
+	var serviceToken *models.ServiceToken
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		serviceToken, err = saveServiceToken(tx, userID, name, token, expiresAt)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, serviceToken, nil
+}
+
+// RotateServiceToken replaces an active token with a new one with the same name and expiry
+func (s *ServiceTokenService) RotateServiceToken(userID uuid.UUID, id uuid.UUID) (string, *models.ServiceToken, error) {
+	token := GenerateServiceToken()
+	var serviceToken *models.ServiceToken
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		old := &models.ServiceToken{}
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(old).Error; err != nil {
+			return err
+		}
+		if !old.Active(time.Now()) {
+			return errors.New("bad_request:only active tokens can be rotated")
+		}
+		if err := tx.Model(old).Update("revoked_at", time.Now().UTC()).Error; err != nil {
+			return err
+		}
+		var err error
+		serviceToken, err = saveServiceToken(tx, userID, old.Name, token, old.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, serviceToken, nil
+}
+
+// ImportServiceToken saves a token that was handed out before tokens were kept in postgres
+// It's named after its prefix, a service can have had more than one
+func (s *ServiceTokenService) ImportServiceToken(userID uuid.UUID, token string) error {
+	if len(token) < serviceTokenPrefixLength {
+		return ErrServiceTokenTooShort
+	}
+	var existing int64
+	if err := s.Db.Model(&models.ServiceToken{}).Where("token_hash = ?", hashServiceToken(token)).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		_, err := saveServiceToken(tx, userID, fmt.Sprintf("imported-%s", token[:serviceTokenPrefixLength]), token, nil)
+		return err
+	})
+}
+
+// Must be called in a transaction
+func saveServiceToken(tx *gorm.DB, userID uuid.UUID, name string, token string, expiresAt *time.Time) (*models.ServiceToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("bad_request:token name is required")
+	}
+	// Keeping all of a short token in the clear would give it away
+	if len(token) < serviceTokenPrefixLength {
+		return nil, ErrServiceTokenTooShort
+	}
+	serviceToken := &models.ServiceToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashServiceToken(token),
+		Prefix:    token[:serviceTokenPrefixLength],
+		ExpiresAt: expiresAt,
+	}
+	// Names only have to be unique among tokens that still work
+	var taken int64
+	if err := tx.Model(&models.ServiceToken{}).Where("user_id = ? AND name = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, name, time.Now()).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, ErrServiceTokenNameTaken
+	}
+	if err := tx.Create(serviceToken).Error; err != nil {
+		return nil, err
+	}
+	return serviceToken, nil
+}
+
+// GetServiceTokens returns all of the service's tokens, including revoked and expired ones, newest first
+func (s *ServiceTokenService) GetServiceTokens(userID uuid.UUID) ([]models.ServiceToken, error) {
+	var tokens []models.ServiceToken
+	err := s.Db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeServiceToken stops the token from working, it has to belong to the user
+func (s *ServiceTokenService) RevokeServiceToken(userID uuid.UUID, id uuid.UUID) (*models.ServiceToken, error) {
+	serviceToken := &models.ServiceToken{}
+	if err := s.Db.Where("id = ? AND user_id = ?", id, userID).First(serviceToken).Error; err != nil {
+		return nil, err
+	}
+	if serviceToken.RevokedAt != nil {
+		return serviceToken, nil
+	}
+	now := time.Now().UTC()
+	if err := s.Db.Model(serviceToken).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	serviceToken.RevokedAt = &now
+	return serviceToken, nil
+}
+
+// AuthenticateServiceToken finds the active token, and records that it was used
+func (s *ServiceTokenService) AuthenticateServiceToken(token string) (*models.ServiceToken, error) {
+	serviceToken := &models.ServiceToken{}
+	if err := s.Db.Where("token_hash = ?", hashServiceToken(token)).First(serviceToken).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !serviceToken.Active(now) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if serviceToken.LastUsedAt == nil || now.Sub(*serviceToken.LastUsedAt) > serviceTokenLastUsedResolution {
+		if err := s.Db.Model(serviceToken).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+		serviceToken.LastUsedAt = &now
+	}
+	return serviceToken, nil
+}
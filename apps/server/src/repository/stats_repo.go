@@ -2,10 +2,12 @@ package repository
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bananocoin/boompow/apps/server/graph/model"
 	"github.com/bananocoin/boompow/apps/server/src/database"
 	"github.com/bananocoin/boompow/apps/server/src/models"
+	utils "github.com/bananocoin/boompow/libs/utils/format"
 	"k8s.io/klog/v2"
 )
 
@@ -22,12 +24,40 @@ func UpdateStats(paymentRepo PaymentRepo, workRepo WorkRepo) error {
 		klog.Infof("Error retrieving services for stats sub %v", err)
 		return err
 	}
+	// Precache
+	precacheStats, servicePrecacheStats, err := database.GetRedisDB().GetPrecacheStats()
+	if err != nil {
+		klog.Infof("Error retrieving precache stats for stats sub %v", err)
+		return err
+	}
+	// Cache
+	cacheHits, err := database.GetRedisDB().GetCacheHits()
+	if err != nil {
+		klog.Infof("Error retrieving cache hits for stats sub %v", err)
+		return err
+	}
+	totalCacheHits := 0
+	for _, hits := range cacheHits {
+		totalCacheHits += hits
+	}
+	coalesced, err := database.GetRedisDB().GetCoalescedRequests()
+	if err != nil {
+		klog.Infof("Error retrieving coalesced requests for stats sub %v", err)
+		return err
+	}
+	totalCoalesced := 0
+	for _, count := range coalesced {
+		totalCoalesced += count
+	}
 	var serviceStats []*model.StatsServiceType
 	for _, service := range services {
 		serviceStats = append(serviceStats, &model.StatsServiceType{
-			Name:     service.ServiceName,
-			Website:  service.ServiceWebsite,
-			Requests: service.TotalRequests,
+			Name:      service.ServiceName,
+			Website:   service.ServiceWebsite,
+			Requests:  service.TotalRequests,
+			CacheHits: cacheHits[service.RequesterEmail],
+			Coalesced: coalesced[service.RequesterEmail],
+			Precache:  servicePrecacheStats[service.RequesterEmail],
 		})
 	}
 	// Top 10
@@ -45,6 +75,37 @@ func UpdateStats(paymentRepo PaymentRepo, workRepo WorkRepo) error {
 	}
 	// Total paid
 	totalPaidBan, err := paymentRepo.GetTotalPaidBanano()
-	models.GetStatsInstance().Stats = &model.Stats{ConnectedWorkers: int(nConnectedClients), TotalPaidBanano: fmt.Sprintf("%.2f", totalPaidBan), RegisteredServiceCount: len(services), Top10: top10Contributors, Services: serviceStats}
+	if err != nil {
+		klog.Infof("Error retrieving total paid for stats sub %v", err)
+		return err
+	}
+	lastUpdatedAt := utils.GenerateISOString(time.Now())
+	stats := &model.Stats{ConnectedWorkers: int(nConnectedClients), TotalPaidBanano: fmt.Sprintf("%.2f", totalPaidBan), RegisteredServiceCount: len(services), Top10: top10Contributors, Services: serviceStats, LastUpdatedAt: &lastUpdatedAt, CacheHits: totalCacheHits, Coalesced: totalCoalesced, Precache: precacheStats}
+	// Share with the other replicas
+	if err := database.GetRedisDB().SetStats(stats); err != nil {
+		klog.Infof("Error storing stats %v", err)
+		return err
+	}
+	models.GetStatsInstance().SetStats(stats)
+	return nil
+}
+
+// LoadStats picks up stats computed by another replica
+func LoadStats() error {
+	stats, err := database.GetRedisDB().GetStats()
+	if err != nil {
+		return err
+	}
+	current := models.GetStatsInstance().GetStats()
+	if current.LastUpdatedAt != nil && stats.LastUpdatedAt != nil && *current.LastUpdatedAt == *stats.LastUpdatedAt {
+		// Nothing new
+		return nil
+	}
+	// Connected workers change more often than the stats are computed
+	nConnectedClients, err := database.GetRedisDB().GetNumberConnectedClients()
+	if err == nil {
+		stats.ConnectedWorkers = int(nConnectedClients)
+	}
+	models.GetStatsInstance().SetStats(stats)
 	return nil
 }
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -27,14 +29,32 @@ type UserRepo interface {
 	DeleteUser(id uuid.UUID) error
 	GetUser(id *uuid.UUID, email *string) (*models.User, error)
 	GetAllUsers() ([]*models.User, error)
+	SearchUsers(filter UserFilter) ([]models.User, error)
 	Authenticate(loginInput *model.LoginInput) *models.User
 	VerifyEmailToken(verifyEmail *model.VerifyEmailInput) (bool, error)
 	VerifyService(verifyService *model.VerifyServiceInput) (bool, error)
 	GenerateResetPasswordRequest(resetPasswordInput *model.ResetPasswordInput, doEmail bool) (string, error)
-	GenerateServiceToken() string
 	CreateService(email string, serviceName string, serviceWebsite string) (string, error)
 	GetNumberServices() (int64, error)
 	ChangePassword(email string, userInput *model.ChangePasswordInput) error
+	IncrementInvalidResultCount(email string) (*models.User, error)
+	SetBanned(id uuid.UUID, banned bool, audit *AuditEntry) error
+	Unban(id uuid.UUID, audit *AuditEntry) error
+	SetWebhookURL(id uuid.UUID, webhookURL *string) error
+	RotateWebhookSecret(id uuid.UUID) (string, error)
+	SetQuota(id uuid.UUID, quota models.ServiceQuota, audit *AuditEntry) error
+	SetCanRequestWork(id uuid.UUID, canRequestWork bool, audit *AuditEntry) error
+	SetRewardsExcluded(id uuid.UUID, excluded bool, audit *AuditEntry) error
+	SetType(id uuid.UUID, userType models.UserType, audit *AuditEntry) error
+}
+
+// UserFilter narrows down a user search, empty fields match everybody
+type UserFilter struct {
+	// Part of the email, service name or ban address, case insensitive
+	Search string
+	Type   models.UserType
+	Limit  int
+	Offset int
 }
 
 type UserService struct {
@@ -134,10 +154,8 @@ func (s *UserService) CreateService(email string, serviceName string, serviceWeb
 	}
 
 	// Create token
-	// Generate token
-	token := s.GenerateServiceToken()
-
-	if err := database.GetRedisDB().AddServiceToken(user.ID, token); err != nil {
+	token, _, err := NewServiceTokenService(s.Db).CreateServiceToken(user.ID, "default", nil)
+	if err != nil {
 		return "", fmt.Errorf("error generating token")
 	}
 
@@ -359,6 +377,21 @@ func (s *UserService) GetAllUsers() ([]*models.User, error) {
 	return users, err
 }
 
+// Find users matching the filter, newest first
+func (s *UserService) SearchUsers(filter UserFilter) ([]models.User, error) {
+	users := []models.User{}
+	query := s.Db.Order("created_at desc").Limit(filter.Limit).Offset(filter.Offset)
+	if filter.Search != "" {
+		pattern := "%" + strings.ToLower(filter.Search) + "%"
+		query = query.Where("lower(email) LIKE ? OR lower(service_name) LIKE ? OR lower(ban_address) LIKE ?", pattern, pattern, pattern)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	err := query.Find(&users).Error
+	return users, err
+}
+
 func (s *UserService) GetNumberServices() (int64, error) {
 	var count int64
 	if err := s.Db.Model(&models.User{}).Where("type = ?", models.REQUESTER).Count(&count).Error; err != nil {
@@ -367,6 +400,98 @@ func (s *UserService) GetNumberServices() (int64, error) {
 	return count, nil
 }
 
+// Add one to the invalid result count of this user, returns the updated user
+func (s *UserService) IncrementInvalidResultCount(email string) (*models.User, error) {
+	if err := s.Db.Model(&models.User{}).Where("email = ?", email).UpdateColumn("invalid_result_count", gorm.Expr("invalid_result_count + ?", 1)).Error; err != nil {
+		return nil, err
+	}
+	return s.GetUser(nil, &email)
+}
+
+// Update a user and write the audit log for it in one transaction, so neither happens without the other
+func (s *UserService) updateAudited(id uuid.UUID, audit *AuditEntry, update func(user *gorm.DB) error) error {
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := update(tx.Model(&models.User{}).Where("id = ?", id)); err != nil {
+			return err
+		}
+		return recordAction(tx, id, audit)
+	})
+}
+
+func (s *UserService) SetBanned(id uuid.UUID, banned bool, audit *AuditEntry) error {
+	return s.updateAudited(id, audit, func(user *gorm.DB) error {
+		return user.Update("banned", banned).Error
+	})
+}
+
+// Lift a ban and forget the invalid results, or the penalties would lock the account out again
+func (s *UserService) Unban(id uuid.UUID, audit *AuditEntry) error {
+	return s.updateAudited(id, audit, func(user *gorm.DB) error {
+		return user.Updates(map[string]interface{}{"banned": false, "invalid_result_count": 0}).Error
+	})
+}
+
+// Approve a service to request work, or take it away
+func (s *UserService) SetCanRequestWork(id uuid.UUID, canRequestWork bool, audit *AuditEntry) error {
+	return s.updateAudited(id, audit, func(user *gorm.DB) error {
+		return user.Update("can_request_work", canRequestWork).Error
+	})
+}
+
+// Stop rewarding the work a service requests, or start again
+func (s *UserService) SetRewardsExcluded(id uuid.UUID, excluded bool, audit *AuditEntry) error {
+	return s.updateAudited(id, audit, func(user *gorm.DB) error {
+		return user.Update("rewards_excluded", excluded).Error
+	})
+}
+
+func (s *UserService) SetType(id uuid.UUID, userType models.UserType, audit *AuditEntry) error {
+	return s.updateAudited(id, audit, func(user *gorm.DB) error {
+		return user.Update("type", userType).Error
+	})
+}
+
+// Generate the secret a service's webhook callbacks are signed with
+func GenerateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := cryptorand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Set where results of asynchronous work requests are sent, nil to disable
+// The service gets a signing secret the first time, changing the URL keeps it
+func (s *UserService) SetWebhookURL(id uuid.UUID, webhookURL *string) error {
+	secret, err := GenerateWebhookSecret()
+	if err != nil {
+		return err
+	}
+	return s.Db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"webhook_url":    webhookURL,
+		"webhook_secret": gorm.Expr("coalesce(webhook_secret, ?)", secret),
+	}).Error
+}
+
+// Replace the service's webhook signing secret, callbacks are signed with the new one right away
+func (s *UserService) RotateWebhookSecret(id uuid.UUID) (string, error) {
+	secret, err := GenerateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := s.Db.Model(&models.User{}).Where("id = ?", id).Update("webhook_secret", secret).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Replace the service's quota, zero values are written too so limits can be lifted
+func (s *UserService) SetQuota(id uuid.UUID, quota models.ServiceQuota, audit *AuditEntry) error {
+	return s.updateAudited(id, audit, func(user *gorm.DB) error {
+		return user.Select("quota_requests_per_minute", "quota_requests_per_day", "quota_max_in_flight", "quota_max_difficulty").Updates(&models.User{Quota: quota}).Error
+	})
+}
+
 // Compare password to hashed password, return true if match false otherwise
 func (s *UserService) Authenticate(loginInput *model.LoginInput) *models.User {
 	user := &models.User{}
@@ -382,8 +507,3 @@ func (s *UserService) Authenticate(loginInput *model.LoginInput) *models.User {
 	}
 	return nil
 }
-
-// Generate a service token (for services to request work)
-func (s *UserService) GenerateServiceToken() string {
-	return fmt.Sprintf("service:%s", uuid.New().String())
-}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/bananocoin/boompow/apps/server/src/config"
 	"github.com/bananocoin/boompow/apps/server/src/database"
 	"github.com/bananocoin/boompow/apps/server/src/models"
 	serializableModels "github.com/bananocoin/boompow/libs/models"
@@ -19,13 +20,17 @@ import (
 )
 
 type WorkMessage struct {
-	BlockAward           bool   `json:"block_award"`
-	RequestedByEmail     string `json:"requestedByEmail"`
-	ProvidedByEmail      string `json:"providedByEmail"`
-	Hash                 string `json:"hash"`
-	Result               string `json:"result"`
-	DifficultyMultiplier int    `json:"difficulty_multiplier"`
-	Precache             bool   `json:"precache"`
+	BlockAward       bool   `json:"block_award"`
+	RequestedByEmail string `json:"requestedByEmail"`
+	ProvidedByEmail  string `json:"providedByEmail"`
+	// Rig of the provider that computed the work, see controller.WorkerID
+	ProvidedByWorker     string                        `json:"providedByWorker"`
+	Hash                 string                        `json:"hash"`
+	Result               string                        `json:"result"`
+	DifficultyMultiplier int                           `json:"difficulty_multiplier"`
+	Difficulty           serializableModels.Difficulty `json:"difficulty"`
+	Network              string                        `json:"network"`
+	Precache             bool                          `json:"precache"`
 }
 
 type WorkRepo interface {
@@ -34,11 +39,12 @@ type WorkRepo interface {
 	StatsWorker(statsChan <-chan WorkMessage, blockAwardedChan *chan serializableModels.ClientMessage)
 	GetUnpaidWorkSumForUser(email string) (int, error)
 	GetUnpaidWorkSum() (int, error)
-	RetrieveWorkFromCache(hash string, difficultyMultiplier int) (string, error)
+	RetrieveWorkFromCache(hash string, difficulty uint64) (string, error)
 	GetUnpaidWorkCount(tx *gorm.DB) ([]UnpaidWorkResult, error)
 	GetUnpaidWorkCountAndMarkAllPaid(tx *gorm.DB) ([]UnpaidWorkResult, error)
 	GetTopContributors(limit int) ([]Top10Result, error)
 	GetServiceStats() ([]ServicesResult, error)
+	GetWorkHistory(userID uuid.UUID, limit int, offset int) ([]models.WorkResult, error)
 }
 
 type WorkService struct {
@@ -67,6 +73,22 @@ func (s *WorkService) SaveOrUpdateWorkResult(workMessage WorkMessage) (*models.W
 		return nil, err
 	}
 
+	// Workers' results were validated already, this only fails for malformed ones we'd rather not cache
+	achieved, err := validation.WorkValue(workMessage.Hash, workMessage.Result)
+	if err != nil {
+		klog.Errorf("Error computing difficulty of work for %s: %v", workMessage.Hash, err)
+	}
+	cachedWork := &models.CachedWork{
+		Result:     workMessage.Result,
+		Difficulty: serializableModels.Difficulty(achieved),
+	}
+
+	// Work for an unknown network is rewarded as is
+	rewardWeight := 1.0
+	if network := config.GetNetwork(workMessage.Network); network != nil {
+		rewardWeight = network.RewardWeight
+	}
+
 	// See if exists
 	var workResult models.WorkResult
 	var workRequestDb *models.WorkResult
@@ -78,6 +100,10 @@ func (s *WorkService) SaveOrUpdateWorkResult(workMessage WorkMessage) (*models.W
 			Awarded:              !workMessage.BlockAward,
 			Hash:                 workMessage.Hash,
 			DifficultyMultiplier: workMessage.DifficultyMultiplier,
+			Difficulty:           workMessage.Difficulty,
+			AchievedDifficulty:   cachedWork.Difficulty,
+			Network:              workMessage.Network,
+			RewardWeight:         rewardWeight,
 			Result:               workMessage.Result,
 			ProvidedBy:           provider.ID,
 			RequestedBy:          requester.ID,
@@ -91,22 +117,27 @@ func (s *WorkService) SaveOrUpdateWorkResult(workMessage WorkMessage) (*models.W
 		}
 
 		// Cache in redis temporarily for faster lookup
-		database.GetRedisDB().CacheWork(workMessage.Hash, workMessage.Result)
+		if cachedWork.Difficulty != 0 {
+			database.GetRedisDB().CacheWork(workMessage.Hash, cachedWork)
+		}
 	} else if err == nil {
 		// Update record
-		err = s.Db.Model(&workResult).Updates(map[string]interface{}{"difficulty_multiplier": workMessage.DifficultyMultiplier, "result": workMessage.Result, "provided_by": provider.ID, "requested_by": requester.ID, "awarded": false}).Error
+		err = s.Db.Model(&workResult).Updates(map[string]interface{}{"difficulty_multiplier": workMessage.DifficultyMultiplier, "difficulty": workMessage.Difficulty, "achieved_difficulty": cachedWork.Difficulty, "network": workMessage.Network, "reward_weight": rewardWeight, "result": workMessage.Result, "provided_by": provider.ID, "requested_by": requester.ID, "awarded": false}).Error
 		if err != nil {
 			return nil, err
 		}
+		// Replace whatever we cached before
+		if cachedWork.Difficulty != 0 {
+			database.GetRedisDB().CacheWork(workMessage.Hash, cachedWork)
+		} else {
+			database.GetRedisDB().UncacheWork(workMessage.Hash)
+		}
 	} else {
 		return nil, err
 	}
 
 	// Update timestamps
-	// err = s.Db.Model(&models.User{}).Where("id = ?", provider.ID).Updates(map[string]interface{}{"last_provided_work_at": time.Now()}).Error
-	// if err != nil {
-	// 	klog.Errorf("Failed to update last_provided_work_at for provider %v", err)
-	// }
+	// last_provided_work_at is kept up to date with the worker sessions, see WorkerSessionService.SaveSession
 	// err = s.Db.Model(&models.User{}).Where("id = ?", requester.ID).Updates(map[string]interface{}{"last_requested_work_at": time.Now()}).Error
 	// if err != nil {
 	// 	klog.Errorf("Failed to update last_requested_work_at for provider %v", err)
@@ -124,10 +155,19 @@ func (s *WorkService) GetWorkRecord(hash string) (*models.WorkResult, error) {
 	return &workRequest, nil
 }
 
+// Work a user provided or requested, newest first
+func (s *WorkService) GetWorkHistory(userID uuid.UUID, limit int, offset int) ([]models.WorkResult, error) {
+	var results []models.WorkResult
+	err := s.Db.Where("provided_by = ? OR requested_by = ?", userID, userID).Order("created_at desc").Limit(limit).Offset(offset).Find(&results).Error
+	return results, err
+}
+
 type ServicesResult struct {
 	TotalRequests  int    `json:"total_requests"`
 	ServiceName    string `json:"service_name"`
 	ServiceWebsite string `json:"service_website"`
+	// Not shown in stats, for matching up the service's other stats
+	RequesterEmail string `json:"requester_email"`
 }
 
 func (s *WorkService) GetServiceStats() ([]ServicesResult, error) {
@@ -142,7 +182,12 @@ func (s *WorkService) GetServiceStats() ([]ServicesResult, error) {
 	}
 
 	services := []ServicesResult{}
-	err = s.Db.Model(&models.WorkResult{}).Select("COUNT(*) as total_requests, service_name, service_website").Joins("JOIN users on users.id = work_results.requested_by").Where("users.email != ?", "all@banano.cc").Where("users.email != ?", "nano@banano.cc").Group("requested_by").Group("service_name").Group("service_website").Order("total_requests desc").Find(&services).Error
+	query := s.Db.Model(&models.WorkResult{}).Select("COUNT(*) as total_requests, service_name, service_website, users.email as requester_email").Joins("JOIN users on users.id = work_results.requested_by")
+	// Precached work isn't a service's
+	if requesters := config.PrecacheRequesters(); len(requesters) > 0 {
+		query = query.Where("users.email NOT IN ?", requesters)
+	}
+	err = query.Group("requested_by").Group("service_name").Group("service_website").Group("users.email").Order("total_requests desc").Find(&services).Error
 
 	if err == nil {
 		b, err := json.Marshal(services)
@@ -154,7 +199,7 @@ func (s *WorkService) GetServiceStats() ([]ServicesResult, error) {
 	return services, err
 }
 
-// Get sum of (difficulty_multiplier * 100), use this to determine payments
+// Get sum of (difficulty_multiplier * reward_weight * 100), use this to determine payments
 
 type UnpaidSumResult struct {
 	DifficultySum int `json:"difficulty_sum"`
@@ -167,7 +212,7 @@ func (s *WorkService) GetUnpaidWorkSumForUser(email string) (int, error) {
 		return 0, err
 	}
 	var result UnpaidSumResult
-	err = s.Db.Model(&models.WorkResult{}).Select("sum(difficulty_multiplier*100) as difficulty_sum").Where("awarded = ?", false).Where("provided_by = ?", user.ID).Scan(&result).Error
+	err = s.Db.Model(&models.WorkResult{}).Select("cast(sum(difficulty_multiplier*reward_weight*100) as bigint) as difficulty_sum").Where("awarded = ?", false).Where("provided_by = ?", user.ID).Scan(&result).Error
 	if err != nil {
 		return 0, err
 	}
@@ -178,7 +223,7 @@ func (s *WorkService) GetUnpaidWorkSumForUser(email string) (int, error) {
 // Summate the difficulty of unpaid works for all users
 func (s *WorkService) GetUnpaidWorkSum() (int, error) {
 	var result UnpaidSumResult
-	err := s.Db.Model(&models.WorkResult{}).Select("sum(difficulty_multiplier*100) as difficulty_sum").Where("awarded = ?", false).Scan(&result).Error
+	err := s.Db.Model(&models.WorkResult{}).Select("cast(sum(difficulty_multiplier*reward_weight*100) as bigint) as difficulty_sum").Where("awarded = ?", false).Scan(&result).Error
 	if err != nil {
 		return 0, err
 	}
@@ -196,7 +241,7 @@ type UnpaidWorkResult struct {
 func (s *WorkService) GetUnpaidWorkCount(tx *gorm.DB) ([]UnpaidWorkResult, error) {
 	var result []UnpaidWorkResult
 	// x 100 for more precision
-	err := tx.Model(&models.WorkResult{}).Select("COUNT(*) as unpaid_count, provided_by, ban_address, sum(difficulty_multiplier*100) as difficulty_sum").Joins("JOIN users on users.id = work_results.provided_by").Group("provided_by").Group("ban_address").Where("awarded = ?", false).Find(&result).Error
+	err := tx.Model(&models.WorkResult{}).Select("COUNT(*) as unpaid_count, provided_by, ban_address, cast(sum(difficulty_multiplier*reward_weight*100) as bigint) as difficulty_sum").Joins("JOIN users on users.id = work_results.provided_by").Group("provided_by").Group("ban_address").Where("awarded = ?", false).Find(&result).Error
 	return result, err
 }
 
@@ -250,11 +295,17 @@ func (s *WorkService) GetUnpaidWorkCountAndMarkAllPaid(tx *gorm.DB) ([]UnpaidWor
 	return result, err
 }
 
-func (s *WorkService) RetrieveWorkFromCache(hash string, difficultyMultiplier int) (string, error) {
+// RetrieveWorkFromCache returns work we already have for the hash, if it meets the difficulty
+// Looks in redis and then postgres, returns gorm.ErrRecordNotFound if we don't have good enough work
+func (s *WorkService) RetrieveWorkFromCache(hash string, difficulty uint64) (string, error) {
 	// Check cache first
-	work, err := database.GetRedisDB().GetCachedWork(hash)
+	cached, err := database.GetRedisDB().GetCachedWork(hash)
 	if err == nil {
-		return work, nil
+		if uint64(cached.Difficulty) >= difficulty {
+			return cached.Result, nil
+		}
+		// Postgres has the same work
+		return "", gorm.ErrRecordNotFound
 	}
 
 	var workRequest models.WorkResult
@@ -263,11 +314,24 @@ func (s *WorkService) RetrieveWorkFromCache(hash string, difficultyMultiplier in
 		return "", err
 	}
 
-	// Validate difficulty is valid
-	if !validation.IsWorkValid(hash, difficultyMultiplier, workRequest.Result) {
+	cached = &models.CachedWork{
+		Result:     workRequest.Result,
+		Difficulty: workRequest.AchievedDifficulty,
+	}
+	// Saved before we kept track of it
+	if cached.Difficulty == 0 {
+		achieved, err := validation.WorkValue(hash, workRequest.Result)
+		if err != nil {
+			return "", gorm.ErrRecordNotFound
+		}
+		cached.Difficulty = serializableModels.Difficulty(achieved)
+	}
+	database.GetRedisDB().CacheWork(hash, cached)
+
+	if uint64(cached.Difficulty) < difficulty {
 		return "", gorm.ErrRecordNotFound
 	}
-	return workRequest.Result, nil
+	return cached.Result, nil
 }
 
 func (s *WorkService) StatsWorker(statsChan <-chan WorkMessage, blockAwardedChan *chan serializableModels.ClientMessage) {
@@ -303,6 +367,7 @@ func (s *WorkService) StatsWorker(statsChan <-chan WorkMessage, blockAwardedChan
 			PercentOfPool:        percentageOfPool,
 			EstimatedAward:       estimatedAward,
 			ProviderEmail:        c.ProvidedByEmail,
+			ProviderWorker:       c.ProvidedByWorker,
 			DifficultyMultiplier: c.DifficultyMultiplier,
 		}
 
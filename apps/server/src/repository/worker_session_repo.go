@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"k8s.io/klog/v2"
+)
+
+// Orders for the worker report, worst first
+const (
+	WorkerReportByInvalidResults = "invalid_results"
+	WorkerReportByWinRate        = "win_rate"
+	WorkerReportByRequestsWon    = "requests_won"
+	WorkerReportByUptime         = "uptime"
+)
+
+type WorkerSessionRepo interface {
+	SaveSession(session *models.WorkerSession) error
+	CloseStaleSessions(before time.Time) (int64, error)
+	GetSessions(userID uuid.UUID, limit int, offset int) ([]models.WorkerSession, error)
+	GetSessionSummary(userID uuid.UUID, since time.Time) (*WorkerSessionSummary, error)
+	GetWorkerReport(since time.Time, orderBy string, limit int) ([]WorkerSessionSummary, error)
+	SessionWorker(sessions <-chan *models.WorkerSession)
+}
+
+type WorkerSessionService struct {
+	Db *gorm.DB
+}
+
+var _ WorkerSessionRepo = &WorkerSessionService{}
+
+func NewWorkerSessionService(db *gorm.DB) *WorkerSessionService {
+	return &WorkerSessionService{
+		Db: db,
+	}
+}
+
+// WorkerSessionSummary adds up the sessions of one account that were open at some point since a time
+type WorkerSessionSummary struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Email    string    `json:"email"`
+	Sessions int64     `json:"sessions"`
+	// Only counts the part of each session after the time
+	UptimeSeconds  int64 `json:"uptime_seconds"`
+	RequestsSent   int64 `json:"requests_sent"`
+	RequestsWon    int64 `json:"requests_won"`
+	InvalidResults int64 `json:"invalid_results"`
+	SolveTimeMs    int64 `json:"solve_time_ms"`
+}
+
+// Save a snapshot of a session's counters, creating it the first time
+// Sessions that were closed stay closed, a late snapshot doesn't reopen them
+func (s *WorkerSessionService) SaveSession(session *models.WorkerSession) error {
+	err := s.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"client_version", "disconnected_at", "updated_at", "requests_sent", "requests_won", "invalid_results", "solve_time_ms", "last_won_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "worker_sessions.disconnected_at IS NULL"}}},
+	}).Create(session).Error
+	if err != nil || session.LastWonAt == nil {
+		return err
+	}
+	// Snapshots can be saved out of order across servers, never move it back
+	return s.Db.Model(&models.User{}).Where("id = ? AND (last_provided_work_at IS NULL OR last_provided_work_at < ?)", session.UserID, session.LastWonAt).UpdateColumn("last_provided_work_at", session.LastWonAt).Error
+}
+
+// Close sessions that haven't been saved since before, their server went away without closing them
+// They're taken to have ended when they were last saved
+func (s *WorkerSessionService) CloseStaleSessions(before time.Time) (int64, error) {
+	// UpdateColumn so updated_at isn't touched, postgres reads the old value in the SET
+	result := s.Db.Model(&models.WorkerSession{}).Where("disconnected_at IS NULL AND updated_at < ?", before).UpdateColumn("disconnected_at", gorm.Expr("updated_at"))
+	return result.RowsAffected, result.Error
+}
+
+// Get a user's sessions, newest first
+func (s *WorkerSessionService) GetSessions(userID uuid.UUID, limit int, offset int) ([]models.WorkerSession, error) {
+	var sessions []models.WorkerSession
+	err := s.Db.Where("user_id = ?", userID).Order("connected_at desc").Limit(limit).Offset(offset).Find(&sessions).Error
+	return sessions, err
+}
+
+// Query adding up sessions per account that were open at some point since a time
+func (s *WorkerSessionService) summaryQuery(since time.Time) *gorm.DB {
+	return s.Db.Table("worker_sessions").
+		Select(`worker_sessions.user_id, users.email, count(*) as sessions,
+			cast(coalesce(sum(extract(epoch from coalesce(worker_sessions.disconnected_at, now()) - greatest(worker_sessions.connected_at, ?))), 0) as bigint) as uptime_seconds,
+			coalesce(sum(worker_sessions.requests_sent), 0) as requests_sent,
+			coalesce(sum(worker_sessions.requests_won), 0) as requests_won,
+			coalesce(sum(worker_sessions.invalid_results), 0) as invalid_results,
+			coalesce(sum(worker_sessions.solve_time_ms), 0) as solve_time_ms`, since).
+		Joins("JOIN users ON users.id = worker_sessions.user_id").
+		Where("coalesce(worker_sessions.disconnected_at, now()) >= ?", since).
+		Group("worker_sessions.user_id, users.email")
+}
+
+// Add up a user's sessions since a time, all zeros if there weren't any
+func (s *WorkerSessionService) GetSessionSummary(userID uuid.UUID, since time.Time) (*WorkerSessionSummary, error) {
+	var summaries []WorkerSessionSummary
+	err := s.summaryQuery(since).Where("worker_sessions.user_id = ?", userID).Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(summaries) == 0 {
+		return &WorkerSessionSummary{UserID: userID}, nil
+	}
+	return &summaries[0], nil
+}
+
+// Add up every account's sessions since a time, worst first by the order
+func (s *WorkerSessionService) GetWorkerReport(since time.Time, orderBy string, limit int) ([]WorkerSessionSummary, error) {
+	var order string
+	switch orderBy {
+	case WorkerReportByInvalidResults:
+		order = "invalid_results desc, requests_sent desc"
+	// Lowest win rate first, accounts that were sent nothing last
+	case WorkerReportByWinRate:
+		order = "cast(sum(worker_sessions.requests_won) as float) / nullif(sum(worker_sessions.requests_sent), 0) asc nulls last, requests_sent desc"
+	case WorkerReportByRequestsWon:
+		order = "requests_won desc"
+	case WorkerReportByUptime:
+		order = "uptime_seconds desc"
+	default:
+		return nil, fmt.Errorf("unknown worker report order %s", orderBy)
+	}
+	var summaries []WorkerSessionSummary
+	err := s.summaryQuery(since).Order(order).Limit(limit).Scan(&summaries).Error
+	return summaries, err
+}
+
+// Save session snapshots from the hub as they come, in order, so a session's last snapshot wins
+func (s *WorkerSessionService) SessionWorker(sessions <-chan *models.WorkerSession) {
+	for session := range sessions {
+		if err := s.SaveSession(session); err != nil {
+			klog.Errorf("Error saving worker session %s: %v", session.ID, err)
+		}
+	}
+}
@@ -76,6 +76,14 @@ func TestPaymentrepo(t *testing.T) {
 		utils.AssertEqual(t, true, payments[p].ID == "0" || payments[p].ID == "2")
 	}
 
+	// Payments for one user
+	userPayments, err := paymentRepo.GetPaymentsForUser(provider.ID, 2, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, len(userPayments))
+	userPayments, err = paymentRepo.GetPaymentsForUser(provider.ID, 10, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 3, len(userPayments))
+
 	// Check out total paid
 	totalPaid, err := paymentRepo.GetTotalPaidBanano()
 	utils.AssertEqual(t, nil, err)
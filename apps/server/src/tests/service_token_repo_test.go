@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+	"github.com/google/uuid"
+)
+
+// Test service token repo
+func TestServiceTokenRepo(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	mockDb, err := database.NewConnection(&database.Config{
+		Host:     os.Getenv("DB_MOCK_HOST"),
+		Port:     os.Getenv("DB_MOCK_PORT"),
+		Password: os.Getenv("DB_MOCK_PASS"),
+		User:     os.Getenv("DB_MOCK_USER"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+		DBName:   "testing",
+	})
+	utils.AssertEqual(t, nil, err)
+	err = database.DropAndCreateTables(mockDb)
+	utils.AssertEqual(t, nil, err)
+	tokenRepo := repository.NewServiceTokenService(mockDb)
+	userID := uuid.New()
+
+	// Create and authenticate
+	token, serviceToken, err := tokenRepo.CreateServiceToken(userID, "prod", nil)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, token[:12], serviceToken.Prefix)
+	utils.AssertEqual(t, true, serviceToken.TokenHash != token)
+	authenticated, err := tokenRepo.AuthenticateServiceToken(token)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, userID, authenticated.UserID)
+	utils.AssertEqual(t, true, authenticated.LastUsedAt != nil)
+	_, err = tokenRepo.AuthenticateServiceToken("service:nonexistent")
+	utils.AssertEqual(t, true, err != nil)
+
+	// Names are unique among active tokens
+	_, _, err = tokenRepo.CreateServiceToken(userID, "prod", nil)
+	utils.AssertEqual(t, repository.ErrServiceTokenNameTaken, err)
+
+	// Expired tokens don't work
+	expired := time.Now().Add(-time.Minute)
+	expiredToken, _, err := tokenRepo.CreateServiceToken(userID, "old", &expired)
+	utils.AssertEqual(t, nil, err)
+	_, err = tokenRepo.AuthenticateServiceToken(expiredToken)
+	utils.AssertEqual(t, true, err != nil)
+
+	// Rotating revokes the old token and keeps the name
+	rotated, rotatedToken, err := tokenRepo.RotateServiceToken(userID, serviceToken.ID)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "prod", rotatedToken.Name)
+	_, err = tokenRepo.AuthenticateServiceToken(token)
+	utils.AssertEqual(t, true, err != nil)
+	_, err = tokenRepo.AuthenticateServiceToken(rotated)
+	utils.AssertEqual(t, nil, err)
+
+	// Only the owner can revoke
+	_, err = tokenRepo.RevokeServiceToken(uuid.New(), rotatedToken.ID)
+	utils.AssertEqual(t, true, err != nil)
+	revoked, err := tokenRepo.RevokeServiceToken(userID, rotatedToken.ID)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, revoked.RevokedAt != nil)
+	_, err = tokenRepo.AuthenticateServiceToken(rotated)
+	utils.AssertEqual(t, true, err != nil)
+
+	tokens, err := tokenRepo.GetServiceTokens(userID)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 3, len(tokens))
+
+	// Importing the same token twice only saves it once
+	err = tokenRepo.ImportServiceToken(userID, "service:legacy-token")
+	utils.AssertEqual(t, nil, err)
+	err = tokenRepo.ImportServiceToken(userID, "service:legacy-token")
+	utils.AssertEqual(t, nil, err)
+	tokens, err = tokenRepo.GetServiceTokens(userID)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 4, len(tokens))
+	// Each import gets its own name
+	err = tokenRepo.ImportServiceToken(userID, "service:other-token")
+	utils.AssertEqual(t, nil, err)
+	tokens, err = tokenRepo.GetServiceTokens(userID)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 5, len(tokens))
+	// Too short to keep a prefix of
+	err = tokenRepo.ImportServiceToken(userID, "service:")
+	utils.AssertEqual(t, repository.ErrServiceTokenTooShort, err)
+}
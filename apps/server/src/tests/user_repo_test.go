@@ -9,6 +9,7 @@ import (
 	"github.com/bananocoin/boompow/apps/server/src/database"
 	"github.com/bananocoin/boompow/apps/server/src/models"
 	"github.com/bananocoin/boompow/apps/server/src/repository"
+	serializableModels "github.com/bananocoin/boompow/libs/models"
 	utils "github.com/bananocoin/boompow/libs/utils/testing"
 )
 
@@ -71,6 +72,36 @@ func TestUserRepo(t *testing.T) {
 	})
 	utils.AssertEqual(t, true, authenticated == nil)
 
+	// Test invalid results and banning
+	dbUser, err = userRepo.IncrementInvalidResultCount("joe@gmail.com")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, dbUser.InvalidResultCount)
+	dbUser, err = userRepo.IncrementInvalidResultCount("joe@gmail.com")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, dbUser.InvalidResultCount)
+	err = userRepo.SetBanned(user.ID, true, nil)
+	utils.AssertEqual(t, nil, err)
+	dbUser, err = userRepo.GetUser(&user.ID, nil)
+	utils.AssertEqual(t, true, dbUser.Banned)
+	// Unbanning forgets the invalid results too
+	err = userRepo.Unban(user.ID, &repository.AuditEntry{Action: models.AUDIT_USER_UNBANNED, Reason: "appealed"})
+	utils.AssertEqual(t, nil, err)
+	dbUser, err = userRepo.GetUser(&user.ID, nil)
+	utils.AssertEqual(t, false, dbUser.Banned)
+	utils.AssertEqual(t, 0, dbUser.InvalidResultCount)
+
+	// Test audit logs
+	auditRepo := repository.NewAuditService(mockDb)
+	err = auditRepo.RecordAction(user.ID, nil, models.AUDIT_USER_BANNED, "too many invalid results")
+	utils.AssertEqual(t, nil, err)
+	logs, err := auditRepo.GetAuditLogs(&user.ID, 10)
+	utils.AssertEqual(t, nil, err)
+	// The unban was recorded with it
+	utils.AssertEqual(t, 2, len(logs))
+	utils.AssertEqual(t, models.AUDIT_USER_BANNED, logs[0].Action)
+	utils.AssertEqual(t, models.AUDIT_USER_UNBANNED, logs[1].Action)
+	utils.AssertEqual(t, "appealed", logs[1].Reason)
+
 	// Test # Services
 	services, err := userRepo.GetNumberServices()
 	utils.AssertEqual(t, nil, err)
@@ -90,13 +121,60 @@ func TestUserRepo(t *testing.T) {
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, 1, int(services))
 
+	// Test quotas, setting one replaces all limits
+	serviceEmail := "jeff@gmail.com"
+	service, err := userRepo.GetUser(nil, &serviceEmail)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 0, service.Quota.RequestsPerMinute)
+	err = userRepo.SetQuota(service.ID, models.ServiceQuota{RequestsPerMinute: 10, MaxInFlight: 2, MaxDifficulty: serializableModels.DifficultyFromMultiplier(8)}, nil)
+	utils.AssertEqual(t, nil, err)
+	err = userRepo.SetQuota(service.ID, models.ServiceQuota{RequestsPerDay: 100, MaxDifficulty: serializableModels.DifficultyFromMultiplier(8)}, nil)
+	utils.AssertEqual(t, nil, err)
+	service, err = userRepo.GetUser(nil, &serviceEmail)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 0, service.Quota.RequestsPerMinute)
+	utils.AssertEqual(t, 100, service.Quota.RequestsPerDay)
+	utils.AssertEqual(t, 0, service.Quota.MaxInFlight)
+	utils.AssertEqual(t, serializableModels.DifficultyFromMultiplier(8), service.Quota.MaxDifficulty)
+
+	// Test admin moderation
+	err = userRepo.SetCanRequestWork(service.ID, true, nil)
+	utils.AssertEqual(t, nil, err)
+	err = userRepo.SetRewardsExcluded(service.ID, true, nil)
+	utils.AssertEqual(t, nil, err)
+	service, err = userRepo.GetUser(nil, &serviceEmail)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, service.CanRequestWork)
+	utils.AssertEqual(t, true, service.RewardsExcluded)
+	err = userRepo.SetType(user.ID, models.ADMIN, nil)
+	utils.AssertEqual(t, nil, err)
+	dbUser, err = userRepo.GetUser(&user.ID, nil)
+	utils.AssertEqual(t, models.ADMIN, dbUser.Type)
+
+	// Test searching users
+	found, err := userRepo.SearchUsers(repository.UserFilter{Search: "SERVICE1", Limit: 10})
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, len(found))
+	utils.AssertEqual(t, serviceEmail, found[0].Email)
+	found, err = userRepo.SearchUsers(repository.UserFilter{Search: "gmail", Limit: 10})
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, len(found))
+	// Newest first
+	utils.AssertEqual(t, serviceEmail, found[0].Email)
+	found, err = userRepo.SearchUsers(repository.UserFilter{Search: "gmail", Type: models.ADMIN, Limit: 10})
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, len(found))
+	found, err = userRepo.SearchUsers(repository.UserFilter{Limit: 1, Offset: 1})
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, len(found))
+
 	// Test delete user
 	userRepo.DeleteUser(user.ID)
 	dbUser, err = userRepo.GetUser(&user.ID, nil)
 	utils.AssertEqual(t, true, err != nil)
 
 	// TEst generate service token
-	token = userRepo.GenerateServiceToken()
+	token = repository.GenerateServiceToken()
 	utils.AssertEqual(t, 44, len(token))
 	utils.AssertEqual(t, true, strings.HasPrefix(token, "service:"))
 
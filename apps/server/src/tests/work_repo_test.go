@@ -9,6 +9,8 @@ import (
 	"github.com/bananocoin/boompow/apps/server/src/repository"
 	serializableModels "github.com/bananocoin/boompow/libs/models"
 	utils "github.com/bananocoin/boompow/libs/utils/testing"
+	"github.com/bananocoin/boompow/libs/utils/validation"
+	"gorm.io/gorm"
 )
 
 // Test stats repo
@@ -76,6 +78,14 @@ func TestStatsRepo(t *testing.T) {
 	utils.AssertEqual(t, requester.ID, workRequest.RequestedBy)
 	utils.AssertEqual(t, provider.ID, workRequest.ProvidedBy)
 
+	// Work history includes work provided and requested
+	history, err := workRepo.GetWorkHistory(provider.ID, 10, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 3, len(history))
+	history, err = workRepo.GetWorkHistory(provider.ID, 2, 2)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, len(history))
+
 	// Get other stuff
 	workDifficultySum, err := workRepo.GetUnpaidWorkSum()
 	utils.AssertEqual(t, nil, err)
@@ -140,4 +150,26 @@ func TestStatsRepo(t *testing.T) {
 	utils.AssertEqual(t, requester.ID, workRequest.RequestedBy)
 	utils.AssertEqual(t, provider.ID, workRequest.ProvidedBy)
 	utils.AssertEqual(t, 1, len(blockAwardedChan))
+
+	// Work answers requests at or below the difficulty it achieved, from redis or postgres
+	hash := "3F93C5CD2E314FA16702189041E68E68C07B27961BF37F0B7705145BEFBA3AA3"
+	_, err = workRepo.SaveOrUpdateWorkResult(repository.WorkMessage{
+		RequestedByEmail:     requesterEmail,
+		ProvidedByEmail:      providerEmail,
+		Hash:                 hash,
+		Result:               "205452237a9b01f4",
+		DifficultyMultiplier: 1,
+		BlockAward:           true,
+	})
+	utils.AssertEqual(t, nil, err)
+	for _, fromPostgres := range []bool{false, true} {
+		if fromPostgres {
+			database.GetRedisDB().UncacheWork(hash)
+		}
+		work, err := workRepo.RetrieveWorkFromCache(hash, validation.CalculateDifficulty(64))
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, "205452237a9b01f4", work)
+		_, err = workRepo.RetrieveWorkFromCache(hash, validation.CalculateDifficulty(800))
+		utils.AssertEqual(t, gorm.ErrRecordNotFound, err)
+	}
 }
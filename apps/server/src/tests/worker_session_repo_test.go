@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bananocoin/boompow/apps/server/src/database"
+	"github.com/bananocoin/boompow/apps/server/src/models"
+	"github.com/bananocoin/boompow/apps/server/src/repository"
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+	"github.com/google/uuid"
+)
+
+// Test worker session repo
+func TestWorkerSessionRepo(t *testing.T) {
+	os.Setenv("MOCK_REDIS", "true")
+	mockDb, err := database.NewConnection(&database.Config{
+		Host:     os.Getenv("DB_MOCK_HOST"),
+		Port:     os.Getenv("DB_MOCK_PORT"),
+		Password: os.Getenv("DB_MOCK_PASS"),
+		User:     os.Getenv("DB_MOCK_USER"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+		DBName:   "testing",
+	})
+	utils.AssertEqual(t, nil, err)
+	err = database.DropAndCreateTables(mockDb)
+	utils.AssertEqual(t, nil, err)
+	userRepo := repository.NewUserService(mockDb)
+	sessionRepo := repository.NewWorkerSessionService(mockDb)
+
+	err = userRepo.CreateMockUsers()
+	utils.AssertEqual(t, nil, err)
+	providerEmail := "provider@gmail.com"
+	provider, _ := userRepo.GetUser(nil, &providerEmail)
+
+	// The first snapshot creates the session, later ones update its counters
+	connectedAt := time.Now().Add(-time.Hour)
+	session := &models.WorkerSession{
+		ID:          uuid.New(),
+		UserID:      provider.ID,
+		Rig:         "default",
+		IPAddress:   "1.2.3.4",
+		ConnectedAt: connectedAt,
+		UpdatedAt:   connectedAt,
+	}
+	err = sessionRepo.SaveSession(session)
+	utils.AssertEqual(t, nil, err)
+	wonAt := time.Now()
+	session.UpdatedAt = wonAt
+	session.ClientVersion = "1.0.0"
+	session.RequestsSent = 10
+	session.RequestsWon = 4
+	session.InvalidResults = 1
+	session.SolveTimeMs = 2000
+	session.LastWonAt = &wonAt
+	err = sessionRepo.SaveSession(session)
+	utils.AssertEqual(t, nil, err)
+
+	sessions, err := sessionRepo.GetSessions(provider.ID, 50, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, len(sessions))
+	utils.AssertEqual(t, int64(4), sessions[0].RequestsWon)
+	utils.AssertEqual(t, "1.0.0", sessions[0].ClientVersion)
+	utils.AssertEqual(t, true, sessions[0].DisconnectedAt == nil)
+
+	// Winning keeps the provider's last provided work up to date
+	provider, _ = userRepo.GetUser(nil, &providerEmail)
+	utils.AssertEqual(t, true, provider.LastProvidedWorkAt != nil)
+
+	// Once closed, late snapshots don't change it
+	disconnectedAt := time.Now()
+	session.DisconnectedAt = &disconnectedAt
+	session.UpdatedAt = disconnectedAt
+	err = sessionRepo.SaveSession(session)
+	utils.AssertEqual(t, nil, err)
+	late := *session
+	late.DisconnectedAt = nil
+	late.RequestsSent = 100
+	err = sessionRepo.SaveSession(&late)
+	utils.AssertEqual(t, nil, err)
+	sessions, err = sessionRepo.GetSessions(provider.ID, 50, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, int64(10), sessions[0].RequestsSent)
+	utils.AssertEqual(t, true, sessions[0].DisconnectedAt != nil)
+
+	// Sessions nobody saved for a while are closed when they were last saved
+	staleAt := time.Now().Add(-30 * time.Minute)
+	stale := &models.WorkerSession{
+		ID:           uuid.New(),
+		UserID:       provider.ID,
+		Rig:          "other",
+		ConnectedAt:  staleAt.Add(-time.Hour),
+		UpdatedAt:    staleAt,
+		RequestsSent: 5,
+	}
+	err = sessionRepo.SaveSession(stale)
+	utils.AssertEqual(t, nil, err)
+	closed, err := sessionRepo.CloseStaleSessions(time.Now().Add(-5 * time.Minute))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, int64(1), closed)
+	sessions, err = sessionRepo.GetSessions(provider.ID, 50, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, len(sessions))
+	utils.AssertEqual(t, staleAt.Unix(), sessions[1].DisconnectedAt.Unix())
+
+	// Summaries add up every session
+	summary, err := sessionRepo.GetSessionSummary(provider.ID, time.Now().Add(-24*time.Hour))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, int64(2), summary.Sessions)
+	utils.AssertEqual(t, int64(15), summary.RequestsSent)
+	utils.AssertEqual(t, int64(4), summary.RequestsWon)
+	// An hour each, give or take how long the test took
+	utils.AssertEqual(t, true, summary.UptimeSeconds > 7190 && summary.UptimeSeconds < 7210)
+
+	report, err := sessionRepo.GetWorkerReport(time.Now().Add(-24*time.Hour), repository.WorkerReportByInvalidResults, 50)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, len(report))
+	utils.AssertEqual(t, providerEmail, report[0].Email)
+	_, err = sessionRepo.GetWorkerReport(time.Now(), "nonsense", 50)
+	utils.AssertEqual(t, true, err != nil)
+}
@@ -0,0 +1,40 @@
+package models
+
+// Current version of the hello message, bump when changing its meaning
+const ClientHelloVersion = 1
+
+// Header a worker names its rig with when it connects, so one account can run several
+const RigHeader = "X-Worker-Rig"
+
+// Message sent from client -> server after connecting, describing what the worker is able and willing to do
+type ClientHello struct {
+	MessageType   MessageType `json:"request_type"`
+	Version       int         `json:"version"`
+	ClientVersion string      `json:"client_version"`
+	// Difficulty multipliers the worker will compute
+	MinDifficulty int `json:"min_difficulty"`
+	MaxDifficulty int `json:"max_difficulty"`
+	// Worker does not want precache requests
+	NoPrecache bool          `json:"no_precache"`
+	Devices    ClientDevices `json:"devices"`
+	// Number of requests the worker computes at the same time
+	Concurrency int `json:"concurrency"`
+	// Benchmarked hashes per second
+	Hashrate float64 `json:"hashrate"`
+}
+
+type ClientDevices struct {
+	CPUThreads int `json:"cpu_threads"`
+	GPUCount   int `json:"gpu_count"`
+}
+
+// Accepts returns whether the worker would compute a request with these parameters
+func (h *ClientHello) Accepts(difficultyMultiplier int, precache bool) bool {
+	if h.MaxDifficulty > 0 && difficultyMultiplier > h.MaxDifficulty {
+		return false
+	}
+	if difficultyMultiplier < h.MinDifficulty {
+		return false
+	}
+	return !(precache && h.NoPrecache)
+}
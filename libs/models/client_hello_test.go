@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestSerializeDeserializeClientHello(t *testing.T) {
+	hello := ClientHello{
+		MessageType:   Hello,
+		Version:       ClientHelloVersion,
+		ClientVersion: "1.0.0",
+		MinDifficulty: 1,
+		MaxDifficulty: 64,
+		NoPrecache:    true,
+		Devices: ClientDevices{
+			CPUThreads: 8,
+			GPUCount:   2,
+		},
+		Concurrency: 1,
+		Hashrate:    1234.5,
+	}
+
+	bytes, err := json.Marshal(hello)
+	utils.AssertEqual(t, nil, err)
+
+	var deserialized map[string]interface{}
+	err = json.Unmarshal(bytes, &deserialized)
+	utils.AssertEqual(t, nil, err)
+
+	utils.AssertEqual(t, "hello", deserialized["request_type"])
+	utils.AssertEqual(t, float64(ClientHelloVersion), deserialized["version"])
+	utils.AssertEqual(t, "1.0.0", deserialized["client_version"])
+	utils.AssertEqual(t, float64(64), deserialized["max_difficulty"])
+	utils.AssertEqual(t, true, deserialized["no_precache"])
+	utils.AssertEqual(t, float64(2), deserialized["devices"].(map[string]interface{})["gpu_count"])
+	utils.AssertEqual(t, 1234.5, deserialized["hashrate"])
+}
+
+func TestClientHelloAccepts(t *testing.T) {
+	hello := ClientHello{
+		MinDifficulty: 2,
+		MaxDifficulty: 64,
+		NoPrecache:    true,
+	}
+
+	utils.AssertEqual(t, true, hello.Accepts(2, false))
+	utils.AssertEqual(t, true, hello.Accepts(64, false))
+	utils.AssertEqual(t, false, hello.Accepts(1, false))
+	utils.AssertEqual(t, false, hello.Accepts(128, false))
+	utils.AssertEqual(t, false, hello.Accepts(8, true))
+
+	// No max set
+	hello.MaxDifficulty = 0
+	utils.AssertEqual(t, true, hello.Accepts(128, false))
+}
@@ -1,11 +1,14 @@
 package models
 
+import "github.com/bananocoin/boompow/libs/utils/validation"
+
 type MessageType string
 
 const (
 	WorkGenerate MessageType = "work_generate"
 	WorkCancel   MessageType = "work_cancel"
 	BlockAwarded MessageType = "block_awarded"
+	Hello        MessageType = "hello"
 )
 
 // Message sent from server -> client
@@ -15,12 +18,38 @@ type ClientMessage struct {
 	BlockAward     bool        `json:"-"`
 	MessageType    MessageType `json:"request_type"`
 	// We attach a unique request ID to each request, this links it to user requesting work
-	RequestID            string `json:"request_id"`
-	Hash                 string `json:"hash"`
-	DifficultyMultiplier int    `json:"difficulty_multiplier"`
+	RequestID string `json:"request_id"`
+	Hash      string `json:"hash"`
+	// Whole multiplier at least as hard as Difficulty, older clients only look at this
+	DifficultyMultiplier int        `json:"difficulty_multiplier"`
+	Difficulty           Difficulty `json:"difficulty,omitempty"`
+	// Network the work is for, if we know it
+	Network string `json:"-"`
 	// Awarded info
 	ProviderEmail  string  `json:"-"`
+	ProviderWorker string  `json:"-"`
 	PercentOfPool  float64 `json:"percent_of_pool"`
 	EstimatedAward float64 `json:"estimated_award"`
 	Precache       bool    `json:"precache"`
+	// Older servers don't send this, see EffectivePriority
+	Priority Priority `json:"priority,omitempty"`
+}
+
+// EffectivePriority is the request's priority, falling back to the precache flag for requests without one
+func (m *ClientMessage) EffectivePriority() Priority {
+	if m.Priority != "" {
+		return m.Priority
+	}
+	if m.Precache {
+		return PriorityPrecache
+	}
+	return PriorityInteractive
+}
+
+// Threshold is the difficulty the work must meet, falling back to the multiplier if no difficulty was set
+func (m *ClientMessage) Threshold() uint64 {
+	if m.Difficulty != 0 {
+		return uint64(m.Difficulty)
+	}
+	return validation.CalculateDifficulty(int64(m.DifficultyMultiplier))
 }
@@ -34,4 +34,18 @@ func TestSerializeDeserializeClientRequest(t *testing.T) {
 	utils.AssertEqual(t, "hash", deserialized["hash"])
 	utils.AssertEqual(t, float64(3), deserialized["difficulty_multiplier"])
 	utils.AssertEqual(t, true, deserialized["precache"])
+	utils.AssertEqual(t, nil, deserialized["priority"])
+}
+
+func TestEffectivePriority(t *testing.T) {
+	message := ClientMessage{}
+	utils.AssertEqual(t, PriorityInteractive, message.EffectivePriority())
+	message.Precache = true
+	utils.AssertEqual(t, PriorityPrecache, message.EffectivePriority())
+	message.Priority = PriorityBulk
+	utils.AssertEqual(t, PriorityBulk, message.EffectivePriority())
+
+	utils.AssertEqual(t, true, PriorityInteractive.Before(PriorityPrecache))
+	utils.AssertEqual(t, true, PriorityPrecache.Before(PriorityBulk))
+	utils.AssertEqual(t, false, PriorityBulk.Before(Priority("unknown")))
 }
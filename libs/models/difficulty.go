@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/bananocoin/boompow/libs/utils/validation"
+)
+
+// Difficulty is an absolute work threshold, serialized as 16 hex characters like the node does
+// Zero means unset
+type Difficulty uint64
+
+func ParseDifficulty(raw string) (Difficulty, error) {
+	if len(raw) != 16 {
+		return 0, fmt.Errorf("difficulty must be 16 hex characters, got %q", raw)
+	}
+	difficulty, err := strconv.ParseUint(raw, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid difficulty %q", raw)
+	}
+	return Difficulty(difficulty), nil
+}
+
+// DifficultyFromMultiplier returns the difficulty this many times harder than the base difficulty
+func DifficultyFromMultiplier(multiplier float64) Difficulty {
+	return Difficulty(validation.MultiplierToDifficulty(multiplier))
+}
+
+func (d Difficulty) String() string {
+	return fmt.Sprintf("%016x", uint64(d))
+}
+
+// Multiplier returns how many times harder this is than the base difficulty
+func (d Difficulty) Multiplier() float64 {
+	return validation.DifficultyToMultiplier(uint64(d))
+}
+
+// CeilMultiplier is the smallest whole multiplier at least this hard, for things that only understand whole multipliers
+func (d Difficulty) CeilMultiplier() int {
+	// Allow for float error so e.g. 2.0000000001 doesn't become 3
+	multiplier := int(math.Ceil(d.Multiplier() - 1e-9))
+	if multiplier < 1 {
+		return 1
+	}
+	return multiplier
+}
+
+func (d Difficulty) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Difficulty) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == "" {
+		*d = 0
+		return nil
+	}
+	parsed, err := ParseDifficulty(raw)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Stored as hex, postgres has no unsigned 64 bit integer
+func (d Difficulty) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Difficulty) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+		*d = 0
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Difficulty", src)
+	}
+	if raw == "" {
+		*d = 0
+		return nil
+	}
+	parsed, err := ParseDifficulty(raw)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
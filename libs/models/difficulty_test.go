@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestParseDifficulty(t *testing.T) {
+	difficulty, err := ParseDifficulty("fffffff800000000")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, Difficulty(0xfffffff800000000), difficulty)
+	utils.AssertEqual(t, "fffffff800000000", difficulty.String())
+
+	_, err = ParseDifficulty("fffffff8")
+	utils.AssertEqual(t, true, err != nil)
+	_, err = ParseDifficulty("zzzzzzzzzzzzzzzz")
+	utils.AssertEqual(t, true, err != nil)
+}
+
+func TestDifficultyMultiplier(t *testing.T) {
+	utils.AssertEqual(t, Difficulty(0xfffffe0000000000), DifficultyFromMultiplier(1))
+	utils.AssertEqual(t, Difficulty(0xfffffff800000000), DifficultyFromMultiplier(64))
+	utils.AssertEqual(t, 64.0, Difficulty(0xfffffff800000000).Multiplier())
+
+	utils.AssertEqual(t, 64, Difficulty(0xfffffff800000000).CeilMultiplier())
+	utils.AssertEqual(t, 3, DifficultyFromMultiplier(3).CeilMultiplier())
+	utils.AssertEqual(t, 2, DifficultyFromMultiplier(1.5).CeilMultiplier())
+	// Easier than the base difficulty
+	utils.AssertEqual(t, 1, Difficulty(0xfffff00000000000).CeilMultiplier())
+}
+
+func TestSerializeDifficulty(t *testing.T) {
+	message := ClientMessage{
+		Hash:       "hash",
+		Difficulty: Difficulty(0xfffffff800000000),
+	}
+	bytes, err := json.Marshal(message)
+	utils.AssertEqual(t, nil, err)
+
+	var deserialized map[string]interface{}
+	err = json.Unmarshal(bytes, &deserialized)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "fffffff800000000", deserialized["difficulty"])
+
+	var roundTrip ClientMessage
+	err = json.Unmarshal(bytes, &roundTrip)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, message.Difficulty, roundTrip.Difficulty)
+
+	// Old servers don't send a difficulty
+	var old ClientMessage
+	err = json.Unmarshal([]byte(`{"hash":"hash","difficulty_multiplier":8}`), &old)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, Difficulty(0), old.Difficulty)
+	utils.AssertEqual(t, uint64(DifficultyFromMultiplier(8)), old.Threshold())
+}
+
+func TestScanDifficulty(t *testing.T) {
+	var difficulty Difficulty
+	utils.AssertEqual(t, nil, difficulty.Scan("fffffff800000000"))
+	utils.AssertEqual(t, Difficulty(0xfffffff800000000), difficulty)
+	utils.AssertEqual(t, nil, difficulty.Scan([]byte("fffffe0000000000")))
+	utils.AssertEqual(t, Difficulty(0xfffffe0000000000), difficulty)
+	utils.AssertEqual(t, nil, difficulty.Scan(nil))
+	utils.AssertEqual(t, Difficulty(0), difficulty)
+
+	value, err := Difficulty(0xfffffff800000000).Value()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "fffffff800000000", value)
+}
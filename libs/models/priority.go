@@ -0,0 +1,31 @@
+package models
+
+// Priority is the class of a work request, higher classes are dispatched and computed first
+type Priority string
+
+const (
+	// A service is waiting on the work right now
+	PriorityInteractive Priority = "interactive"
+	// Work we generate ahead of time for the next block of an account
+	PriorityPrecache Priority = "precache"
+	// Services that said they can wait, or that we don't want to hold up anybody else
+	PriorityBulk Priority = "bulk"
+)
+
+// Rank orders priorities, lower is served first
+// Unknown priorities from newer servers rank last
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityInteractive:
+		return 0
+	case PriorityPrecache:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Before returns whether requests of this priority are served before requests of the other
+func (p Priority) Before(other Priority) bool {
+	return p.Rank() < other.Rank()
+}
@@ -26,6 +26,13 @@ func GetAllowedEmails() []string {
 	return strings.Split(raw, ",")
 }
 
+// Services whose requests are bulk priority, served after everybody else's
+func GetBulkServices() []string {
+	raw := GetEnv("BPOW_BULK_SERVICES", "")
+	return strings.Split(raw, ",")
+}
+
+// Only read to import service tokens from before they were kept in postgres
 func GetServiceTokens() []string {
 	raw := GetEnv("BPOW_SERVICE_TOKENS", "")
 	return strings.Split(raw, ",")
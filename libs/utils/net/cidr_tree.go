@@ -0,0 +1,143 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// CIDRTree is a binary radix tree of IP prefixes
+// Lookups walk one bit at a time and return the longest prefix that contains the address
+type CIDRTree[T any] struct {
+	v4   *cidrNode[T]
+	v6   *cidrNode[T]
+	size int
+}
+
+type cidrNode[T any] struct {
+	children [2]*cidrNode[T]
+	value    T
+	set      bool
+}
+
+func NewCIDRTree[T any]() *CIDRTree[T] {
+	return &CIDRTree[T]{
+		v4: &cidrNode[T]{},
+		v6: &cidrNode[T]{},
+	}
+}
+
+func (t *CIDRTree[T]) root(addr netip.Addr) *cidrNode[T] {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// Insert a prefix, returns false and keeps the existing value if the prefix is already in the tree
+func (t *CIDRTree[T]) Insert(prefix netip.Prefix, value T) bool {
+	if !prefix.IsValid() {
+		return false
+	}
+	prefix = normalizePrefix(prefix)
+	addr := prefix.Addr()
+	node := t.root(addr)
+	octets := addr.AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := (octets[i/8] >> (7 - i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &cidrNode[T]{}
+		}
+		node = node.children[bit]
+	}
+	if node.set {
+		return false
+	}
+	node.value = value
+	node.set = true
+	t.size++
+	return true
+}
+
+// Lookup returns the value of the longest prefix containing the address
+func (t *CIDRTree[T]) Lookup(addr netip.Addr) (value T, ok bool) {
+	if !addr.IsValid() {
+		return value, false
+	}
+	addr = addr.Unmap()
+	node := t.root(addr)
+	octets := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.set {
+			value, ok = node.value, true
+		}
+		if i == len(octets)*8 {
+			break
+		}
+		node = node.children[(octets[i/8]>>(7-i%8))&1]
+	}
+	return value, ok
+}
+
+// Len is the number of prefixes in the tree
+func (t *CIDRTree[T]) Len() int {
+	return t.size
+}
+
+// IPv4 mapped prefixes are stored as IPv4, and host bits are dropped
+func normalizePrefix(prefix netip.Prefix) netip.Prefix {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked()
+}
+
+// ParsePrefix parses a CIDR, a single address is a prefix of its full length
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return normalizePrefix(prefix), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ParseCIDRList reads one CIDR or address per line, anything after it on the line is ignored
+// Blank lines and lines starting with # are skipped
+func ParseCIDRList(data []byte) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		prefix, err := ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, scanner.Err()
+}
+
+// ParseAddr parses an address that may have a port, like RemoteAddr
+func ParseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,87 @@
+package net
+
+import (
+	"net/netip"
+	"testing"
+
+	utils "github.com/bananocoin/boompow/libs/utils/testing"
+)
+
+func TestCIDRTreeLongestPrefix(t *testing.T) {
+	tree := NewCIDRTree[string]()
+	for cidr, value := range map[string]string{
+		"95.216.0.0/16":      "hetzner",
+		"95.216.77.0/24":     "office",
+		"95.216.77.23":       "host",
+		"2a01:4f9::/32":      "hetzner6",
+		"2a01:4f9:c010::/48": "office6",
+	} {
+		prefix, err := ParsePrefix(cidr)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, true, tree.Insert(prefix, value))
+	}
+	utils.AssertEqual(t, 5, tree.Len())
+
+	for ip, expected := range map[string]string{
+		"95.216.1.1":            "hetzner",
+		"95.216.77.1":           "office",
+		"95.216.77.23":          "host",
+		"::ffff:95.216.77.23":   "host",
+		"2a01:4f9:1::1":         "hetzner6",
+		"2a01:4f9:c010:780c::1": "office6",
+	} {
+		value, ok := tree.Lookup(netip.MustParseAddr(ip))
+		utils.AssertEqual(t, true, ok)
+		utils.AssertEqual(t, expected, value)
+	}
+
+	for _, ip := range []string{"123.45.67.89", "95.217.0.1", "2a01:4f8::1", "::1"} {
+		_, ok := tree.Lookup(netip.MustParseAddr(ip))
+		utils.AssertEqual(t, false, ok)
+	}
+	_, ok := tree.Lookup(netip.Addr{})
+	utils.AssertEqual(t, false, ok)
+}
+
+func TestCIDRTreeKeepsFirst(t *testing.T) {
+	tree := NewCIDRTree[int]()
+	utils.AssertEqual(t, true, tree.Insert(netip.MustParsePrefix("10.0.0.0/8"), 1))
+	// Same prefix once the host bits are dropped
+	utils.AssertEqual(t, false, tree.Insert(netip.MustParsePrefix("10.1.2.3/8"), 2))
+	value, _ := tree.Lookup(netip.MustParseAddr("10.9.9.9"))
+	utils.AssertEqual(t, 1, value)
+
+	// The whole address space
+	utils.AssertEqual(t, true, tree.Insert(netip.MustParsePrefix("0.0.0.0/0"), 3))
+	value, _ = tree.Lookup(netip.MustParseAddr("1.1.1.1"))
+	utils.AssertEqual(t, 3, value)
+	_, ok := tree.Lookup(netip.MustParseAddr("2001:db8::1"))
+	utils.AssertEqual(t, false, ok)
+}
+
+func TestParseCIDRList(t *testing.T) {
+	prefixes, err := ParseCIDRList([]byte("# Comment\n\n173.245.48.0/20\n2400:cb00::/32 cloudflare\n1.2.3.4\n"))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 3, len(prefixes))
+	utils.AssertEqual(t, "173.245.48.0/20", prefixes[0].String())
+	utils.AssertEqual(t, "2400:cb00::/32", prefixes[1].String())
+	utils.AssertEqual(t, "1.2.3.4/32", prefixes[2].String())
+
+	_, err = ParseCIDRList([]byte("1.2.3.0/24\nnot-an-ip\n"))
+	utils.AssertEqual(t, "line 2: ParseAddr(\"not-an-ip\"): unable to parse IP", err.Error())
+}
+
+func TestParseAddr(t *testing.T) {
+	for input, expected := range map[string]string{
+		"1.2.3.4":           "1.2.3.4",
+		"1.2.3.4:5678":      "1.2.3.4",
+		"[2a01:4f9::1]:443": "2a01:4f9::1",
+		"::ffff:1.2.3.4":    "1.2.3.4",
+	} {
+		addr, ok := ParseAddr(input)
+		utils.AssertEqual(t, true, ok)
+		utils.AssertEqual(t, expected, addr.String())
+	}
+	_, ok := ParseAddr("unknown")
+	utils.AssertEqual(t, false, ok)
+}
@@ -4,17 +4,7 @@ import (
 	"net/http"
 )
 
-// Get a clients real user IP Address
+// Get a clients real user IP Address, see TrustedProxies.ClientIP
 func GetIPAddress(r *http.Request) string {
-	IPAddress := r.Header.Get("CF-Connecting-IP")
-	if IPAddress == "" {
-		IPAddress = r.Header.Get("X-Real-Ip")
-	}
-	if IPAddress == "" {
-		IPAddress = r.Header.Get("X-Forwarded-For")
-	}
-	if IPAddress == "" {
-		IPAddress = r.RemoteAddr
-	}
-	return IPAddress
+	return getTrustedProxies().ClientIP(r)
 }
@@ -8,28 +8,92 @@ import (
 	utils "github.com/bananocoin/boompow/libs/utils/testing"
 )
 
+func newRequest(remoteAddr string, headers map[string]string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, "appditto.com", bytes.NewReader([]byte("")))
+	request.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		request.Header.Add(key, value)
+	}
+	return request
+}
+
 func TestGetIPAddressFromHeader(t *testing.T) {
 	ip := "123.45.67.89"
+	// An ingress inside the cluster, and Cloudflare's edge
+	proxy := "10.0.0.5:41234"
+	edge := "172.64.1.1"
 
-	// 4 methods of getting IP Address, CF-Connecting-IP preferred, X-Real-Ip, then X-Forwarded-For, then RemoteAddr
+	// CF-Connecting-IP from Cloudflare, straight to us or through the ingress
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(edge+":443", map[string]string{"CF-Connecting-IP": ip})))
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(proxy, map[string]string{
+		"CF-Connecting-IP": ip,
+		"X-Forwarded-For":  "not-the-ip, " + edge,
+	})))
+	// Then X-Forwarded-For, then RemoteAddr
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(proxy, map[string]string{"X-Forwarded-For": ip})))
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(ip+":443", nil)))
+	utils.AssertEqual(t, "2a01:4f9::1", GetIPAddress(newRequest("[2a01:4f9::1]:443", nil)))
+}
 
-	request, _ := http.NewRequest(http.MethodPost, "appditto.com", bytes.NewReader([]byte("")))
-	request.Header.Set("CF-Connecting-IP", ip)
-	request.Header.Set("X-Real-Ip", "not-the-ip")
-	request.Header.Set("X-Forwarded-For", "not-the-ip")
-	utils.AssertEqual(t, ip, GetIPAddress(request))
+func TestGetIPAddressUntrustedPeer(t *testing.T) {
+	// Anyone hitting the origin directly can't pick their IP
+	ip := "123.45.67.89"
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(ip+":443", map[string]string{
+		"CF-Connecting-IP": "1.1.1.1",
+		"X-Real-Ip":        "1.1.1.1",
+		"X-Forwarded-For":  "1.1.1.1",
+	})))
+}
 
-	request, _ = http.NewRequest(http.MethodPost, "appditto.com", bytes.NewReader([]byte("")))
-	request.Header.Set("X-Real-Ip", ip)
-	request.Header.Set("X-Forwarded-For", "not-the-ip")
+func TestGetIPAddressSpoofedThroughIngress(t *testing.T) {
+	// Reaching the ingress without going through Cloudflare, it passes the headers on and appends the real address
+	ip := "123.45.67.89"
+	proxy := "10.0.0.5:41234"
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(proxy, map[string]string{
+		"CF-Connecting-IP": "1.1.1.1",
+		"X-Real-Ip":        "1.1.1.1",
+		"X-Forwarded-For":  ip,
+	})))
+	// A made up Cloudflare hop left of the real one doesn't help
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(proxy, map[string]string{
+		"CF-Connecting-IP": "1.1.1.1",
+		"X-Forwarded-For":  "172.64.1.1, " + ip,
+	})))
+	// Nor does an ingress that only passes headers on
+	utils.AssertEqual(t, "10.0.0.5", GetIPAddress(newRequest(proxy, map[string]string{"CF-Connecting-IP": "1.1.1.1"})))
+}
 
-	utils.AssertEqual(t, ip, GetIPAddress(request))
+func TestGetIPAddressForwardedFor(t *testing.T) {
+	ip := "123.45.67.89"
+	proxy := "10.0.0.5:41234"
 
-	request, _ = http.NewRequest(http.MethodPost, "appditto.com", bytes.NewReader([]byte("")))
-	request.Header.Set("X-Forwarded-For", ip)
+	// Through Cloudflare and the ingress, with a spoofed address in front
+	utils.AssertEqual(t, ip, GetIPAddress(newRequest(proxy, map[string]string{"X-Forwarded-For": "1.1.1.1, " + ip + ", 172.64.1.1"})))
+	// Spread over several headers
+	request := newRequest(proxy, map[string]string{"X-Forwarded-For": "1.1.1.1"})
+	request.Header.Add("X-Forwarded-For", ip+",10.0.0.9")
 	utils.AssertEqual(t, ip, GetIPAddress(request))
+	// Everything is trusted, the leftmost is as far back as we can see
+	utils.AssertEqual(t, "10.0.0.9", GetIPAddress(newRequest(proxy, map[string]string{"X-Forwarded-For": "10.0.0.9, 172.64.1.1"})))
+	// Garbage falls back to the last hop we could read
+	utils.AssertEqual(t, "10.0.0.5", GetIPAddress(newRequest(proxy, map[string]string{"X-Forwarded-For": "not-the-ip"})))
+}
 
-	request, _ = http.NewRequest(http.MethodPost, "appditto.com", bytes.NewReader([]byte("")))
-	request.RemoteAddr = ip
-	utils.AssertEqual(t, ip, GetIPAddress(request))
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"cloudflare", " 203.0.113.0/24", ""})
+	utils.AssertEqual(t, nil, err)
+	SetTrustedProxies(proxies)
+	defer SetTrustedProxies(DefaultTrustedProxies())
+
+	// Private networks aren't trusted anymore
+	utils.AssertEqual(t, "10.0.0.5", GetIPAddress(newRequest("10.0.0.5:41234", map[string]string{"X-Forwarded-For": "1.1.1.1"})))
+	utils.AssertEqual(t, "1.1.1.1", GetIPAddress(newRequest("203.0.113.7:41234", map[string]string{"X-Forwarded-For": "1.1.1.1"})))
+	utils.AssertEqual(t, "1.1.1.1", GetIPAddress(newRequest("[2606:4700::1]:443", map[string]string{"CF-Connecting-IP": "1.1.1.1"})))
+	// CF-Connecting-IP only comes from Cloudflare, other trusted proxies can't set it
+	utils.AssertEqual(t, "1.1.1.1", GetIPAddress(newRequest("203.0.113.7:41234", map[string]string{"CF-Connecting-IP": "2.2.2.2", "X-Forwarded-For": "1.1.1.1"})))
+
+	_, err = ParseTrustedProxies([]string{"cloudflare", "not-a-cidr"})
+	if err == nil {
+		t.Errorf("Expected error parsing an invalid proxy")
+	}
 }
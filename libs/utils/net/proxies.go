@@ -0,0 +1,146 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Cloudflare's edge, from https://www.cloudflare.com/ips (scripts/cf_ips.sh fetches the current list)
+var cloudflareRanges = []string{
+	"173.245.48.0/20",
+	"103.21.244.0/22",
+	"103.22.200.0/22",
+	"103.31.4.0/22",
+	"141.101.64.0/18",
+	"108.162.192.0/18",
+	"190.93.240.0/20",
+	"188.114.96.0/20",
+	"197.234.240.0/22",
+	"198.41.128.0/17",
+	"162.158.0.0/15",
+	"104.16.0.0/13",
+	"104.24.0.0/14",
+	"172.64.0.0/13",
+	"131.0.72.0/22",
+	"2400:cb00::/32",
+	"2606:4700::/32",
+	"2803:f800::/32",
+	"2405:b500::/32",
+	"2405:8100::/32",
+	"2a06:98c0::/29",
+	"2c0f:f248::/32",
+}
+
+// Only Cloudflare's edge sets CF-Connecting-IP, whatever the trusted proxies are
+var cloudflareTree = func() *CIDRTree[bool] {
+	tree := NewCIDRTree[bool]()
+	for _, cidr := range cloudflareRanges {
+		prefix, _ := ParsePrefix(cidr)
+		tree.Insert(prefix, true)
+	}
+	return tree
+}()
+
+// Loopback and private networks, where a cluster's ingress lives
+var privateRanges = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// TrustedProxies are the peers we believe forwarded headers from
+type TrustedProxies struct {
+	tree *CIDRTree[bool]
+}
+
+// ParseTrustedProxies reads CIDRs and addresses
+// "cloudflare" stands for Cloudflare's ranges and "private" for loopback and private networks
+func ParseTrustedProxies(entries []string) (*TrustedProxies, error) {
+	proxies := &TrustedProxies{tree: NewCIDRTree[bool]()}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		var cidrs []string
+		switch strings.ToLower(entry) {
+		case "":
+			continue
+		case "cloudflare":
+			cidrs = cloudflareRanges
+		case "private":
+			cidrs = privateRanges
+		default:
+			cidrs = []string{entry}
+		}
+		for _, cidr := range cidrs {
+			prefix, err := ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s: %w", cidr, err)
+			}
+			proxies.tree.Insert(prefix, true)
+		}
+	}
+	return proxies, nil
+}
+
+// DefaultTrustedProxies trusts Cloudflare and private networks
+func DefaultTrustedProxies() *TrustedProxies {
+	proxies, _ := ParseTrustedProxies([]string{"cloudflare", "private"})
+	return proxies
+}
+
+func (p *TrustedProxies) Contains(addr netip.Addr) bool {
+	_, ok := p.tree.Lookup(addr)
+	return ok
+}
+
+// ClientIP finds who sent the request
+// The hops are walked from the peer that connected to us back through X-Forwarded-For, the client is the first that isn't a trusted proxy
+// CF-Connecting-IP is only believed from the hop that connected to Cloudflare's edge, anyone reaching an ingress directly could set it
+func (p *TrustedProxies) ClientIP(r *http.Request) string {
+	peer, ok := ParseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	// Each proxy appends who it heard from, a header can be sent more than once
+	hops := []string{}
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	client := peer
+	for i := len(hops); p.Contains(client); i-- {
+		if _, ok := cloudflareTree.Lookup(client); ok {
+			if addr, ok := ParseAddr(r.Header.Get("CF-Connecting-IP")); ok {
+				return addr.String()
+			}
+		}
+		if i == 0 {
+			break
+		}
+		addr, ok := ParseAddr(hops[i-1])
+		if !ok {
+			// Anything left of garbage could have been made up
+			break
+		}
+		client = addr
+	}
+	return client.String()
+}
+
+var trustedProxies atomic.Pointer[TrustedProxies]
+
+// SetTrustedProxies replaces the proxies GetIPAddress trusts
+func SetTrustedProxies(proxies *TrustedProxies) {
+	trustedProxies.Store(proxies)
+}
+
+func getTrustedProxies() *TrustedProxies {
+	if proxies := trustedProxies.Load(); proxies != nil {
+		return proxies
+	}
+	return DefaultTrustedProxies()
+}
@@ -3,6 +3,8 @@ package validation
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"math"
 
 	"golang.org/x/crypto/blake2b"
 )
@@ -24,20 +26,32 @@ func CalculateDifficulty(multiplier int64) uint64 {
 	return baseMaxUint64 - (baseDifficulty / uint64(multiplier))
 }
 
-func IsWorkValid(previous string, difficultyMultiplier int, w string) bool {
-	difficult := CalculateDifficulty(int64(difficultyMultiplier))
-	previousEnc, err := hex.DecodeString(previous)
+// IsWorkValid returns whether the work meets the difficulty threshold for this hash
+func IsWorkValid(previous string, difficulty uint64, w string) bool {
+	value, err := WorkValue(previous, w)
 	if err != nil {
 		return false
 	}
+	return value >= difficulty
+}
+
+// WorkValue returns the difficulty the work achieves for this hash
+func WorkValue(previous string, w string) (uint64, error) {
+	previousEnc, err := hex.DecodeString(previous)
+	if err != nil {
+		return 0, err
+	}
 	wEnc, err := hex.DecodeString(w)
 	if err != nil {
-		return false
+		return 0, err
+	}
+	if len(wEnc) != 8 {
+		return 0, errors.New("work must be 8 bytes")
 	}
 
 	hash, err := blake2b.New(8, nil)
 	if err != nil {
-		return false
+		return 0, err
 	}
 
 	n := make([]byte, 8)
@@ -47,7 +61,21 @@ func IsWorkValid(previous string, difficultyMultiplier int, w string) bool {
 	hash.Write(n)
 	hash.Write(previousEnc[:])
 
-	return binary.LittleEndian.Uint64(hash.Sum(nil)) >= difficult
+	return binary.LittleEndian.Uint64(hash.Sum(nil)), nil
+}
+
+// DifficultyToMultiplier returns how many times harder the difficulty is than the base difficulty
+// Same as the node, (2^64 - base) / (2^64 - difficulty)
+func DifficultyToMultiplier(difficulty uint64) float64 {
+	return (float64(baseDifficulty) + 1) / (float64(baseMaxUint64-difficulty) + 1)
+}
+
+// MultiplierToDifficulty returns the difficulty this many times harder than the base difficulty
+func MultiplierToDifficulty(multiplier float64) uint64 {
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	return baseMaxUint64 - uint64(math.Floor(float64(baseDifficulty)/multiplier))
 }
 
 func reverse(v []byte) {
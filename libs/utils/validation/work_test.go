@@ -12,23 +12,45 @@ func TestWorkValidation(t *testing.T) {
 	hash := "3F93C5CD2E314FA16702189041E68E68C07B27961BF37F0B7705145BEFBA3AA3"
 
 	// Check that we can access these items
-	utils.AssertEqual(t, true, IsWorkValid(hash, 1, workResult))
+	utils.AssertEqual(t, true, IsWorkValid(hash, CalculateDifficulty(1), workResult))
 
 	// Invalid result
 	workResult = "205452237a9b01f4"
 	hash = "3F93C5CD2E314FA16702189041E68E68C07B27961BF37F0B7705145BEFBA3AA3"
 
 	// Check that we can access these items
-	utils.AssertEqual(t, false, IsWorkValid(hash, 800, workResult))
+	utils.AssertEqual(t, false, IsWorkValid(hash, CalculateDifficulty(800), workResult))
+
+	// Absolute thresholds
+	utils.AssertEqual(t, true, IsWorkValid(hash, 0xfffffe0000000000, workResult))
 
 	// Invalid result
 	workResult = "205452237a9b01f4"
 	hash = "F1C59E6C738BB82221E082910740BADC58301F8F32291E07CCC4CDBEEAD44348"
 
 	// Check that we can access these items
-	utils.AssertEqual(t, false, IsWorkValid(hash, 1, workResult))
+	utils.AssertEqual(t, false, IsWorkValid(hash, CalculateDifficulty(1), workResult))
 
 	hash = "03DDDFF29D3FF3DC41B5374A10A70B49F7AA41E42461511D6A64F346F9C8421E"
 	workResult = "00000000002d7708"
-	utils.AssertEqual(t, false, IsWorkValid(hash, 1, workResult))
+	utils.AssertEqual(t, false, IsWorkValid(hash, CalculateDifficulty(1), workResult))
+}
+
+func TestWorkValue(t *testing.T) {
+	hash := "3F93C5CD2E314FA16702189041E68E68C07B27961BF37F0B7705145BEFBA3AA3"
+	value, err := WorkValue(hash, "205452237a9b01f4")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, value >= CalculateDifficulty(1))
+	utils.AssertEqual(t, true, value < CalculateDifficulty(800))
+
+	_, err = WorkValue(hash, "2054")
+	utils.AssertEqual(t, true, err != nil)
+}
+
+func TestDifficultyMultiplier(t *testing.T) {
+	utils.AssertEqual(t, uint64(0xfffffe0000000000), MultiplierToDifficulty(1))
+	utils.AssertEqual(t, uint64(0xfffffff800000000), MultiplierToDifficulty(64))
+	utils.AssertEqual(t, 1.0, DifficultyToMultiplier(0xfffffe0000000000))
+	utils.AssertEqual(t, 64.0, DifficultyToMultiplier(0xfffffff800000000))
+	utils.AssertEqual(t, CalculateDifficulty(8), MultiplierToDifficulty(8))
 }